@@ -0,0 +1,939 @@
+package pq
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var typeByteSlice = reflect.TypeOf([]byte{})
+var typeDriverValuer = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+var typeSQLScanner = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// Array returns the optimal driver.Valuer and sql.Scanner for an array or
+// slice of any dimension.
+//
+// For example:
+//
+//	db.Query(`SELECT * FROM t WHERE id = ANY($1)`, pq.Array([]int{235, 401}))
+//
+//	var x []sql.NullInt64
+//	db.QueryRow(`SELECT ARRAY[235, 401]`).Scan(pq.Array(&x))
+//
+// Arrays where the lower bound is not one (such as `[0:0]={1}') are scanned
+// as if their lower bound was one.
+func Array(a interface{}) interface {
+	driver.Valuer
+	sql.Scanner
+} {
+	switch a := a.(type) {
+	case []bool:
+		return (*BoolArray)(&a)
+	case []float64:
+		return (*Float64Array)(&a)
+	case []int64:
+		return (*Int64Array)(&a)
+	case []string:
+		return (*StringArray)(&a)
+	case [][]byte:
+		return (*ByteaArray)(&a)
+
+	case *[]bool:
+		return (*BoolArray)(a)
+	case *[]float64:
+		return (*Float64Array)(a)
+	case *[]int64:
+		return (*Int64Array)(a)
+	case *[]string:
+		return (*StringArray)(a)
+	case *[][]byte:
+		return (*ByteaArray)(a)
+	}
+
+	return GenericArray{a}
+}
+
+// ArrayDelimiter may be optionally implemented by driver.Valuer or sql.Scanner
+// to override the array delimiter used by GenericArray.  For example, the
+// PostgreSQL box type uses a semicolon.
+type ArrayDelimiter interface {
+	// ArrayDelimiter returns the delimiter character(s) for this element's type.
+	ArrayDelimiter() string
+}
+
+// BoolArray represents a one-dimensional array of the PostgreSQL boolean type.
+type BoolArray []bool
+
+// Scan implements the sql.Scanner interface.
+func (a *BoolArray) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return a.scanBytes(src)
+	case string:
+		return a.scanBytes([]byte(src))
+	case nil:
+		*a = nil
+		return nil
+	}
+
+	return fmt.Errorf("pq: cannot convert %T to BoolArray", src)
+}
+
+func (a *BoolArray) scanBytes(src []byte) error {
+	elems, err := scanLinearArray(src, []byte{','}, "BoolArray")
+	if err != nil {
+		return err
+	}
+	if *a != nil && len(elems) == 0 {
+		*a = (*a)[:0]
+	} else {
+		b := make(BoolArray, len(elems))
+		for i, v := range elems {
+			if len(v) != 1 {
+				return fmt.Errorf("pq: could not parse boolean array index %d: invalid boolean %q", i, v)
+			}
+			switch v[0] {
+			case 't':
+				b[i] = true
+			case 'f':
+				b[i] = false
+			default:
+				return fmt.Errorf("pq: could not parse boolean array index %d: invalid boolean %q", i, v)
+			}
+		}
+		*a = b
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (a BoolArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	if n := len(a); n > 0 {
+		// There will be exactly two curly brackets, N bytes of values,
+		// and N-1 bytes of delimiters.
+		b := make([]byte, 1+2*n)
+
+		for i := 0; i < n; i++ {
+			b[2*i] = ','
+			if a[i] {
+				b[1+2*i] = 't'
+			} else {
+				b[1+2*i] = 'f'
+			}
+		}
+
+		b[0] = '{'
+		b[2*n] = '}'
+
+		return string(b), nil
+	}
+
+	return "{}", nil
+}
+
+// ByteaArray represents a one-dimensional array of the PostgreSQL bytea type.
+type ByteaArray [][]byte
+
+// Scan implements the sql.Scanner interface.
+func (a *ByteaArray) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return a.scanBytes(src)
+	case string:
+		return a.scanBytes([]byte(src))
+	case nil:
+		*a = nil
+		return nil
+	}
+
+	return fmt.Errorf("pq: cannot convert %T to ByteaArray", src)
+}
+
+func (a *ByteaArray) scanBytes(src []byte) error {
+	elems, err := scanLinearArray(src, []byte{','}, "ByteaArray")
+	if err != nil {
+		return err
+	}
+	if *a != nil && len(elems) == 0 {
+		*a = (*a)[:0]
+	} else {
+		b := make(ByteaArray, len(elems))
+		for i, v := range elems {
+			if v == nil {
+				continue
+			}
+			b[i], err = parseBytea(v)
+			if err != nil {
+				return fmt.Errorf("pq: could not parse bytea array index %d: %s", i, err.Error())
+			}
+		}
+		*a = b
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface.  It uses the "hex" format
+// which is only supported on PostgreSQL 9.0 or newer.
+func (a ByteaArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	if n := len(a); n > 0 {
+		// There will be at least two curly brackets, 2*N bytes of quotes,
+		// 3*N bytes of hex formatting, and N-1 bytes of delimiters.
+		size := 1 + 6*n
+		for _, x := range a {
+			size += hex.EncodedLen(len(x))
+		}
+
+		b := make([]byte, size)
+
+		for i, s := 0, b; i < n; i++ {
+			o := copy(s, `,"\\x`)
+			o += hex.Encode(s[o:], a[i])
+			s[o] = '"'
+			s = s[o+1:]
+		}
+
+		b[0] = '{'
+		b[size-1] = '}'
+
+		return string(b), nil
+	}
+
+	return "{}", nil
+}
+
+// Float64Array represents a one-dimensional array of the PostgreSQL double
+// precision type.
+type Float64Array []float64
+
+// Scan implements the sql.Scanner interface.
+func (a *Float64Array) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return a.scanBytes(src)
+	case string:
+		return a.scanBytes([]byte(src))
+	case nil:
+		*a = nil
+		return nil
+	}
+
+	return fmt.Errorf("pq: cannot convert %T to Float64Array", src)
+}
+
+func (a *Float64Array) scanBytes(src []byte) error {
+	elems, err := scanLinearArray(src, []byte{','}, "Float64Array")
+	if err != nil {
+		return err
+	}
+	if *a != nil && len(elems) == 0 {
+		*a = (*a)[:0]
+	} else {
+		b := make(Float64Array, len(elems))
+		for i, v := range elems {
+			if b[i], err = strconv.ParseFloat(string(v), 64); err != nil {
+				return fmt.Errorf("pq: parsing array element index %d: %v", i, err)
+			}
+		}
+		*a = b
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (a Float64Array) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	if n := len(a); n > 0 {
+		// There will be at least two curly brackets, N bytes of values,
+		// and N-1 bytes of delimiters.
+		b := make([]byte, 1, 1+2*n)
+		b[0] = '{'
+
+		b = strconv.AppendFloat(b, a[0], 'f', -1, 64)
+		for i := 1; i < n; i++ {
+			b = append(b, ',')
+			b = strconv.AppendFloat(b, a[i], 'f', -1, 64)
+		}
+
+		return string(append(b, '}')), nil
+	}
+
+	return "{}", nil
+}
+
+// Int64Array represents a one-dimensional array of the PostgreSQL integer types.
+type Int64Array []int64
+
+// Scan implements the sql.Scanner interface.
+func (a *Int64Array) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return a.scanBytes(src)
+	case string:
+		return a.scanBytes([]byte(src))
+	case nil:
+		*a = nil
+		return nil
+	}
+
+	return fmt.Errorf("pq: cannot convert %T to Int64Array", src)
+}
+
+func (a *Int64Array) scanBytes(src []byte) error {
+	elems, err := scanLinearArray(src, []byte{','}, "Int64Array")
+	if err != nil {
+		return err
+	}
+	if *a != nil && len(elems) == 0 {
+		*a = (*a)[:0]
+	} else {
+		b := make(Int64Array, len(elems))
+		for i, v := range elems {
+			if b[i], err = strconv.ParseInt(string(v), 10, 64); err != nil {
+				return fmt.Errorf("pq: parsing array element index %d: %v", i, err)
+			}
+		}
+		*a = b
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (a Int64Array) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	if n := len(a); n > 0 {
+		// There will be at least two curly brackets, N bytes of values,
+		// and N-1 bytes of delimiters.
+		b := make([]byte, 1, 1+2*n)
+		b[0] = '{'
+
+		b = strconv.AppendInt(b, a[0], 10)
+		for i := 1; i < n; i++ {
+			b = append(b, ',')
+			b = strconv.AppendInt(b, a[i], 10)
+		}
+
+		return string(append(b, '}')), nil
+	}
+
+	return "{}", nil
+}
+
+// StringArray represents a one-dimensional array of the PostgreSQL character types.
+type StringArray []string
+
+// Scan implements the sql.Scanner interface.
+func (a *StringArray) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return a.scanBytes(src)
+	case string:
+		return a.scanBytes([]byte(src))
+	case nil:
+		*a = nil
+		return nil
+	}
+
+	return fmt.Errorf("pq: cannot convert %T to StringArray", src)
+}
+
+func (a *StringArray) scanBytes(src []byte) error {
+	elems, err := scanLinearArray(src, []byte{','}, "StringArray")
+	if err != nil {
+		return err
+	}
+	if *a != nil && len(elems) == 0 {
+		*a = (*a)[:0]
+	} else {
+		b := make(StringArray, len(elems))
+		for i, v := range elems {
+			if v == nil {
+				return fmt.Errorf("pq: parsing array element index %d: cannot convert nil to string", i)
+			}
+			b[i] = string(v)
+		}
+		*a = b
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (a StringArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	if n := len(a); n > 0 {
+		// There will be at least two curly brackets, 2*N bytes of quotes,
+		// and N-1 bytes of delimiters.
+		b := make([]byte, 1, 1+3*n)
+		b[0] = '{'
+
+		b = appendArrayQuotedBytes(b, []byte(a[0]))
+		for i := 1; i < n; i++ {
+			b = append(b, ',')
+			b = appendArrayQuotedBytes(b, []byte(a[i]))
+		}
+
+		return string(append(b, '}')), nil
+	}
+
+	return "{}", nil
+}
+
+// GenericArray implements the driver.Valuer and sql.Scanner interfaces for
+// an array or slice of any dimension.  Elements are scanned through their
+// sql.Scanner implementation if they have one; otherwise booleans, numbers,
+// strings, byte slices and pointers to any of those are supported.
+type GenericArray struct{ A interface{} }
+
+// arrayAssigner stores the text representation of an array element, or nil
+// for NULL, in dest.
+type arrayAssigner func(src []byte, dest reflect.Value) error
+
+func (GenericArray) evaluateDestination(rt reflect.Type) (arrayAssigner, string) {
+	del := ","
+	if ad, ok := reflect.Zero(rt).Interface().(ArrayDelimiter); ok {
+		del = ad.ArrayDelimiter()
+	}
+	return arrayElementAssigner(rt), del
+}
+
+func arrayElementAssigner(rt reflect.Type) arrayAssigner {
+	if reflect.PtrTo(rt).Implements(typeSQLScanner) {
+		// dest is always addressable because it is an element of a slice.
+		return func(src []byte, dest reflect.Value) (err error) {
+			ss := dest.Addr().Interface().(sql.Scanner)
+			if src == nil {
+				err = ss.Scan(nil)
+			} else {
+				err = ss.Scan(src)
+			}
+			return
+		}
+	}
+
+	var parse func(src []byte, dest reflect.Value) error
+	switch rt.Kind() {
+	case reflect.Ptr:
+		elem := arrayElementAssigner(rt.Elem())
+		return func(src []byte, dest reflect.Value) error {
+			if src == nil {
+				dest.Set(reflect.Zero(rt))
+				return nil
+			}
+			v := reflect.New(rt.Elem())
+			if err := elem(src, v.Elem()); err != nil {
+				return err
+			}
+			dest.Set(v)
+			return nil
+		}
+	case reflect.Bool:
+		parse = func(src []byte, dest reflect.Value) error {
+			if len(src) != 1 || (src[0] != 't' && src[0] != 'f') {
+				return fmt.Errorf("invalid boolean %q", src)
+			}
+			dest.SetBool(src[0] == 't')
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parse = func(src []byte, dest reflect.Value) error {
+			i, err := strconv.ParseInt(string(src), 10, rt.Bits())
+			dest.SetInt(i)
+			return err
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parse = func(src []byte, dest reflect.Value) error {
+			u, err := strconv.ParseUint(string(src), 10, rt.Bits())
+			dest.SetUint(u)
+			return err
+		}
+	case reflect.Float32, reflect.Float64:
+		parse = func(src []byte, dest reflect.Value) error {
+			f, err := strconv.ParseFloat(string(src), rt.Bits())
+			dest.SetFloat(f)
+			return err
+		}
+	case reflect.String:
+		parse = func(src []byte, dest reflect.Value) error {
+			dest.SetString(string(src))
+			return nil
+		}
+	case reflect.Slice:
+		if rt.Elem().Kind() == reflect.Uint8 {
+			// A nil []byte represents NULL, just like in database/sql.
+			return func(src []byte, dest reflect.Value) error {
+				if src == nil {
+					dest.SetBytes(nil)
+				} else {
+					dest.SetBytes(append([]byte{}, src...))
+				}
+				return nil
+			}
+		}
+	}
+	if parse == nil {
+		return func([]byte, reflect.Value) error {
+			return fmt.Errorf("pq: scanning to %s is not implemented", rt)
+		}
+	}
+
+	return func(src []byte, dest reflect.Value) error {
+		if src == nil {
+			return fmt.Errorf("cannot convert NULL to %s", rt)
+		}
+		return parse(src, dest)
+	}
+}
+
+// Scan implements the sql.Scanner interface.
+func (a GenericArray) Scan(src interface{}) error {
+	dpv := reflect.ValueOf(a.A)
+	switch {
+	case dpv.Kind() != reflect.Ptr:
+		return fmt.Errorf("pq: destination %T is not a pointer to array or slice", a.A)
+	case dpv.IsNil():
+		return fmt.Errorf("pq: destination %T is nil", a.A)
+	}
+
+	dv := dpv.Elem()
+	switch dv.Kind() {
+	case reflect.Slice:
+	case reflect.Array:
+	default:
+		return fmt.Errorf("pq: destination %T is not a pointer to array or slice", a.A)
+	}
+
+	switch src := src.(type) {
+	case []byte:
+		return a.scanBytes(src, dv)
+	case string:
+		return a.scanBytes([]byte(src), dv)
+	case nil:
+		if dv.Kind() == reflect.Slice {
+			dv.Set(reflect.Zero(dv.Type()))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("pq: cannot convert %T to %s", src, dv.Type())
+}
+
+func (a GenericArray) scanBytes(src []byte, dv reflect.Value) error {
+	// Find the element type by descending into the destination until we
+	// reach something which is not an array or slice (or is a []byte, or
+	// implements sql.Scanner).
+	var levels int
+	rt := dv.Type()
+	for levels == 0 || isArrayContainer(rt) {
+		rt = rt.Elem()
+		levels++
+	}
+	assign, del := a.evaluateDestination(rt)
+
+	dims, elems, err := parseArray(src, []byte(del))
+	if err != nil {
+		return err
+	}
+
+	// Treat a zero-dimensional array like an array with a single dimension
+	// of zero.
+	if len(dims) == 0 {
+		dims = []int{0}
+	}
+	if len(dims) != levels && !(len(elems) == 0 && levels > 0) {
+		return fmt.Errorf("pq: cannot convert ARRAY%s to %s", formatArrayDims(dims), dv.Type())
+	}
+	if len(elems) == 0 {
+		dims = dims[:1]
+	}
+
+	return assignArray(dv, dims, elems, assign)
+}
+
+// isArrayContainer reports whether values of type rt should be treated as an
+// additional dimension of an array rather than as an element.
+func isArrayContainer(rt reflect.Type) bool {
+	switch rt.Kind() {
+	case reflect.Slice, reflect.Array:
+		return rt != typeByteSlice && !reflect.PtrTo(rt).Implements(typeSQLScanner)
+	}
+	return false
+}
+
+// assignArray stores the elements of an array with dimensions dims into dv.
+func assignArray(dv reflect.Value, dims []int, elems [][]byte, assign arrayAssigner) error {
+	n := dims[0]
+	switch dv.Kind() {
+	case reflect.Slice:
+		dv.Set(reflect.MakeSlice(dv.Type(), n, n))
+	case reflect.Array:
+		if dv.Len() != n {
+			return fmt.Errorf("pq: cannot convert ARRAY%s to %s", formatArrayDims(dims), dv.Type())
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+
+	stride := len(elems) / n
+	for i := 0; i < n; i++ {
+		sub := elems[i*stride : (i+1)*stride]
+		if len(dims) > 1 {
+			if err := assignArray(dv.Index(i), dims[1:], sub, assign); err != nil {
+				return err
+			}
+		} else if err := assign(sub[0], dv.Index(i)); err != nil {
+			return fmt.Errorf("pq: parsing array element index %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (a GenericArray) Value() (driver.Value, error) {
+	if a.A == nil {
+		return nil, nil
+	}
+
+	rv := reflect.ValueOf(a.A)
+
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return nil, nil
+		}
+	case reflect.Array:
+	default:
+		return nil, fmt.Errorf("pq: Unable to convert %T to array", a.A)
+	}
+
+	if n := rv.Len(); n > 0 {
+		// There will be at least two curly brackets, N bytes of values,
+		// and N-1 bytes of delimiters.
+		b := make([]byte, 0, 1+2*n)
+
+		b, _, err := appendArray(b, rv, n)
+		return string(b), err
+	}
+
+	return "{}", nil
+}
+
+func appendArray(b []byte, rv reflect.Value, n int) ([]byte, string, error) {
+	var del string
+	var err error
+
+	b = append(b, '{')
+
+	if b, del, err = appendArrayElement(b, rv.Index(0)); err != nil {
+		return b, del, err
+	}
+
+	for i := 1; i < n; i++ {
+		b = append(b, del...)
+		if b, del, err = appendArrayElement(b, rv.Index(i)); err != nil {
+			return b, del, err
+		}
+	}
+
+	return append(b, '}'), del, nil
+}
+
+func appendArrayElement(b []byte, rv reflect.Value) (_ []byte, del string, err error) {
+	if k := rv.Kind(); k == reflect.Array || k == reflect.Slice {
+		if t := rv.Type(); t != typeByteSlice && !t.Implements(typeDriverValuer) {
+			if n := rv.Len(); n > 0 {
+				return appendArray(b, rv, n)
+			}
+
+			return b, "", nil
+		}
+	}
+
+	del = ","
+	var iv interface{} = rv.Interface()
+
+	if ad, ok := iv.(ArrayDelimiter); ok {
+		del = ad.ArrayDelimiter()
+	}
+
+	if iv, err = driver.DefaultParameterConverter.ConvertValue(iv); err != nil {
+		return b, del, err
+	}
+
+	switch v := iv.(type) {
+	case nil:
+		return append(b, "NULL"...), del, nil
+	case []byte:
+		if v == nil {
+			return append(b, "NULL"...), del, nil
+		}
+		return appendArrayQuotedBytes(b, v), del, nil
+	case string:
+		return appendArrayQuotedBytes(b, []byte(v)), del, nil
+	}
+
+	defer errRecoverNoErrBadConn(&err)
+	return appendEncodedText(&parameterStatus{}, b, iv), del, nil
+}
+
+func appendArrayQuotedBytes(b, v []byte) []byte {
+	b = append(b, '"')
+	for {
+		i := bytes.IndexAny(v, `"\`)
+		if i < 0 {
+			b = append(b, v...)
+			break
+		}
+		if i > 0 {
+			b = append(b, v[:i]...)
+		}
+		b = append(b, '\\', v[i])
+		v = v[i+1:]
+	}
+	return append(b, '"')
+}
+
+func formatArrayDims(dims []int) string {
+	return strings.Replace(fmt.Sprint(dims), " ", "][", -1)
+}
+
+// parseArray extracts the dimensions and elements of an array represented in
+// text format.  Elements are returned in row-major order; NULL elements are
+// returned as nil.  Only representations emitted by the backend are
+// supported.  Notably, whitespace around brackets and delimiters is
+// significant, and NULL is case-sensitive.  A zero-dimensional (empty) array
+// has no dimensions and no elements.
+//
+// See http://www.postgresql.org/docs/current/static/arrays.html#ARRAYS-IO
+func parseArray(src, del []byte) (dims []int, elems [][]byte, err error) {
+	p := arrayParser{src: src, del: del, leafDepth: -1}
+
+	bounds, err := p.parseDimensionDecoration()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = p.parseLevel(0); err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(src) {
+		return nil, nil, p.unexpected()
+	}
+	if bounds != nil && !equalDims(bounds, p.dims) {
+		return nil, nil, fmt.Errorf("pq: unable to parse array; dimensions %v do not match the array contents", bounds)
+	}
+	if len(p.elems) == 0 {
+		return nil, p.elems, nil
+	}
+	return p.dims, p.elems, nil
+}
+
+type arrayParser struct {
+	src []byte
+	del []byte
+	pos int
+
+	dims      []int
+	elems     [][]byte
+	leafDepth int
+}
+
+func (p *arrayParser) unexpected() error {
+	if p.pos >= len(p.src) {
+		return fmt.Errorf("pq: unable to parse array; unexpected end of input")
+	}
+	return fmt.Errorf("pq: unable to parse array; unexpected %q at offset %d", p.src[p.pos], p.pos)
+}
+
+func (p *arrayParser) peek() (byte, bool) {
+	if p.pos >= len(p.src) {
+		return 0, false
+	}
+	return p.src[p.pos], true
+}
+
+// parseDimensionDecoration parses the optional "[lower:upper]...=" prefix the
+// server adds to arrays whose lower bounds are not one, and returns the
+// lengths of the dimensions described in it.
+func (p *arrayParser) parseDimensionDecoration() ([]int, error) {
+	var lengths []int
+	for {
+		if c, _ := p.peek(); c != '[' {
+			break
+		}
+		end := bytes.IndexByte(p.src[p.pos:], ']')
+		if end < 0 {
+			return nil, p.unexpected()
+		}
+		bounds := strings.SplitN(string(p.src[p.pos+1:p.pos+end]), ":", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("pq: unable to parse array; invalid dimensions %q", p.src[p.pos:p.pos+end+1])
+		}
+		lower, err1 := strconv.Atoi(bounds[0])
+		upper, err2 := strconv.Atoi(bounds[1])
+		if err1 != nil || err2 != nil || upper < lower {
+			return nil, fmt.Errorf("pq: unable to parse array; invalid dimensions %q", p.src[p.pos:p.pos+end+1])
+		}
+		lengths = append(lengths, upper-lower+1)
+		p.pos += end + 1
+	}
+	if lengths != nil {
+		if c, _ := p.peek(); c != '=' {
+			return nil, p.unexpected()
+		}
+		p.pos++
+	}
+	return lengths, nil
+}
+
+// parseLevel parses a brace-enclosed list of elements or sub-arrays at the
+// given nesting depth.
+func (p *arrayParser) parseLevel(depth int) error {
+	if c, ok := p.peek(); !ok || c != '{' {
+		if !ok {
+			return p.unexpected()
+		}
+		return fmt.Errorf("pq: unable to parse array; expected %q at offset %d", '{', p.pos)
+	}
+	p.pos++
+
+	if c, _ := p.peek(); c == '}' {
+		if depth > 0 {
+			return fmt.Errorf("pq: unable to parse array; unexpected empty sub-array at offset %d", p.pos)
+		}
+		p.pos++
+		return nil
+	}
+
+	n := 0
+	for {
+		c, ok := p.peek()
+		if !ok {
+			return p.unexpected()
+		}
+		if c == '{' {
+			if p.leafDepth >= 0 && depth >= p.leafDepth {
+				return fmt.Errorf("pq: multidimensional arrays must have elements with matching dimensions")
+			}
+			if err := p.parseLevel(depth + 1); err != nil {
+				return err
+			}
+		} else {
+			if p.leafDepth < 0 {
+				p.leafDepth = depth
+			} else if p.leafDepth != depth {
+				return fmt.Errorf("pq: multidimensional arrays must have elements with matching dimensions")
+			}
+			elem, err := p.parseElement()
+			if err != nil {
+				return err
+			}
+			p.elems = append(p.elems, elem)
+		}
+		n++
+
+		if bytes.HasPrefix(p.src[p.pos:], p.del) {
+			p.pos += len(p.del)
+			continue
+		}
+		if c, _ := p.peek(); c == '}' {
+			p.pos++
+			return p.setDim(depth, n)
+		}
+		return p.unexpected()
+	}
+}
+
+func (p *arrayParser) setDim(depth, n int) error {
+	for len(p.dims) <= depth {
+		p.dims = append(p.dims, -1)
+	}
+	if p.dims[depth] == -1 {
+		p.dims[depth] = n
+	} else if p.dims[depth] != n {
+		return fmt.Errorf("pq: multidimensional arrays must have elements with matching dimensions")
+	}
+	return nil
+}
+
+// parseElement parses a single, possibly quoted, array element.
+func (p *arrayParser) parseElement() ([]byte, error) {
+	if c, _ := p.peek(); c == '"' {
+		elem := []byte{}
+		for p.pos++; p.pos < len(p.src); p.pos++ {
+			switch c := p.src[p.pos]; c {
+			case '\\':
+				p.pos++
+				if p.pos >= len(p.src) {
+					return nil, p.unexpected()
+				}
+				elem = append(elem, p.src[p.pos])
+			case '"':
+				p.pos++
+				return elem, nil
+			default:
+				elem = append(elem, c)
+			}
+		}
+		return nil, p.unexpected()
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] != '}' && !bytes.HasPrefix(p.src[p.pos:], p.del) {
+		if p.src[p.pos] == '{' || p.src[p.pos] == '"' {
+			return nil, p.unexpected()
+		}
+		p.pos++
+	}
+	elem := p.src[start:p.pos]
+	if len(elem) == 0 {
+		return nil, p.unexpected()
+	}
+	if bytes.Equal(elem, []byte("NULL")) {
+		return nil, nil
+	}
+	return elem, nil
+}
+
+func equalDims(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func scanLinearArray(src, del []byte, typ string) (elems [][]byte, err error) {
+	dims, elems, err := parseArray(src, del)
+	if err != nil {
+		return nil, err
+	}
+	if len(dims) > 1 {
+		return nil, fmt.Errorf("pq: cannot convert ARRAY%s to %s", formatArrayDims(dims), typ)
+	}
+	return elems, err
+}
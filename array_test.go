@@ -0,0 +1,750 @@
+package pq
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseArray(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		delim string
+		dims  []int
+		elems [][]byte
+	}{
+		{`{}`, `,`, nil, nil},
+		{`{NULL}`, `,`, []int{1}, [][]byte{nil}},
+		{`{a}`, `,`, []int{1}, [][]byte{{'a'}}},
+		{`{a,b}`, `,`, []int{2}, [][]byte{{'a'}, {'b'}}},
+		{`{{a,b}}`, `,`, []int{1, 2}, [][]byte{{'a'}, {'b'}}},
+		{`{{a},{b}}`, `,`, []int{2, 1}, [][]byte{{'a'}, {'b'}}},
+		{`{{{a,b},{c,d},{e,f}}}`, `,`, []int{1, 3, 2}, [][]byte{
+			{'a'}, {'b'}, {'c'}, {'d'}, {'e'}, {'f'},
+		}},
+		{`{""}`, `,`, []int{1}, [][]byte{{}}},
+		{`{","}`, `,`, []int{1}, [][]byte{{','}}},
+		{`{",",","}`, `,`, []int{2}, [][]byte{{','}, {','}}},
+		{`{{",",","}}`, `,`, []int{1, 2}, [][]byte{{','}, {','}}},
+		{`{{","},{","}}`, `,`, []int{2, 1}, [][]byte{{','}, {','}}},
+		{`{{{",",","},{",",","},{",",","}}}`, `,`, []int{1, 3, 2}, [][]byte{
+			{','}, {','}, {','}, {','}, {','}, {','},
+		}},
+		{`{"\"}"}`, `,`, []int{1}, [][]byte{{'"', '}'}}},
+		{`{"\\"}`, `,`, []int{1}, [][]byte{{'\\'}}},
+		{`{"NULL"}`, `,`, []int{1}, [][]byte{[]byte("NULL")}},
+		{`{a b}`, `,`, []int{1}, [][]byte{[]byte("a b")}},
+		{`{a;b}`, `;`, []int{2}, [][]byte{{'a'}, {'b'}}},
+		{`{{a;b};{c;d}}`, `;`, []int{2, 2}, [][]byte{{'a'}, {'b'}, {'c'}, {'d'}}},
+		{`{(1,2),(3,4);(5,6),(7,8)}`, `;`, []int{2}, [][]byte{
+			[]byte("(1,2),(3,4)"), []byte("(5,6),(7,8)"),
+		}},
+		{`[0:1]={a,b}`, `,`, []int{2}, [][]byte{{'a'}, {'b'}}},
+		{`[1:1][-2:-1]={{a,b}}`, `,`, []int{1, 2}, [][]byte{{'a'}, {'b'}}},
+	} {
+		dims, elems, err := parseArray([]byte(tt.input), []byte(tt.delim))
+
+		if err != nil {
+			t.Fatalf("Expected no error for %q, got %q", tt.input, err)
+		}
+		if !reflect.DeepEqual(dims, tt.dims) {
+			t.Errorf("Expected %v dimensions for %q, got %v", tt.dims, tt.input, dims)
+		}
+		if !reflect.DeepEqual(elems, tt.elems) {
+			t.Errorf("Expected %v elements for %q, got %v", tt.elems, tt.input, elems)
+		}
+	}
+}
+
+func TestParseArrayError(t *testing.T) {
+	for _, tt := range []struct {
+		input, err string
+	}{
+		{``, "unexpected end of input"},
+		{`{`, "unexpected end of input"},
+		{`{{a},{b}`, "unexpected end of input"},
+		{`{"a`, "unexpected end of input"},
+		{`{"a\`, "unexpected end of input"},
+		{`x`, "expected '{' at offset 0"},
+		{`{,}`, "unexpected ',' at offset 1"},
+		{`{a,}`, "unexpected '}' at offset 3"},
+		{`{a"b"}`, `unexpected '"' at offset 2`},
+		{`{"a"b}`, "unexpected 'b' at offset 4"},
+		{`{a}x`, "unexpected 'x' at offset 3"},
+		{`{{a},b}`, "matching dimensions"},
+		{`{a,{b}}`, "matching dimensions"},
+		{`{{a},{b,c}}`, "matching dimensions"},
+		{`{{a,b},{c}}`, "matching dimensions"},
+		{`{{}}`, "unexpected empty sub-array"},
+		{`[1:2]`, "unexpected end of input"},
+		{`[1]={a}`, "invalid dimensions"},
+		{`[2:1]={a}`, "invalid dimensions"},
+		{`[1:3]={a,b}`, "do not match the array contents"},
+	} {
+		_, _, err := parseArray([]byte(tt.input), []byte{','})
+
+		if err == nil {
+			t.Fatalf("Expected error for %q, got none", tt.input)
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected error to contain %q for %q, got %q", tt.err, tt.input, err)
+		}
+	}
+}
+
+func TestArrayScanner(t *testing.T) {
+	var s sql.Scanner = Array(&[]bool{})
+	if _, ok := s.(*BoolArray); !ok {
+		t.Errorf("Expected *BoolArray, got %T", s)
+	}
+
+	s = Array(&[]float64{})
+	if _, ok := s.(*Float64Array); !ok {
+		t.Errorf("Expected *Float64Array, got %T", s)
+	}
+
+	s = Array(&[]int64{})
+	if _, ok := s.(*Int64Array); !ok {
+		t.Errorf("Expected *Int64Array, got %T", s)
+	}
+
+	s = Array(&[]string{})
+	if _, ok := s.(*StringArray); !ok {
+		t.Errorf("Expected *StringArray, got %T", s)
+	}
+
+	s = Array(&[][]byte{})
+	if _, ok := s.(*ByteaArray); !ok {
+		t.Errorf("Expected *ByteaArray, got %T", s)
+	}
+
+	for _, tt := range []interface{}{
+		&[]sql.Scanner{},
+		&[][]bool{},
+		&[]int32{},
+	} {
+		s = Array(tt)
+		if _, ok := s.(GenericArray); !ok {
+			t.Errorf("Expected GenericArray for %T, got %T", tt, s)
+		}
+	}
+}
+
+func TestArrayValuer(t *testing.T) {
+	var v driver.Valuer = Array([]bool{})
+	if _, ok := v.(*BoolArray); !ok {
+		t.Errorf("Expected *BoolArray, got %T", v)
+	}
+
+	v = Array([]float64{})
+	if _, ok := v.(*Float64Array); !ok {
+		t.Errorf("Expected *Float64Array, got %T", v)
+	}
+
+	v = Array([]int64{})
+	if _, ok := v.(*Int64Array); !ok {
+		t.Errorf("Expected *Int64Array, got %T", v)
+	}
+
+	v = Array([]string{})
+	if _, ok := v.(*StringArray); !ok {
+		t.Errorf("Expected *StringArray, got %T", v)
+	}
+
+	v = Array([][]byte{})
+	if _, ok := v.(*ByteaArray); !ok {
+		t.Errorf("Expected *ByteaArray, got %T", v)
+	}
+
+	for _, tt := range []interface{}{
+		nil,
+		[]driver.Value{},
+		[][]int{},
+		[]int32{},
+	} {
+		v = Array(tt)
+		if _, ok := v.(GenericArray); !ok {
+			t.Errorf("Expected GenericArray for %T, got %T", tt, v)
+		}
+	}
+}
+
+func TestBoolArrayScan(t *testing.T) {
+	for _, tt := range []struct {
+		str string
+		arr BoolArray
+	}{
+		{`{}`, BoolArray{}},
+		{`{t}`, BoolArray{true}},
+		{`{f,t}`, BoolArray{false, true}},
+	} {
+		bytes := []byte(tt.str)
+		arr := BoolArray{true, true, true}
+		err := arr.Scan(bytes)
+
+		if err != nil {
+			t.Fatalf("Expected no error for %q, got %v", bytes, err)
+		}
+		if !reflect.DeepEqual(arr, tt.arr) {
+			t.Errorf("Expected %+v for %q, got %+v", tt.arr, bytes, arr)
+		}
+	}
+
+	var arr BoolArray = BoolArray{true}
+	if err := arr.Scan(nil); err != nil || arr != nil {
+		t.Errorf("Expected nil array and no error when scanning NULL, got %v and %v", arr, err)
+	}
+}
+
+func TestBoolArrayScanError(t *testing.T) {
+	for _, tt := range []struct {
+		input interface{}
+		err   string
+	}{
+		{1, "cannot convert int to BoolArray"},
+		{`{`, "unable to parse array"},
+		{`{{t},{f}}`, "cannot convert ARRAY[2][1] to BoolArray"},
+		{`{NULL}`, `could not parse boolean array index 0: invalid boolean ""`},
+		{`{a}`, `could not parse boolean array index 0: invalid boolean "a"`},
+		{`{t,true}`, `could not parse boolean array index 1: invalid boolean "true"`},
+	} {
+		arr := BoolArray{true, true, true}
+		err := arr.Scan(tt.input)
+
+		if err == nil {
+			t.Fatalf("Expected error for %q, got none", tt.input)
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected error to contain %q for %q, got %q", tt.err, tt.input, err)
+		}
+		if !reflect.DeepEqual(arr, BoolArray{true, true, true}) {
+			t.Errorf("Expected destination not to change for %q, got %+v", tt.input, arr)
+		}
+	}
+}
+
+func TestBoolArrayValue(t *testing.T) {
+	result, err := BoolArray(nil).Value()
+	if err != nil || result != nil {
+		t.Errorf("Expected nil and no error for nil array, got %q and %v", result, err)
+	}
+
+	for _, tt := range []struct {
+		arr  BoolArray
+		want string
+	}{
+		{BoolArray{}, `{}`},
+		{BoolArray{false}, `{f}`},
+		{BoolArray{false, true, false}, `{f,t,f}`},
+	} {
+		result, err := tt.arr.Value()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if result != tt.want {
+			t.Errorf("Expected %q for %v, got %q", tt.want, tt.arr, result)
+		}
+	}
+}
+
+func TestByteaArrayScan(t *testing.T) {
+	for _, tt := range []struct {
+		str string
+		arr ByteaArray
+	}{
+		{`{}`, ByteaArray{}},
+		{`{NULL}`, ByteaArray{nil}},
+		{`{"\\xfeff"}`, ByteaArray{{'\xFE', '\xFF'}}},
+		{`{"\\xdead","\\xbeef"}`, ByteaArray{{'\xDE', '\xAD'}, {'\xBE', '\xEF'}}},
+		{`{"\\\\001\\003"}`, ByteaArray{{'\\', '0', '0', '1', '\x03'}}},
+	} {
+		arr := ByteaArray{{2}, {6}, {0, 0}}
+		err := arr.Scan(tt.str)
+
+		if err != nil {
+			t.Fatalf("Expected no error for %q, got %v", tt.str, err)
+		}
+		if !reflect.DeepEqual(arr, tt.arr) {
+			t.Errorf("Expected %+v for %q, got %+v", tt.arr, tt.str, arr)
+		}
+	}
+}
+
+func TestByteaArrayScanError(t *testing.T) {
+	for _, tt := range []struct {
+		input interface{}
+		err   string
+	}{
+		{1, "cannot convert int to ByteaArray"},
+		{`{"\\xabc"}`, "could not parse bytea array index 0"},
+		{`{{"\\xab"},{"\\xcd"}}`, "cannot convert ARRAY[2][1] to ByteaArray"},
+	} {
+		arr := ByteaArray{{2}, {6}, {0, 0}}
+		err := arr.Scan(tt.input)
+
+		if err == nil {
+			t.Fatalf("Expected error for %q, got none", tt.input)
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected error to contain %q for %q, got %q", tt.err, tt.input, err)
+		}
+	}
+}
+
+func TestByteaArrayValue(t *testing.T) {
+	result, err := ByteaArray(nil).Value()
+	if err != nil || result != nil {
+		t.Errorf("Expected nil and no error for nil array, got %q and %v", result, err)
+	}
+
+	for _, tt := range []struct {
+		arr  ByteaArray
+		want string
+	}{
+		{ByteaArray{}, `{}`},
+		{ByteaArray{{}}, `{"\\x"}`},
+		{ByteaArray{{'\xDE', '\xAD', '\xBE', '\xEF'}, {'\xFE', '\xFF'}}, `{"\\xdeadbeef","\\xfeff"}`},
+	} {
+		result, err := tt.arr.Value()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if result != tt.want {
+			t.Errorf("Expected %q for %v, got %q", tt.want, tt.arr, result)
+		}
+	}
+}
+
+func TestFloat64ArrayScan(t *testing.T) {
+	for _, tt := range []struct {
+		str string
+		arr Float64Array
+	}{
+		{`{}`, Float64Array{}},
+		{`{1.2}`, Float64Array{1.2}},
+		{`{3.456,7.89}`, Float64Array{3.456, 7.89}},
+		{`{-1e+10,Infinity}`, Float64Array{-1e10, math.Inf(1)}},
+	} {
+		arr := Float64Array{5, 5, 5}
+		err := arr.Scan([]byte(tt.str))
+
+		if err != nil {
+			t.Fatalf("Expected no error for %q, got %v", tt.str, err)
+		}
+		if !reflect.DeepEqual(arr, tt.arr) {
+			t.Errorf("Expected %+v for %q, got %+v", tt.arr, tt.str, arr)
+		}
+	}
+}
+
+func TestFloat64ArrayScanError(t *testing.T) {
+	for _, tt := range []struct {
+		input interface{}
+		err   string
+	}{
+		{true, "cannot convert bool to Float64Array"},
+		{`{{1.2},{3.4}}`, "cannot convert ARRAY[2][1] to Float64Array"},
+		{`{NULL}`, "parsing array element index 0:"},
+		{`{1.2,x}`, "parsing array element index 1:"},
+	} {
+		arr := Float64Array{5, 5, 5}
+		err := arr.Scan(tt.input)
+
+		if err == nil {
+			t.Fatalf("Expected error for %q, got none", tt.input)
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected error to contain %q for %q, got %q", tt.err, tt.input, err)
+		}
+	}
+}
+
+func TestFloat64ArrayValue(t *testing.T) {
+	for _, tt := range []struct {
+		arr  Float64Array
+		want string
+	}{
+		{Float64Array{}, `{}`},
+		{Float64Array{1.2}, `{1.2}`},
+		{Float64Array{1.2, -3.4, 5000000}, `{1.2,-3.4,5000000}`},
+	} {
+		result, err := tt.arr.Value()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if result != tt.want {
+			t.Errorf("Expected %q for %v, got %q", tt.want, tt.arr, result)
+		}
+	}
+}
+
+func TestInt64ArrayScan(t *testing.T) {
+	for _, tt := range []struct {
+		str string
+		arr Int64Array
+	}{
+		{`{}`, Int64Array{}},
+		{`{12}`, Int64Array{12}},
+		{`{345,-678}`, Int64Array{345, -678}},
+		{`[0:1]={1,2}`, Int64Array{1, 2}},
+	} {
+		arr := Int64Array{5, 5, 5}
+		err := arr.Scan(tt.str)
+
+		if err != nil {
+			t.Fatalf("Expected no error for %q, got %v", tt.str, err)
+		}
+		if !reflect.DeepEqual(arr, tt.arr) {
+			t.Errorf("Expected %+v for %q, got %+v", tt.arr, tt.str, arr)
+		}
+	}
+}
+
+func TestInt64ArrayScanError(t *testing.T) {
+	for _, tt := range []struct {
+		input interface{}
+		err   string
+	}{
+		{1.5, "cannot convert float64 to Int64Array"},
+		{`{{12},{34}}`, "cannot convert ARRAY[2][1] to Int64Array"},
+		{`{NULL}`, "parsing array element index 0:"},
+		{`{12,3.4}`, "parsing array element index 1:"},
+	} {
+		arr := Int64Array{5, 5, 5}
+		err := arr.Scan(tt.input)
+
+		if err == nil {
+			t.Fatalf("Expected error for %q, got none", tt.input)
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected error to contain %q for %q, got %q", tt.err, tt.input, err)
+		}
+	}
+}
+
+func TestInt64ArrayValue(t *testing.T) {
+	for _, tt := range []struct {
+		arr  Int64Array
+		want string
+	}{
+		{Int64Array{}, `{}`},
+		{Int64Array{123}, `{123}`},
+		{Int64Array{-123, 456, 0}, `{-123,456,0}`},
+	} {
+		result, err := tt.arr.Value()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if result != tt.want {
+			t.Errorf("Expected %q for %v, got %q", tt.want, tt.arr, result)
+		}
+	}
+}
+
+func TestStringArrayScan(t *testing.T) {
+	for _, tt := range []struct {
+		str string
+		arr StringArray
+	}{
+		{`{}`, StringArray{}},
+		{`{t}`, StringArray{"t"}},
+		{`{f,1}`, StringArray{"f", "1"}},
+		{`{"a\\b","c d",","}`, StringArray{"a\\b", "c d", ","}},
+		{`{"",NULL_NOT}`, StringArray{"", "NULL_NOT"}},
+	} {
+		arr := StringArray{"x", "x", "x"}
+		err := arr.Scan(tt.str)
+
+		if err != nil {
+			t.Fatalf("Expected no error for %q, got %v", tt.str, err)
+		}
+		if !reflect.DeepEqual(arr, tt.arr) {
+			t.Errorf("Expected %+v for %q, got %+v", tt.arr, tt.str, arr)
+		}
+	}
+}
+
+func TestStringArrayScanError(t *testing.T) {
+	for _, tt := range []struct {
+		input interface{}
+		err   string
+	}{
+		{true, "cannot convert bool to StringArray"},
+		{`{{a},{b}}`, "cannot convert ARRAY[2][1] to StringArray"},
+		{`{NULL}`, "parsing array element index 0: cannot convert nil to string"},
+		{`{a,NULL}`, "parsing array element index 1: cannot convert nil to string"},
+	} {
+		arr := StringArray{"x", "x", "x"}
+		err := arr.Scan(tt.input)
+
+		if err == nil {
+			t.Fatalf("Expected error for %q, got none", tt.input)
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected error to contain %q for %q, got %q", tt.err, tt.input, err)
+		}
+		if !reflect.DeepEqual(arr, StringArray{"x", "x", "x"}) {
+			t.Errorf("Expected destination not to change for %q, got %+v", tt.input, arr)
+		}
+	}
+}
+
+func TestStringArrayValue(t *testing.T) {
+	for _, tt := range []struct {
+		arr  StringArray
+		want string
+	}{
+		{StringArray{}, `{}`},
+		{StringArray{""}, `{""}`},
+		{StringArray{"a", "\\b", "c\"", "d,e"}, `{"a","\\b","c\"","d,e"}`},
+	} {
+		result, err := tt.arr.Value()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if result != tt.want {
+			t.Errorf("Expected %q for %v, got %q", tt.want, tt.arr, result)
+		}
+	}
+}
+
+// TestStringArrayRoundTrip checks that any string survives being encoded by
+// StringArray.Value and parsed back.
+func TestStringArrayRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	alphabet := []byte("ab{},\"\\ NUL")
+	for i := 0; i < 200; i++ {
+		arr := make(StringArray, 1+r.Intn(4))
+		for j := range arr {
+			s := make([]byte, r.Intn(6))
+			for k := range s {
+				s[k] = alphabet[r.Intn(len(alphabet))]
+			}
+			arr[j] = string(s)
+		}
+
+		v, err := arr.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got StringArray
+		if err := got.Scan(v); err != nil {
+			t.Fatalf("%q: %v", v, err)
+		}
+		if !reflect.DeepEqual(got, arr) {
+			t.Fatalf("Expected %q after round trip through %q, got %q", arr, v, got)
+		}
+	}
+}
+
+type semicolonDelimited string
+
+func (semicolonDelimited) ArrayDelimiter() string { return ";" }
+
+func (s *semicolonDelimited) Scan(src interface{}) error {
+	*s = semicolonDelimited(src.([]byte))
+	return nil
+}
+
+func TestGenericArrayScan(t *testing.T) {
+	var ints [][]int32
+	if err := (GenericArray{&ints}).Scan(`{{1,2},{3,-4}}`); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int32{{1, 2}, {3, -4}}; !reflect.DeepEqual(ints, want) {
+		t.Errorf("Expected %v, got %v", want, ints)
+	}
+
+	var fixed [2][3]string
+	if err := (GenericArray{&fixed}).Scan([]byte(`{{a,b,c},{"d,e",f,""}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if want := [2][3]string{{"a", "b", "c"}, {"d,e", "f", ""}}; fixed != want {
+		t.Errorf("Expected %v, got %v", want, fixed)
+	}
+
+	var nullable []sql.NullInt64
+	if err := (GenericArray{&nullable}).Scan(`{1,NULL,3}`); err != nil {
+		t.Fatal(err)
+	}
+	if want := []sql.NullInt64{{Int64: 1, Valid: true}, {}, {Int64: 3, Valid: true}}; !reflect.DeepEqual(nullable, want) {
+		t.Errorf("Expected %v, got %v", want, nullable)
+	}
+
+	var ptrs []*float32
+	if err := (GenericArray{&ptrs}).Scan(`{NULL,1.5}`); err != nil {
+		t.Fatal(err)
+	}
+	if len(ptrs) != 2 || ptrs[0] != nil || ptrs[1] == nil || *ptrs[1] != 1.5 {
+		t.Errorf("Expected [nil 1.5], got %v", ptrs)
+	}
+
+	var blobs [][]byte
+	if err := (GenericArray{&blobs}).Scan(`{ab,NULL}`); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]byte{[]byte("ab"), nil}; !reflect.DeepEqual(blobs, want) {
+		t.Errorf("Expected %q, got %q", want, blobs)
+	}
+
+	var boxes []semicolonDelimited
+	if err := (GenericArray{&boxes}).Scan(`{(1,2),(3,4);(5,6),(7,8)}`); err != nil {
+		t.Fatal(err)
+	}
+	if want := []semicolonDelimited{"(1,2),(3,4)", "(5,6),(7,8)"}; !reflect.DeepEqual(boxes, want) {
+		t.Errorf("Expected %v, got %v", want, boxes)
+	}
+
+	empty := [][]bool{{true}}
+	if err := (GenericArray{&empty}).Scan(`{}`); err != nil {
+		t.Fatal(err)
+	}
+	if empty == nil || len(empty) != 0 {
+		t.Errorf("Expected an empty slice, got %#v", empty)
+	}
+
+	if err := (GenericArray{&empty}).Scan(nil); err != nil {
+		t.Fatal(err)
+	}
+	if empty != nil {
+		t.Errorf("Expected nil when scanning NULL, got %#v", empty)
+	}
+}
+
+func TestGenericArrayScanError(t *testing.T) {
+	var ints []int
+	var fixed [2]int
+	var nested [][]int
+	var bools []bool
+	var unsupported []struct{}
+
+	for _, tt := range []struct {
+		dest, src interface{}
+		err       string
+	}{
+		{nil, `{}`, "destination <nil> is not a pointer to array or slice"},
+		{ints, `{}`, "destination []int is not a pointer to array or slice"},
+		{(*[]int)(nil), `{}`, "destination *[]int is nil"},
+		{new(int), `{}`, "destination *int is not a pointer to array or slice"},
+		{&ints, 1, "cannot convert int to []int"},
+		{&fixed, nil, "cannot convert <nil> to [2]int"},
+		{&fixed, `{1,2,3}`, "cannot convert ARRAY[3] to [2]int"},
+		{&ints, `{{1},{2}}`, "cannot convert ARRAY[2][1] to []int"},
+		{&nested, `{1,2}`, "cannot convert ARRAY[2] to [][]int"},
+		{&ints, `{1,NULL}`, "parsing array element index 1: cannot convert NULL to int"},
+		{&ints, `{1,x}`, "parsing array element index 1:"},
+		{&bools, `{t,true}`, `parsing array element index 1: invalid boolean "true"`},
+		{&unsupported, `{x}`, "scanning to struct {} is not implemented"},
+	} {
+		err := GenericArray{tt.dest}.Scan(tt.src)
+		if err == nil {
+			t.Fatalf("Expected error scanning %q into %T, got none", tt.src, tt.dest)
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected error to contain %q scanning %q into %T, got %q", tt.err, tt.src, tt.dest, err)
+		}
+	}
+}
+
+func TestGenericArrayValue(t *testing.T) {
+	for _, tt := range []struct {
+		input interface{}
+		want  interface{}
+	}{
+		{nil, nil},
+		{[]int(nil), nil},
+		{[]int{}, `{}`},
+		{[2]int{1, 2}, `{1,2}`},
+		{[][]int{{1, 2}, {3, 4}}, `{{1,2},{3,4}}`},
+		{[]string{`a"b`, `c\d`}, `{"a\"b","c\\d"}`},
+		{[][]byte{[]byte("ab"), nil}, `{"ab",NULL}`},
+		{[]*int{nil}, `{NULL}`},
+		{[]bool{true, false}, `{true,false}`},
+		{[]float32{1.5}, `{1.5}`},
+		{[]sql.NullString{{String: "x", Valid: true}, {}}, `{"x",NULL}`},
+		{[]semicolonDelimited{"(1,2),(3,4)", "(5,6),(7,8)"}, `{"(1,2),(3,4)";"(5,6),(7,8)"}`},
+	} {
+		result, err := GenericArray{tt.input}.Value()
+		if err != nil {
+			t.Fatalf("Expected no error for %v, got %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(result, tt.want) {
+			t.Errorf("Expected %q for %v, got %q", tt.want, tt.input, result)
+		}
+	}
+
+	for _, tt := range []interface{}{
+		1,
+		[]struct{}{{}},
+		[]chan int{nil},
+	} {
+		if _, err := (GenericArray{tt}).Value(); err == nil {
+			t.Errorf("Expected error for %T, got none", tt)
+		}
+	}
+}
+
+func TestAppendArrayQuotedBytes(t *testing.T) {
+	got := appendArrayQuotedBytes([]byte("x"), []byte(`\"a\`))
+	if want := []byte(`x"\\\"a\\"`); !bytes.Equal(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestArrayRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	strs := []string{"", "a,b", `"`, `\`, "NULL", "{}"}
+	var gotStrs []string
+	err := db.QueryRow("SELECT $1::text[]", Array(strs)).Scan(Array(&gotStrs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotStrs, strs) {
+		t.Errorf("Expected %q, got %q", strs, gotStrs)
+	}
+
+	matrix := [][]int32{{1, 2, 3}, {4, 5, 6}}
+	var gotMatrix [][]int32
+	err = db.QueryRow("SELECT $1::int4[][]", Array(matrix)).Scan(Array(&gotMatrix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotMatrix, matrix) {
+		t.Errorf("Expected %v, got %v", matrix, gotMatrix)
+	}
+
+	blobs := [][]byte{{0, 1, 2}, {}, {0xff}}
+	var gotBlobs [][]byte
+	err = db.QueryRow("SELECT $1::bytea[]", Array(blobs)).Scan(Array(&gotBlobs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotBlobs, blobs) {
+		t.Errorf("Expected %v, got %v", blobs, gotBlobs)
+	}
+
+	var nullable []sql.NullString
+	err = db.QueryRow("SELECT ARRAY['a', NULL]").Scan(Array(&nullable))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []sql.NullString{{String: "a", Valid: true}, {}}; !reflect.DeepEqual(nullable, want) {
+		t.Errorf("Expected %v, got %v", want, nullable)
+	}
+
+	var offset Int64Array
+	err = db.QueryRow("SELECT '[0:2]={1,2,3}'::int8[]").Scan(&offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Int64Array{1, 2, 3}); !reflect.DeepEqual(offset, want) {
+		t.Errorf("Expected %v, got %v", want, offset)
+	}
+}
@@ -0,0 +1,409 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq/oid"
+)
+
+// ErrBatchAborted is the error of the queries in a Batch which weren't run
+// because another query in the batch failed.
+var ErrBatchAborted = errors.New("pq: query not run because another query in the batch failed")
+
+// Batch is a list of queries which SendBatch sends to the server together.
+type Batch struct {
+	queries []batchQuery
+}
+
+type batchQuery struct {
+	query string
+	args  []interface{}
+}
+
+// Queue adds query, with the arguments args, to the batch.
+func (b *Batch) Queue(query string, args ...interface{}) {
+	b.queries = append(b.queries, batchQuery{query: query, args: args})
+}
+
+// Len returns the number of queries in the batch.
+func (b *Batch) Len() int {
+	return len(b.queries)
+}
+
+// BatchResult is the outcome of a query in a Batch.
+type BatchResult struct {
+	// The result of the query, if it ran successfully.
+	Result driver.Result
+
+	// The names of the columns and the rows returned by the query, if any.
+	// The values have the same types as those returned by Query.
+	Columns []string
+	Rows    [][]driver.Value
+
+	// The error the query failed with, ErrBatchAborted if it wasn't run
+	// because another query failed, or nil.
+	Err error
+}
+
+// SendBatch sends the queries of b to the server over c, a driver connection,
+// and returns their results, which are in the same order as the queries.
+//
+// The queries are sent as extended query protocol messages, with a single Sync
+// at the end of the batch.  A query with arguments is first described by the
+// server, in the same stream of messages, so that its arguments are sent as
+// they are for Query; the rest of the batch waits for the types of its
+// parameters, so the batch takes a round trip for each distinct query with
+// arguments, and one more.  Once a query fails, the server skips the rest of
+// the batch; the results of those queries have ErrBatchAborted as their Err.
+// Unless c is in a transaction, the batch runs as an implicit transaction, so
+// a failure also rolls back the queries before it.
+//
+// The arguments are converted before anything is sent; if one can't be, that
+// query has the error as its Err, all the others ErrBatchAborted, and none of
+// the batch is run.  If an argument can't be encoded for the type of its
+// parameter, which is only known once the query is described, that query has
+// the error as its Err, and the queries after it have ErrBatchAborted, but the
+// queries before it are run.
+//
+// The error returned is only non-nil if the batch couldn't be run at all, for
+// instance because the connection was lost.  A connection can be obtained
+// from a *sql.DB with sql.Conn.Raw:
+//
+//	var results []pq.BatchResult
+//	err := conn.Raw(func(driverConn interface{}) (err error) {
+//		results, err = pq.SendBatch(driverConn.(driver.Conn), &batch)
+//		return err
+//	})
+func SendBatch(c driver.Conn, b *Batch) ([]BatchResult, error) {
+	cn, ok := c.(*conn)
+	if !ok {
+		return nil, fmt.Errorf("pq: SendBatch called with a connection of type %T", c)
+	}
+	return cn.sendBatch(b)
+}
+
+func (cn *conn) sendBatch(b *Batch) (results []BatchResult, err error) {
+	if cn.bad {
+		return nil, driver.ErrBadConn
+	}
+	defer cn.errRecover(&err)
+
+	if err := cn.resolveTypes(); err != nil {
+		return nil, err
+	}
+	results = make([]BatchResult, len(b.queries))
+	if len(b.queries) == 0 {
+		return results, nil
+	}
+	// Convert all the arguments before anything is sent, so that a bad
+	// argument doesn't leave the queries before it to run on their own.
+	args := make([][]driver.Value, len(b.queries))
+	for i, q := range b.queries {
+		if args[i], err = convertBatchArgs(q.args); err != nil {
+			results[i].Err = err
+			for j := range results {
+				if j != i {
+					results[j].Err = ErrBatchAborted
+				}
+			}
+			return results, nil
+		}
+	}
+
+	br := &batchReader{cn: cn, results: results, sent: len(results)}
+	// the types of the parameters of the queries described so far
+	paramTyps := make(map[string][]oid.Oid)
+	var w *writeBuf
+	next := func(t byte) {
+		if w == nil {
+			// Don't use the scratch buffer of cn, which is overwritten by
+			// the messages received while the batch is still being written.
+			w = &writeBuf{buf: []byte{t, 0, 0, 0, 0}, pos: 1}
+		} else {
+			w.next(t)
+		}
+	}
+	for i, q := range b.queries {
+		typs, described := paramTyps[q.query]
+		parsed := false
+		if len(args[i]) > 0 && !described {
+			// Send the batch so far, followed by the Parse and Describe of
+			// the query, and wait for the types of its parameters.  The
+			// server only parses the query once the queries before it have
+			// run, so it can refer to the tables they create.
+			next('P')
+			w.string("")
+			w.string(q.query)
+			w.int16(0)
+			next('D')
+			w.byte('S')
+			w.string("")
+			next('H')
+			buf := w.wrap()
+			w = nil
+			ok := false
+			cn.writeBatch(buf, func() {
+				typs, ok = br.recvDescribe(i)
+			})
+			if !ok {
+				cn.send(cn.writeBuf('S'))
+				br.recv()
+				return results, nil
+			}
+			paramTyps[q.query] = typs
+			parsed = true
+		}
+
+		bind, err := cn.encodeBatchArgs(args[i], typs)
+		if err != nil {
+			results[i].Err = err
+			for j := i + 1; j < len(results); j++ {
+				results[j].Err = ErrBatchAborted
+			}
+			br.sent = i
+			break
+		}
+		if !parsed {
+			// The query is parsed with the parameter types of its earlier
+			// description, if it has arguments.
+			next('P')
+			w.string("")
+			w.string(q.query)
+			w.int16(len(typs))
+			for _, typ := range typs {
+				w.int32(int(typ))
+			}
+		}
+		next('B')
+		w.string("")
+		w.string("")
+		w.bytes(bind)
+		// all result columns in text format
+		w.int16(0)
+
+		next('D')
+		w.byte('P')
+		w.string("")
+
+		next('E')
+		w.string("")
+		w.int32(0)
+	}
+	next('S')
+	cn.writeBatch(w.wrap(), br.recv)
+	return results, nil
+}
+
+// writeBatch writes buf, messages of a batch, while recv reads the responses
+// to them, so that neither side can block the other when the socket buffers
+// are full.
+func (cn *conn) writeBatch(buf []byte, recv func()) {
+	written := make(chan error, 1)
+	go func() {
+		_, err := cn.c.Write(buf)
+		written <- err
+	}()
+
+	recv()
+	if err := <-written; err != nil {
+		panic(err)
+	}
+}
+
+// convertBatchArgs converts the arguments of a query in a Batch as
+// database/sql and CheckNamedValue do for the arguments of Query.  Values
+// which aren't driver values are passed on as they are when any registered
+// types have encoders; see convertParameter.
+func convertBatchArgs(args []interface{}) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	encoders := hasTypeEncoders()
+	for i, arg := range args {
+		if v, ok, err := numericParameter(arg); ok {
+			if err != nil {
+				return nil, fmt.Errorf("pq: converting argument $%d: %v", i+1, err)
+			}
+			values[i] = v
+			continue
+		}
+		if _, ok := arg.(driver.Valuer); !ok && encoders {
+			values[i] = arg
+			continue
+		}
+		v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("pq: converting argument $%d: %v", i+1, err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// encodeBatchArgs encodes args, the arguments of a query in a batch, for the
+// types of its parameters, paramTyps, as stmt.exec does, and returns the
+// format codes and values of its Bind message.  Unlike stmt.exec, it returns
+// rather than panics with any error, since part of the batch may already have
+// been sent.  Arguments without a parameter are left for the server to
+// reject.
+func (cn *conn) encodeBatchArgs(args []driver.Value, paramTyps []oid.Oid) (_ []byte, err error) {
+	defer errRecoverNoErrBadConn(&err)
+
+	if len(args) >= 65536 {
+		errorf("got %d parameters but PostgreSQL only supports 65535 parameters", len(args))
+	}
+	params := make([][]byte, len(args))
+	fmts := make([]format, len(args))
+	nulls := make([]bool, len(args))
+	anyBinary := false
+	for i, x := range args {
+		typ := oid.T_unknown
+		if i < len(paramTyps) {
+			typ = paramTyps[i]
+		}
+		x = convertParameter(&cn.parameterStatus, x, typ)
+		if x == nil {
+			nulls[i] = true
+			continue
+		}
+		params[i], fmts[i] = encodeParameter(&cn.parameterStatus, x, typ, !cn.disableBinaryParameters)
+		anyBinary = anyBinary || fmts[i] == formatBinary
+	}
+
+	w := &writeBuf{}
+	if anyBinary {
+		w.int16(len(fmts))
+		for _, f := range fmts {
+			w.int16(int(f))
+		}
+	} else {
+		w.int16(0)
+	}
+	w.int16(len(args))
+	for i := range args {
+		if nulls[i] {
+			w.int32(-1)
+		} else {
+			w.int32(len(params[i]))
+			w.bytes(params[i])
+		}
+	}
+	return w.buf, nil
+}
+
+// batchReader reads the responses to the queries of a batch.
+type batchReader struct {
+	cn      *conn
+	results []BatchResult
+	// the number of queries which are run, unless one fails
+	sent int
+
+	// the index of the query whose responses are being read, and the types
+	// of its columns
+	n    int
+	typs []oid.Oid
+}
+
+// recvDescribe reads the responses to the queries before the query i, and to
+// the Describe of i, and returns the types of the parameters of i.  ok is
+// false if any of them failed, in which case the server skips the rest of the
+// batch, up to the Sync.
+func (br *batchReader) recvDescribe(i int) (paramTyps []oid.Oid, ok bool) {
+	for {
+		t, r := br.cn.recv1()
+		if br.n < i || t == 'E' {
+			if !br.recvResponse(t, r) {
+				return nil, false
+			}
+			continue
+		}
+		switch t {
+		case '1':
+		case 't':
+			paramTyps = make([]oid.Oid, r.int16())
+			for j := range paramTyps {
+				paramTyps[j] = r.oid()
+			}
+		case 'T', 'n':
+			return paramTyps, true
+		default:
+			br.cn.bad = true
+			errorf("unexpected batch describe response: %q", t)
+		}
+	}
+}
+
+// recv reads the rest of the responses to the batch, up to ReadyForQuery.
+func (br *batchReader) recv() {
+	for {
+		t, r := br.cn.recv1()
+		if t == 'Z' {
+			br.cn.processReadyForQuery(r)
+			if br.n != br.sent {
+				br.cn.bad = true
+				errorf("unexpected ReadyForQuery after %d of %d queries in a batch", br.n, br.sent)
+			}
+			return
+		}
+		br.recvResponse(t, r)
+	}
+}
+
+// recvResponse processes a response to the query br.n.  It returns false if
+// the response is an error, which fails the batch.
+func (br *batchReader) recvResponse(t byte, r *readBuf) bool {
+	switch t {
+	case '1', '2', 'n':
+	case 'T':
+		res := &br.results[br.n]
+		res.Columns, br.typs, _ = parseStatementRowDescribe(r)
+	case 'D':
+		res := &br.results[br.n]
+		row := make([]driver.Value, r.int16())
+		for i := range row {
+			l := r.int32()
+			if l == -1 {
+				continue
+			}
+			v := decode(&br.cn.parameterStatus, r.next(l), br.typs[i], formatText)
+			if b, ok := v.([]byte); ok {
+				// the message buffer is reused
+				v = append([]byte(nil), b...)
+			}
+			row[i] = v
+		}
+		res.Rows = append(res.Rows, row)
+	case 'C', 'I':
+		res := &br.results[br.n]
+		if t == 'C' {
+			res.Result, _ = br.cn.parseComplete(r.string())
+		} else {
+			res.Result = driver.RowsAffected(0)
+		}
+		br.n++
+		br.typs = nil
+	case 'E':
+		err := parseError(r)
+		if err.Fatal() {
+			panic(err)
+		}
+		if br.n == br.sent {
+			// Committing the implicit transaction failed, for instance
+			// because of a deferred constraint; blame the last query.
+			br.n--
+			br.results[br.n].Result = nil
+		}
+		br.results[br.n].Err = err
+		for i := br.n + 1; i < len(br.results); i++ {
+			if br.results[i].Err == nil {
+				br.results[i].Err = ErrBatchAborted
+			}
+		}
+		br.n = br.sent
+		return false
+	default:
+		br.cn.bad = true
+		errorf("unexpected batch response: %q", t)
+	}
+	return true
+}
@@ -0,0 +1,328 @@
+package pq
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq/oid"
+)
+
+// expectBatchDescribe reads the Parse, Describe and Flush messages with which
+// the parameters of a query in a batch are looked up, and returns the query.
+func (s *fakeServer) expectBatchDescribe() (query string) {
+	query, typs := s.expectBatchParse()
+	if len(typs) != 0 {
+		s.fail("got parameter types %v to describe", typs)
+	}
+	s.expect('D')
+	s.expect('H')
+	return query
+}
+
+// sendParameterDescription sends the response to the Describe of a query in
+// a batch, whose parameters have the types typs and which returns no rows.
+func (s *fakeServer) sendParameterDescription(typs ...oid.Oid) {
+	s.send(newFakeMessage('1'))
+	w := newFakeMessage('t')
+	w.int16(len(typs))
+	for _, typ := range typs {
+		w.int32(int(typ))
+	}
+	s.send(w)
+	s.send(newFakeMessage('n'))
+}
+
+// expectBatchParse reads the Parse message of a query in a batch, and returns
+// the query and the types of its parameters.
+func (s *fakeServer) expectBatchParse() (query string, typs []oid.Oid) {
+	r := s.expect('P')
+	r.string()
+	query = r.string()
+	typs = make([]oid.Oid, r.int16())
+	for i := range typs {
+		typs[i] = r.oid()
+	}
+	return query, typs
+}
+
+// expectBatchExecute reads the Bind, Describe and Execute messages of a query
+// in a batch, and returns the format codes and values of its parameters.
+func (s *fakeServer) expectBatchExecute() (formats []int, params [][]byte) {
+	r := s.expect('B')
+	r.string()
+	r.string()
+	formats = make([]int, r.int16())
+	for i := range formats {
+		formats[i] = r.int16()
+	}
+	params = make([][]byte, r.int16())
+	for i := range params {
+		if l := r.int32(); l != -1 {
+			params[i] = r.next(l)
+		}
+	}
+	s.expect('D')
+	s.expect('E')
+	return formats, params
+}
+
+// expectBatchQuery reads the messages of a query in a batch which was not
+// described, and returns the query.
+func (s *fakeServer) expectBatchQuery() (query string) {
+	query, _ = s.expectBatchParse()
+	s.expectBatchExecute()
+	return query
+}
+
+// sendBatchInsert sends the responses to a query in a batch which inserts a
+// row.
+func (s *fakeServer) sendBatchInsert() {
+	s.send(newFakeMessage('1'))
+	s.send(newFakeMessage('2'))
+	s.send(newFakeMessage('n'))
+	s.sendCommandComplete("INSERT 0 1")
+}
+
+func TestSendBatch(t *testing.T) {
+	const insert = "INSERT INTO t VALUES ($1, $2, $3, $4, $5)"
+	typs := []oid.Oid{oid.T_int4, oid.T_bytea, oid.T_jsonb, oid.T_text, oid.T_numeric}
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		if q := s.expectBatchDescribe(); q != insert {
+			s.fail("expected the insert to be described, got %q", q)
+		}
+		s.sendParameterDescription(typs...)
+
+		// the described statement is run without parsing it again
+		formats, params := s.expectBatchExecute()
+		// []byte is only sent in the binary format for bytea
+		if !reflect.DeepEqual(formats, []int{1, 1, 0, 0, 0}) {
+			s.fail("got parameter formats %v", formats)
+		}
+		want := [][]byte{{0, 0, 0, 1}, {0, 1}, []byte(`{"a":1}`), nil, []byte("12345")}
+		if !reflect.DeepEqual(params, want) {
+			s.fail("got parameters %q, want %q", params, want)
+		}
+		if q := s.expectBatchQuery(); q != "SELECT x FROM t" {
+			s.fail("expected the select, got %q", q)
+		}
+		// the same query again is parsed with the types it was described with
+		if q, got := s.expectBatchParse(); q != insert || !reflect.DeepEqual(got, typs) {
+			s.fail("got query %q with parameter types %v", q, got)
+		}
+		s.expectBatchExecute()
+		for _, q := range []string{"INSERT INTO t VALUES (1)", "SELECT 1"} {
+			if got := s.expectBatchQuery(); got != q {
+				s.fail("expected query %q, got %q", q, got)
+			}
+		}
+		s.expect('S')
+
+		s.send(newFakeMessage('2'))
+		s.send(newFakeMessage('n'))
+		s.sendCommandComplete("INSERT 0 1")
+
+		s.send(newFakeMessage('1'))
+		s.send(newFakeMessage('2'))
+		s.sendRowDescription([]string{"x"}, []oid.Oid{oid.T_text})
+		s.sendDataRow([]byte("a"))
+		s.sendDataRow(nil)
+		s.sendCommandComplete("SELECT 2")
+
+		s.sendBatchInsert()
+
+		s.send(newFakeMessage('1'))
+		s.send(newFakeMessage('2'))
+		s.send(newFakeMessage('n'))
+		s.sendError("ERROR", "23505", "duplicate key value violates unique constraint")
+		s.sendReadyForQuery()
+		s.expect('X')
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b Batch
+	b.Queue(insert, 1, []byte{0, 1}, JSON(map[string]int{"a": 1}), nil, big.NewInt(12345))
+	b.Queue("SELECT x FROM t")
+	b.Queue(insert, 2, []byte{}, JSON(nil), "x", 1.5)
+	b.Queue("INSERT INTO t VALUES (1)")
+	b.Queue("SELECT 1")
+	results, err := SendBatch(cn, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != b.Len() {
+		t.Fatalf("got %d results for %d queries", len(results), b.Len())
+	}
+	for _, i := range []int{0, 2} {
+		if n, _ := results[i].Result.RowsAffected(); n != 1 || results[i].Err != nil {
+			t.Errorf("insert %d: got %d rows affected and error %v", i, n, results[i].Err)
+		}
+	}
+	if !reflect.DeepEqual(results[1].Columns, []string{"x"}) {
+		t.Errorf("select: got columns %v", results[1].Columns)
+	}
+	if want := [][]driver.Value{{[]byte("a")}, {nil}}; !reflect.DeepEqual(results[1].Rows, want) {
+		t.Errorf("select: got rows %v, want %v", results[1].Rows, want)
+	}
+	if err, ok := results[3].Err.(*Error); !ok || err.Code != "23505" || results[3].Result != nil {
+		t.Errorf("expected a unique_violation, got %v", results[3].Err)
+	}
+	if results[4].Err != ErrBatchAborted {
+		t.Errorf("got error %v, want %v", results[4].Err, ErrBatchAborted)
+	}
+}
+
+func TestSendBatchFailures(t *testing.T) {
+	defer resetTypeRegistry()
+	const failOid = oid.Oid(16700)
+
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		// a query which can't be parsed, after one which ran
+		s.expectBatchQuery()
+		s.expectBatchDescribe()
+		s.sendBatchInsert()
+		s.sendError("ERROR", "42601", "syntax error")
+		s.expect('S')
+		s.sendReadyForQuery()
+
+		// an argument which can't be encoded
+		s.expectBatchQuery()
+		s.expectBatchDescribe()
+		s.sendBatchInsert()
+		s.sendParameterDescription(failOid)
+		s.expect('S')
+		s.sendReadyForQuery()
+		s.expect('X')
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// check checks the results of b, whose query failed failed, and whose
+	// queries before it ran if ran is set
+	check := func(b *Batch, failed int, ran bool) error {
+		results, err := SendBatch(cn, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, res := range results {
+			switch {
+			case i == failed:
+				if res.Err == nil || res.Err == ErrBatchAborted {
+					t.Errorf("%d: got error %v", i, res.Err)
+				}
+			case i < failed && ran:
+				if res.Err != nil || res.Result == nil {
+					t.Errorf("%d: got result %v and error %v", i, res.Result, res.Err)
+				}
+			default:
+				if res.Err != ErrBatchAborted {
+					t.Errorf("%d: got error %v, want %v", i, res.Err, ErrBatchAborted)
+				}
+			}
+		}
+		return results[failed].Err
+	}
+
+	// an argument which can't be converted; nothing is sent
+	var b Batch
+	b.Queue("INSERT INTO t VALUES (1)")
+	b.Queue("INSERT INTO t VALUES ($1)", make(chan int))
+	b.Queue("INSERT INTO t VALUES (2)")
+	check(&b, 1, false)
+
+	b = Batch{}
+	b.Queue("INSERT INTO t VALUES (1)")
+	b.Queue("INSERT INTO t VALUES ($1", 2)
+	b.Queue("INSERT INTO t VALUES (3)")
+	if err, ok := check(&b, 1, true).(*Error); !ok || err.Code != "42601" {
+		t.Errorf("expected a syntax_error, got %v", err)
+	}
+
+	RegisterTypeOID(failOid, TypeCodec{
+		EncodeText: func(x interface{}) ([]byte, error) {
+			return nil, errors.New("can't encode")
+		},
+	})
+	b = Batch{}
+	b.Queue("INSERT INTO t VALUES (1)")
+	b.Queue("INSERT INTO t VALUES ($1)", 2)
+	b.Queue("INSERT INTO t VALUES (3)")
+	if err := check(&b, 1, true); err == nil || !strings.Contains(err.Error(), "can't encode") {
+		t.Errorf("expected an encoding error, got %v", err)
+	}
+
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendBatchServer(t *testing.T) {
+	// sets up the environment for Open
+	db := openTestConn(t)
+	defer db.Close()
+
+	cn, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.Close()
+
+	// the queries with arguments can refer to the table the batch creates
+	var b Batch
+	b.Queue("CREATE TEMP TABLE batch (i int PRIMARY KEY, b bytea, t text, j jsonb, n numeric)")
+	for i := 0; i < 1000; i++ {
+		b.Queue("INSERT INTO batch VALUES ($1, $2, $3, $4, $5)", i, []byte{0, byte(i)}, []byte("text"), JSON(map[string]int{"i": i}), big.NewRat(int64(i), 4))
+	}
+	b.Queue("SELECT count(*), max(b), min(t), max(j->>'i'), sum(n) FROM batch")
+	results, err := SendBatch(cn, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		if res.Err != nil {
+			t.Fatalf("%d: %v", i, res.Err)
+		}
+	}
+	row := results[len(results)-1].Rows[0]
+	if row[0] != int64(1000) || !bytes.Equal(row[1].([]byte), []byte{0, 255}) || string(row[2].([]byte)) != "text" || string(row[3].([]byte)) != "999" || string(row[4].([]byte)) != "124875.00" {
+		t.Errorf("got %v", row)
+	}
+
+	// the failed query and those after it are reported
+	b = Batch{}
+	b.Queue("INSERT INTO batch VALUES (1000)")
+	b.Queue("INSERT INTO batch VALUES (1)")
+	b.Queue("INSERT INTO batch VALUES (1001)")
+	results, err = SendBatch(cn, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil {
+		t.Errorf("got error %v", results[0].Err)
+	}
+	if err, ok := results[1].Err.(*Error); !ok || err.Code.Name() != "unique_violation" {
+		t.Errorf("expected a unique_violation, got %v", results[1].Err)
+	}
+	if results[2].Err != ErrBatchAborted {
+		t.Errorf("got error %v", results[2].Err)
+	}
+}
@@ -433,3 +433,46 @@ func BenchmarkResultParsing(b *testing.B) {
 		res.Close()
 	}
 }
+
+var copyInBenchRow = []driver.Value{
+	int64(123456),
+	"some text value",
+	[]byte("abcdefghijklmnopqrstuvwxyz"),
+	testTimestamptz,
+	3.14159,
+	true,
+}
+
+var copyInBenchTypes = []oid.Oid{oid.T_int8, oid.T_text, oid.T_bytea, oid.T_timestamptz, oid.T_float8, oid.T_bool}
+
+func BenchmarkCopyInText(b *testing.B) {
+	benchCopyIn(b, nil)
+}
+
+func BenchmarkCopyInBinary(b *testing.B) {
+	benchCopyIn(b, copyInBenchTypes)
+}
+
+// benchCopyIn measures the cost of encoding rows for COPY FROM STDIN in the
+// text format, or in the binary format if typs is not nil.
+func benchCopyIn(b *testing.B, typs []oid.Oid) {
+	c := fakeConn("", 0)
+	c.parameterStatus.serverVersion = 90000
+	ci := &copyin{
+		cn:         c,
+		buffer:     make([]byte, 0, ciBufferSize),
+		binaryTyps: typs,
+	}
+	ci.buffer = append(ci.buffer, 'd', 0, 0, 0, 0)
+	if typs != nil {
+		ci.buffer = append(ci.buffer, binaryCopyHeader...)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ci.Exec(copyInBenchRow); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
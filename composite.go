@@ -0,0 +1,549 @@
+package pq
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq/oid"
+)
+
+var typeTime = reflect.TypeOf(time.Time{})
+
+// Composite returns a driver.Valuer and sql.Scanner for a value of a composite
+// type, or a record, which maps the fields of the value onto the exported
+// fields of the struct v.  For scanning, v must be a pointer to the struct, or
+// a pointer to a pointer to it, which is set to nil for NULL.
+//
+//	type item struct {
+//		Name  string
+//		Price float64
+//		Tags  []string
+//	}
+//	var it item
+//	err := db.QueryRow("SELECT ('pen', 1.5, '{blue}')::inventory_item").Scan(pq.Composite(&it))
+//
+// The fields of the struct are the attributes of the type in order, except
+// that a field tagged `pq:"-"` is skipped and a field tagged with a number,
+// as in `pq:"3"`, is the attribute at that position, counted from 1; the
+// fields after it follow on from that position.  Attributes without a field
+// are ignored when scanning and sent as NULL.
+//
+// Fields are scanned through their sql.Scanner implementation if they have
+// one; otherwise booleans, numbers, strings, byte slices for attributes of
+// type bytea, time.Time, arrays and slices of those, nested structs for
+// attributes of composite types, and pointers to any of those are supported.
+//
+// Values are received in the text format unless a TypeCodec with
+// DecodeBinaryRecord is registered for the type.
+func Composite(v interface{}) interface {
+	driver.Valuer
+	sql.Scanner
+} {
+	return composite{v}
+}
+
+type composite struct{ v interface{} }
+
+// Scan implements the sql.Scanner interface.
+func (c composite) Scan(src interface{}) error {
+	dpv := reflect.ValueOf(c.v)
+	if dpv.Kind() != reflect.Ptr || dpv.IsNil() {
+		return fmt.Errorf("pq: destination %T is not a non-nil pointer", c.v)
+	}
+	dv := dpv.Elem()
+	rt := dv.Type()
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct {
+		return fmt.Errorf("pq: destination %T is not a pointer to a struct", c.v)
+	}
+
+	switch src := src.(type) {
+	case []byte:
+		return assignCompositeText(src, dv)
+	case string:
+		return assignCompositeText([]byte(src), dv)
+	case []RecordField:
+		if dv.Kind() == reflect.Ptr {
+			dv.Set(reflect.New(rt))
+			dv = dv.Elem()
+		}
+		return assignRecord(src, dv)
+	case nil:
+		return assignCompositeText(nil, dv)
+	}
+	return fmt.Errorf("pq: cannot convert %T to %s", src, dv.Type())
+}
+
+// Value implements the driver.Valuer interface.
+func (c composite) Value() (driver.Value, error) {
+	rv := reflect.ValueOf(c.v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("pq: unable to convert %T to a composite value", c.v)
+	}
+	b, err := appendCompositeStruct(nil, rv)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// compositeField maps the struct field index to the attribute at position
+// pos, counted from 0.
+type compositeField struct {
+	index int
+	pos   int
+}
+
+// compositeFields returns the fields of the struct type rt which map to
+// attributes, in the order of the attributes.
+func compositeFields(rt reflect.Type) ([]compositeField, error) {
+	var fields []compositeField
+	seen := make(map[int]bool)
+	pos := 0
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+		switch tag := sf.Tag.Get("pq"); tag {
+		case "-":
+			continue
+		case "":
+		default:
+			n, err := strconv.Atoi(tag)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("pq: invalid attribute position %q for field %s of %s", tag, sf.Name, rt)
+			}
+			pos = n - 1
+		}
+		if seen[pos] {
+			return nil, fmt.Errorf("pq: more than one field of %s maps to attribute %d", rt, pos+1)
+		}
+		seen[pos] = true
+		fields = append(fields, compositeField{index: i, pos: pos})
+		pos++
+	}
+	sort.Sort(compositeFieldsByPos(fields))
+	return fields, nil
+}
+
+type compositeFieldsByPos []compositeField
+
+func (a compositeFieldsByPos) Len() int           { return len(a) }
+func (a compositeFieldsByPos) Less(i, j int) bool { return a[i].pos < a[j].pos }
+func (a compositeFieldsByPos) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// isCompositeStruct reports whether values of type rt are scanned from and
+// converted to composite values field by field.
+func isCompositeStruct(rt reflect.Type) bool {
+	return rt.Kind() == reflect.Struct && rt != typeTime &&
+		!reflect.PtrTo(rt).Implements(typeSQLScanner) && !rt.Implements(typeDriverValuer)
+}
+
+// assignCompositeText stores src, a value in the text format of the attribute
+// of a composite type, or nil for NULL, in dest.
+func assignCompositeText(src []byte, dest reflect.Value) error {
+	rt := dest.Type()
+	switch {
+	case reflect.PtrTo(rt).Implements(typeSQLScanner):
+	case rt.Kind() == reflect.Ptr:
+		if src == nil {
+			dest.Set(reflect.Zero(rt))
+			return nil
+		}
+		v := reflect.New(rt.Elem())
+		if err := assignCompositeText(src, v.Elem()); err != nil {
+			return err
+		}
+		dest.Set(v)
+		return nil
+	case rt == typeByteSlice:
+		if src == nil {
+			dest.Set(reflect.Zero(rt))
+			return nil
+		}
+		b, err := parseBytea(src)
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			// an empty value, not NULL
+			b = []byte{}
+		}
+		dest.SetBytes(b)
+		return nil
+	case rt == typeTime:
+		if src == nil {
+			return fmt.Errorf("cannot convert NULL to %s", rt)
+		}
+		return assignCompositeTime(src, dest)
+	case rt.Kind() == reflect.Struct:
+		if src == nil {
+			return fmt.Errorf("cannot convert NULL to %s", rt)
+		}
+		fields, err := parseComposite(src)
+		if err != nil {
+			return err
+		}
+		return assignCompositeFields(len(fields), dest, func(i int, dest reflect.Value) error {
+			return assignCompositeText(fields[i], dest)
+		})
+	case isArrayContainer(rt):
+		if src == nil {
+			return GenericArray{dest.Addr().Interface()}.Scan(nil)
+		}
+		return GenericArray{dest.Addr().Interface()}.Scan(src)
+	}
+	return arrayElementAssigner(rt)(src, dest)
+}
+
+// assignCompositeTime parses src, a timestamp, date or time in the text
+// format, or a time formatted by Value, into dest.
+func assignCompositeTime(src []byte, dest reflect.Value) (err error) {
+	if t, err := time.Parse(time.RFC3339Nano, string(src)); err == nil {
+		dest.Set(reflect.ValueOf(t))
+		return nil
+	}
+	defer errRecoverNoErrBadConn(&err)
+	var v interface{}
+	switch {
+	case len(src) > 2 && src[2] == ':' && bytes.IndexAny(src, "+-") > 0:
+		v = mustParse("15:04:05-07", oid.T_timetz, src)
+	case len(src) > 2 && src[2] == ':':
+		v = mustParse("15:04:05", oid.T_time, src)
+	default:
+		v = parseTs(nil, string(src))
+	}
+	t, ok := v.(time.Time)
+	if !ok {
+		return fmt.Errorf("cannot convert %q to %s", src, dest.Type())
+	}
+	dest.Set(reflect.ValueOf(t))
+	return nil
+}
+
+// assignCompositeFields stores the n attributes of a composite value in the
+// fields of the struct dest, assigning each with assign.
+func assignCompositeFields(n int, dest reflect.Value, assign func(i int, dest reflect.Value) error) error {
+	fields, err := compositeFields(dest.Type())
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if f.pos >= n {
+			return fmt.Errorf("pq: composite value with %d attributes has no attribute %d for field %s of %s",
+				n, f.pos+1, dest.Type().Field(f.index).Name, dest.Type())
+		}
+		if err := assign(f.pos, dest.Field(f.index)); err != nil {
+			return fmt.Errorf("pq: scanning attribute %d into field %s: %v", f.pos+1, dest.Type().Field(f.index).Name, err)
+		}
+	}
+	return nil
+}
+
+// parseComposite splits src, a value of a composite type in the text format,
+// into the text of its attributes, which are nil for NULL.
+func parseComposite(src []byte) ([][]byte, error) {
+	invalid := func(msg string) ([][]byte, error) {
+		return nil, fmt.Errorf("pq: unable to parse composite value %q: %s", src, msg)
+	}
+	i := 0
+	for i < len(src) && isCompositeSpace(src[i]) {
+		i++
+	}
+	if i == len(src) || src[i] != '(' {
+		return invalid("expected '('")
+	}
+	i++
+
+	var fields [][]byte
+	for {
+		if i == len(src) {
+			return invalid("unexpected end of input")
+		}
+		var field []byte
+		if c := src[i]; c != ',' && c != ')' {
+			field = []byte{}
+			quoted := false
+			for quoted || (src[i] != ',' && src[i] != ')') {
+				switch c := src[i]; {
+				case c == '\\':
+					i++
+					if i == len(src) {
+						return invalid("unexpected end of input")
+					}
+					field = append(field, src[i])
+				case c == '"' && quoted && i+1 < len(src) && src[i+1] == '"':
+					field = append(field, '"')
+					i++
+				case c == '"':
+					quoted = !quoted
+				default:
+					field = append(field, c)
+				}
+				i++
+				if i == len(src) {
+					return invalid("unexpected end of input")
+				}
+			}
+		}
+		fields = append(fields, field)
+		i++
+		if src[i-1] == ')' {
+			break
+		}
+	}
+	for ; i < len(src); i++ {
+		if !isCompositeSpace(src[i]) {
+			return invalid("junk after ')'")
+		}
+	}
+	return fields, nil
+}
+
+// isCompositeSpace reports whether c is white space, which attributes must be
+// quoted to contain.
+func isCompositeSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', '\v', '\f':
+		return true
+	}
+	return false
+}
+
+// appendComposite appends a value of a composite type in the text format,
+// whose attributes have the text in fields, or nil for NULL, to b.
+func appendComposite(b []byte, fields [][]byte) []byte {
+	b = append(b, '(')
+	for i, f := range fields {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if f == nil {
+			continue
+		}
+		quote := len(f) == 0
+		for _, c := range f {
+			if c == '"' || c == '\\' || c == '(' || c == ')' || c == ',' || isCompositeSpace(c) {
+				quote = true
+				break
+			}
+		}
+		if !quote {
+			b = append(b, f...)
+			continue
+		}
+		b = append(b, '"')
+		for _, c := range f {
+			if c == '"' || c == '\\' {
+				b = append(b, c)
+			}
+			b = append(b, c)
+		}
+		b = append(b, '"')
+	}
+	return append(b, ')')
+}
+
+// appendCompositeStruct appends the struct rv as a value of a composite type
+// in the text format to b.
+func appendCompositeStruct(b []byte, rv reflect.Value) ([]byte, error) {
+	fields, err := compositeFields(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	var texts [][]byte
+	if len(fields) > 0 {
+		texts = make([][]byte, fields[len(fields)-1].pos+1)
+	}
+	for _, f := range fields {
+		if texts[f.pos], err = compositeFieldText(rv.Field(f.index)); err != nil {
+			return nil, fmt.Errorf("pq: converting field %s of %s: %v", rv.Type().Field(f.index).Name, rv.Type(), err)
+		}
+	}
+	return appendComposite(b, texts), nil
+}
+
+// compositeFieldText returns the text format of rv as an attribute of a
+// composite value, or nil for NULL.
+func compositeFieldText(rv reflect.Value) (_ []byte, err error) {
+	rt := rv.Type()
+	switch {
+	case rt.Implements(typeDriverValuer):
+	case rt.Kind() == reflect.Ptr:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return compositeFieldText(rv.Elem())
+	case rt == typeByteSlice:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		// The server version isn't known here, so use the escape format,
+		// which all versions accept.
+		return encodeBytea(0, rv.Bytes()), nil
+	case isCompositeStruct(rt):
+		return appendCompositeStruct(nil, rv)
+	case isArrayContainer(rt):
+		v, err := GenericArray{rv.Interface()}.Value()
+		if err != nil || v == nil {
+			return nil, err
+		}
+		return []byte(v.(string)), nil
+	}
+
+	v, err := driver.DefaultParameterConverter.ConvertValue(rv.Interface())
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case string:
+		return append([]byte{}, v...), nil
+	}
+	defer errRecoverNoErrBadConn(&err)
+	return appendEncodedText(&parameterStatus{}, []byte{}, v), nil
+}
+
+// A RecordField is an attribute of a value of a composite type, or of a
+// record, received in the binary format.
+type RecordField struct {
+	// the OID of the attribute's type
+	Type oid.Oid
+	// the attribute's value in the binary format, or nil for NULL
+	Value []byte
+}
+
+// DecodeBinaryRecord decodes a value of a composite type, or of a record, in
+// the binary format into its attributes, as a []RecordField.  It is meant to
+// be the DecodeBinary of the TypeCodec of a composite type, or of
+// oid.T_record, which makes prepared statements receive the values of the
+// type in the binary format:
+//
+//	pq.RegisterType("inventory_item", pq.TypeCodec{DecodeBinary: pq.DecodeBinaryRecord})
+//
+// Composite can scan the values it returns.  The attributes are decoded as
+// they are in the results of queries, except that timestamps with time zones
+// are in UTC; attributes of types pq doesn't know, including composite types,
+// are left in the binary format.
+func DecodeBinaryRecord(src []byte) (interface{}, error) {
+	fields, err := decodeBinaryRecord(append([]byte{}, src...))
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func decodeBinaryRecord(src []byte) ([]RecordField, error) {
+	errShort := errors.New("pq: invalid binary record: too short")
+	if len(src) < 4 {
+		return nil, errShort
+	}
+	n := int(int32(binary.BigEndian.Uint32(src)))
+	src = src[4:]
+	if n < 0 || n > len(src)/8 {
+		return nil, fmt.Errorf("pq: invalid binary record: %d attributes", n)
+	}
+	fields := make([]RecordField, n)
+	for i := range fields {
+		if len(src) < 8 {
+			return nil, errShort
+		}
+		fields[i].Type = oid.Oid(binary.BigEndian.Uint32(src))
+		l := int(int32(binary.BigEndian.Uint32(src[4:])))
+		src = src[8:]
+		if l < 0 {
+			continue
+		}
+		if l > len(src) {
+			return nil, errShort
+		}
+		fields[i].Value = src[:l]
+		src = src[l:]
+	}
+	if len(src) != 0 {
+		return nil, errors.New("pq: invalid binary record: junk after the last attribute")
+	}
+	return fields, nil
+}
+
+// assignRecord stores the attributes fields of a record in the struct dest.
+func assignRecord(fields []RecordField, dest reflect.Value) error {
+	return assignCompositeFields(len(fields), dest, func(i int, dest reflect.Value) error {
+		return assignRecordField(fields[i], dest)
+	})
+}
+
+// assignRecordField stores f, an attribute of a record received in the binary
+// format, in dest.
+func assignRecordField(f RecordField, dest reflect.Value) (err error) {
+	if f.Value == nil {
+		return assignCompositeText(nil, dest)
+	}
+	rt := dest.Type()
+	scanner := reflect.PtrTo(rt).Implements(typeSQLScanner)
+	if !scanner {
+		switch {
+		case rt.Kind() == reflect.Ptr:
+			v := reflect.New(rt.Elem())
+			if err := assignRecordField(f, v.Elem()); err != nil {
+				return err
+			}
+			dest.Set(v)
+			return nil
+		case isCompositeStruct(rt):
+			fields, err := decodeBinaryRecord(f.Value)
+			if err != nil {
+				return err
+			}
+			return assignRecord(fields, dest)
+		}
+	}
+
+	var v interface{} = f.Value
+	if _, ok := binaryDecoders[f.Type]; ok {
+		defer errRecoverNoErrBadConn(&err)
+		v = binaryDecode(&parameterStatus{}, f.Value, f.Type)
+	}
+	if scanner {
+		return dest.Addr().Interface().(sql.Scanner).Scan(v)
+	}
+	switch v := v.(type) {
+	case time.Time:
+		if rt != typeTime {
+			return fmt.Errorf("cannot convert %s to %s", typeTime, rt)
+		}
+		dest.Set(reflect.ValueOf(v))
+		return nil
+	case []byte:
+		// the types with no decoder here, such as text, are sent as they
+		// are in the text format
+		return assignCompositeText(v, dest)
+	case bool:
+		if v {
+			return assignCompositeText([]byte("t"), dest)
+		}
+		return assignCompositeText([]byte("f"), dest)
+	}
+	return assignCompositeText(appendEncodedText(&parameterStatus{}, nil, v), dest)
+}
@@ -0,0 +1,360 @@
+package pq
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq/oid"
+)
+
+func TestParseComposite(t *testing.T) {
+	for _, tt := range []struct {
+		input  string
+		fields []string
+		nulls  []int
+	}{
+		{`()`, []string{""}, []int{0}},
+		{`(1,2)`, []string{"1", "2"}, nil},
+		{`(,)`, []string{"", ""}, []int{0, 1}},
+		{`(a,"",)`, []string{"a", "", ""}, []int{2}},
+		{` (a b,"c,d") `, []string{"a b", "c,d"}, nil},
+		{`("a""b","c\\d","e\"f")`, []string{`a"b`, `c\d`, `e"f`}, nil},
+		{`(a\,b,x"y,z"w)`, []string{"a,b", "xy,zw"}, nil},
+		{`("(1,""x y"")","{1,2}")`, []string{`(1,"x y")`, "{1,2}"}, nil},
+	} {
+		fields, err := parseComposite([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		var got []string
+		var nulls []int
+		for i, f := range fields {
+			got = append(got, string(f))
+			if f == nil {
+				nulls = append(nulls, i)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.fields) || !reflect.DeepEqual(nulls, tt.nulls) {
+			t.Errorf("%q: got %q with NULLs at %v", tt.input, got, nulls)
+		}
+	}
+
+	for _, input := range []string{``, `1,2`, `(1,2`, `(1,"2)`, `(1,2\`, `(1,2) x`} {
+		if _, err := parseComposite([]byte(input)); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestAppendComposite(t *testing.T) {
+	fields := [][]byte{nil, {}, []byte("a"), []byte("a b"), []byte(`x"y\z`), []byte("(1,2)")}
+	got := string(appendComposite(nil, fields))
+	if want := `(,"",a,"a b","x""y\\z","(1,2)")`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	parsed, err := parseComposite([]byte(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, fields) {
+		t.Errorf("round trip: got %q", parsed)
+	}
+}
+
+type compositePoint struct {
+	X, Y int
+}
+
+type compositeItem struct {
+	Name    string
+	Price   *float64
+	Tags    []string
+	At      compositePoint
+	Ignored string `pq:"-"`
+	hidden  int
+	Count   sql.NullInt64 `pq:"6"`
+	When    time.Time
+}
+
+func TestCompositeScan(t *testing.T) {
+	var it compositeItem
+	src := `("a ""pen""",,"{blue,""dark red""}","(1,-2)",x,,"2001-02-03 04:05:06")`
+	if err := Composite(&it).Scan([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	want := compositeItem{
+		Name: `a "pen"`,
+		Tags: []string{"blue", "dark red"},
+		At:   compositePoint{1, -2},
+	}
+	if when := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC); !it.When.Equal(when) {
+		t.Errorf("got time %v", it.When)
+	}
+	it.When = time.Time{}
+	if !reflect.DeepEqual(it, want) {
+		t.Errorf("got %+v", it)
+	}
+
+	var p *compositePoint
+	if err := Composite(&p).Scan("(3,4)"); err != nil {
+		t.Fatal(err)
+	}
+	if p == nil || *p != (compositePoint{3, 4}) {
+		t.Errorf("got %+v", p)
+	}
+	if err := Composite(&p).Scan(nil); err != nil {
+		t.Fatal(err)
+	}
+	if p != nil {
+		t.Errorf("got %+v for NULL", p)
+	}
+
+	var pt compositePoint
+	for _, src := range []interface{}{nil, "(1)", "(1,x)", "1,2", 5} {
+		if err := Composite(&pt).Scan(src); err == nil {
+			t.Errorf("%v: expected an error", src)
+		}
+	}
+	if err := Composite(pt).Scan("(1,2)"); err == nil {
+		t.Error("expected an error for a non-pointer destination")
+	}
+}
+
+func TestCompositeValue(t *testing.T) {
+	price := 1.5
+	it := compositeItem{
+		Name:    "a, b",
+		Price:   &price,
+		Tags:    []string{"x y"},
+		At:      compositePoint{1, 2},
+		Ignored: "ignored",
+		Count:   sql.NullInt64{Int64: 7, Valid: true},
+		When:    time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC),
+	}
+	v, err := Composite(it).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `("a, b",1.5,"{""x y""}","(1,2)",,7,2001-02-03T04:05:06Z)`
+	if v != want {
+		t.Errorf("got %v, want %s", v, want)
+	}
+
+	var back compositeItem
+	if err := Composite(&back).Scan(v); err != nil {
+		t.Fatal(err)
+	}
+	it.Ignored = ""
+	if !reflect.DeepEqual(back, it) {
+		t.Errorf("round trip: got %+v", back)
+	}
+
+	if v, err := Composite((*compositePoint)(nil)).Value(); v != nil || err != nil {
+		t.Errorf("got %v, %v for a nil pointer", v, err)
+	}
+	if _, err := Composite(5).Value(); err == nil {
+		t.Error("expected an error for a non-struct")
+	}
+}
+
+func TestCompositeBytea(t *testing.T) {
+	type blob struct {
+		B []byte
+		N []byte
+	}
+	v, err := Composite(blob{B: []byte{0, '\\', 0xff, 'a'}}).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `("\\000\\\\\\377a",)`; v != want {
+		t.Errorf("got %s, want %s", v, want)
+	}
+
+	for _, tt := range []struct {
+		src  string
+		want blob
+	}{
+		{`("\\x005cff",)`, blob{B: []byte{0, '\\', 0xff}}},
+		{`("\\000\\\\\\377a",)`, blob{B: []byte{0, '\\', 0xff, 'a'}}},
+		{`(,"")`, blob{N: []byte{}}},
+	} {
+		var got blob
+		if err := Composite(&got).Scan(tt.src); err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+	var b blob
+	if err := Composite(&b).Scan(`("\\xzz",)`); err == nil {
+		t.Error("expected an error for invalid hex")
+	}
+}
+
+// appendBinaryRecord appends a record in the binary format with fields of
+// the types typs and the values vals, nil for NULL, to b.
+func appendBinaryRecord(b []byte, typs []oid.Oid, vals [][]byte) []byte {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(vals)))
+	b = append(b, n[:]...)
+	for i, v := range vals {
+		binary.BigEndian.PutUint32(n[:], uint32(typs[i]))
+		b = append(b, n[:]...)
+		if v == nil {
+			b = append(b, 0xff, 0xff, 0xff, 0xff)
+			continue
+		}
+		binary.BigEndian.PutUint32(n[:], uint32(len(v)))
+		b = append(b, n[:]...)
+		b = append(b, v...)
+	}
+	return b
+}
+
+func TestDecodeBinaryRecord(t *testing.T) {
+	const pointOid = oid.Oid(16700)
+	point := appendBinaryRecord(nil, []oid.Oid{oid.T_int4, oid.T_int4},
+		[][]byte{{0, 0, 0, 1}, {0xff, 0xff, 0xff, 0xfe}})
+	src := appendBinaryRecord(nil,
+		[]oid.Oid{oid.T_text, oid.T_float8, oid.T_int8, pointOid, oid.T_int4, oid.T_int2, oid.T_timestamp},
+		[][]byte{
+			[]byte("pen"),
+			nil,
+			{0, 0, 0, 0, 0, 0, 0, 3},
+			point,
+			{0, 0, 0, 9},
+			nil,
+			{0, 0, 0, 0, 0, 0, 0, 0},
+		})
+	v, err := DecodeBinaryRecord(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := v.([]RecordField)
+	if len(fields) != 7 || fields[1].Value != nil || fields[3].Type != pointOid {
+		t.Fatalf("got %+v", fields)
+	}
+	// the fields don't refer to src
+	src[12] = 'x'
+	if string(fields[0].Value) != "pen" {
+		t.Errorf("got %q", fields[0].Value)
+	}
+
+	var it struct {
+		Name  string
+		Price *float64
+		Tags  int
+		At    compositePoint
+		X     string
+		Count sql.NullInt64
+		When  time.Time
+	}
+	if err := Composite(&it).Scan(v); err != nil {
+		t.Fatal(err)
+	}
+	if it.Name != "pen" || it.Price != nil || it.Tags != 3 || it.At != (compositePoint{1, -2}) ||
+		it.X != "9" || it.Count.Valid || !it.When.Equal(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %+v", it)
+	}
+
+	for _, src := range [][]byte{
+		{0, 0},
+		{0, 0, 0, 1},
+		{0, 0, 0, 1, 0, 0, 0, 23, 0, 0, 0, 4, 0},
+		append(appendBinaryRecord(nil, []oid.Oid{oid.T_int4}, [][]byte{nil}), 0),
+	} {
+		if _, err := DecodeBinaryRecord(src); err == nil {
+			t.Errorf("%v: expected an error", src)
+		}
+	}
+}
+
+func TestCompositeDB(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer txn.Rollback()
+	if _, err := txn.Exec("CREATE TYPE pg_temp.point2 AS (x int, y int)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := txn.Exec("CREATE TYPE pg_temp.item AS (name text, price float8, tags text[], at point2, note text)"); err != nil {
+		t.Fatal(err)
+	}
+
+	price := 2.5
+	in := struct {
+		Name  string
+		Price *float64
+		Tags  []string
+		At    compositePoint
+		Note  *string
+	}{`a "quoted", (odd) \ name`, &price, []string{"x", "y z", ""}, compositePoint{-1, 2}, nil}
+	out := in
+	out.Name, out.Price, out.Tags = "", nil, nil
+	if err := txn.QueryRow("SELECT $1::item", Composite(in)).Scan(Composite(&out)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %+v", out)
+	}
+
+	var s string
+	if err := txn.QueryRow("SELECT ROW(1, NULL, 'a b')").Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != `(1,,"a b")` {
+		t.Errorf("got %s", s)
+	}
+
+	// the binary format
+	defer resetTypeRegistry()
+	RegisterType("item", TypeCodec{DecodeBinary: DecodeBinaryRecord})
+	out.Name, out.Price, out.Tags = "", nil, nil
+	err = txn.QueryRow("SELECT ($1::text, $2::float8, NULL::text[], (3, 4)::point2, 'n')::item", in.Name, price).
+		Scan(Composite(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != in.Name || out.Price == nil || *out.Price != price || out.Tags != nil ||
+		out.At != (compositePoint{3, 4}) || out.Note == nil || *out.Note != "n" {
+		t.Errorf("got %+v", out)
+	}
+}
+
+func TestCompositeNested(t *testing.T) {
+	type inner struct {
+		A []int
+		B *compositePoint
+	}
+	var outer struct {
+		I  inner
+		Is []string
+	}
+	v, err := Composite(struct {
+		I  inner
+		Is []string
+	}{inner{[]int{1, 2}, &compositePoint{5, 6}}, []string{`(1,"2")`}}).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `("(""{1,2}"",""(5,6)"")","{""(1,\\""2\\"")""}")`; v != want {
+		t.Errorf("got %s, want %s", v, want)
+	}
+	if err := Composite(&outer).Scan(v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(outer.I.A, []int{1, 2}) || outer.I.B == nil || *outer.I.B != (compositePoint{5, 6}) ||
+		!reflect.DeepEqual(outer.Is, []string{`(1,"2")`}) {
+		t.Errorf("got %+v", outer)
+	}
+}
@@ -0,0 +1,264 @@
+package pq
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config describes how to connect to a PostgreSQL server.  A Config is usually
+// created from a connection string by ParseConfig, and can then be adjusted
+// before it is passed to NewConnector.
+type Config struct {
+	// The hosts and ports to connect to.  Like the host and port connection
+	// parameters, these can be comma-separated lists of several hosts, which
+	// are tried in order.
+	Host string
+	Port string
+
+	User     string
+	Password string
+	Database string
+
+	// Run-time parameters, such as search_path or application_name, which
+	// are sent to the server when a connection is established.
+	RuntimeParams map[string]string
+
+	// If not nil, TLSConfig is used for SSL connections in place of the
+	// configuration derived from the sslmode, sslcert, sslkey and sslrootcert
+	// parameters.  Whether SSL is used is still decided by sslmode.
+	TLSConfig *tls.Config
+
+	// The Dialer used to connect to the server.  If nil, net.Dial is used.
+	Dialer Dialer
+
+	// The maximum wait for a connection to be established.  Zero means wait
+	// indefinitely.
+	ConnectTimeout time.Duration
+
+	// If not nil, NoticeHandler is the notice handler of every connection
+	// established with the Config, as if set with SetNoticeHandler.  It may be
+	// called concurrently for different connections.
+	NoticeHandler func(*Error)
+
+	// the remaining parameters, such as sslmode, which are handled by the
+	// driver
+	opts values
+}
+
+// ParseConfig parses a connection string or URL, as accepted by Open, into a
+// Config.  Like Open, it applies the defaults from the environment and from
+// the connection service file.
+func ParseConfig(name string) (_ *Config, err error) {
+	// parseEnviron panics on unsupported environment variables
+	defer errRecoverNoErrBadConn(&err)
+
+	o := make(values)
+
+	// A number of defaults are applied here, in this order:
+	//
+	// * Very low precedence defaults applied in every situation
+	// * Environment variables
+	// * Parameters of the service, if one is named
+	// * Explicitly passed connection information
+	o.Set("host", "localhost")
+	o.Set("port", "5432")
+	// N.B.: Extra float digits should be set to 3, but that breaks
+	// Postgres 8.4 and older, where the max is 2.
+	o.Set("extra_float_digits", "2")
+	for k, v := range parseEnviron(os.Environ()) {
+		o.Set(k, v)
+	}
+
+	if strings.HasPrefix(name, "postgres://") || strings.HasPrefix(name, "postgresql://") {
+		name, err = ParseURL(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	explicit := make(values)
+	if err := parseOpts(name, explicit); err != nil {
+		return nil, err
+	}
+	// Parameters from a service file override the environment, but not the
+	// explicitly passed connection information.
+	service := explicit.Get("service")
+	if service == "" {
+		service = o.Get("service")
+	}
+	if service != "" {
+		if sf := explicit.Get("servicefile"); sf != "" {
+			o.Set("servicefile", sf)
+		}
+		opts, err := serviceOptions(service, o)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range opts {
+			o.Set(k, v)
+		}
+	}
+	for k, v := range explicit {
+		o.Set(k, v)
+	}
+
+	// Use the "fallback" application name if necessary
+	if fallback := o.Get("fallback_application_name"); fallback != "" {
+		if !o.Isset("application_name") {
+			o.Set("application_name", fallback)
+		}
+	}
+
+	return newConfig(o)
+}
+
+// newConfig sorts the connection parameters in o into the fields of a Config.
+func newConfig(o values) (*Config, error) {
+	cfg := &Config{
+		Host:          o.Get("host"),
+		Port:          o.Get("port"),
+		User:          o.Get("user"),
+		Password:      o.Get("password"),
+		Database:      o.Get("dbname"),
+		RuntimeParams: make(map[string]string),
+		Dialer:        defaultDialer{},
+		opts:          make(values),
+	}
+	if timeout := o.Get("connect_timeout"); timeout != "" {
+		seconds, err := strconv.ParseInt(timeout, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for parameter connect_timeout: %s", err)
+		}
+		cfg.ConnectTimeout = time.Duration(seconds) * time.Second
+	}
+	for k, v := range o {
+		switch k {
+		case "host", "port", "user", "password", "dbname", "connect_timeout":
+		default:
+			if isDriverSetting(k) {
+				cfg.opts[k] = v
+			} else {
+				cfg.RuntimeParams[k] = v
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// values returns the connection parameters described by cfg.
+func (cfg *Config) values() values {
+	o := make(values)
+	for k, v := range cfg.opts {
+		o[k] = v
+	}
+	for k, v := range cfg.RuntimeParams {
+		o[k] = v
+	}
+	set := func(k, v string) {
+		if v != "" {
+			o[k] = v
+		}
+	}
+	set("host", cfg.Host)
+	set("port", cfg.Port)
+	set("user", cfg.User)
+	set("password", cfg.Password)
+	set("dbname", cfg.Database)
+	return o
+}
+
+func (cfg *Config) dialer() Dialer {
+	if cfg.Dialer == nil {
+		return defaultDialer{}
+	}
+	return cfg.Dialer
+}
+
+// copy returns a copy of cfg which doesn't share its maps.
+func (cfg *Config) copy() *Config {
+	c := *cfg
+	c.RuntimeParams = make(map[string]string, len(cfg.RuntimeParams))
+	for k, v := range cfg.RuntimeParams {
+		c.RuntimeParams[k] = v
+	}
+	c.opts = make(values, len(cfg.opts))
+	for k, v := range cfg.opts {
+		c.opts[k] = v
+	}
+	return &c
+}
+
+// open establishes a connection as described by cfg, waiting at most timeout
+// for it if timeout is not zero.  If done is not nil, open gives up once it is
+// closed.
+func (cfg *Config) open(timeout time.Duration, done <-chan struct{}) (_ *conn, err error) {
+	// Handle any panics during connection initialization.  Note that we
+	// specifically do *not* want to use errRecover(), as that would turn any
+	// connection errors into ErrBadConns, hiding the real error message from
+	// the user.
+	defer errRecoverNoErrBadConn(&err)
+
+	o := cfg.values()
+
+	if !o.Isset("extra_float_digits") {
+		o.Set("extra_float_digits", "2")
+	}
+
+	// We can't work with any client_encoding other than UTF-8 currently.
+	// However, we have historically allowed the user to set it to UTF-8
+	// explicitly, and there's no reason to break such programs, so allow that.
+	// Note that the "options" setting could also set client_encoding, but
+	// parsing its value is not worth it.  Instead, we always explicitly send
+	// client_encoding as a separate run-time parameter, which should override
+	// anything set in options.
+	if enc := o.Get("client_encoding"); enc != "" && !isUTF8(enc) {
+		return nil, errors.New("client_encoding must be absent or 'UTF8'")
+	}
+	o.Set("client_encoding", "UTF8")
+	// DateStyle needs a similar treatment.
+	if datestyle := o.Get("datestyle"); datestyle != "" {
+		if datestyle != "ISO, MDY" {
+			panic(fmt.Sprintf("setting datestyle must be absent or %v; got %v",
+				"ISO, MDY", datestyle))
+		}
+	} else {
+		o.Set("datestyle", "ISO, MDY")
+	}
+
+	// If a user is not provided by any other means, the last
+	// resort is to use the current operating system provided user
+	// name.
+	if o.Get("user") == "" {
+		u, err := userCurrent()
+		if err != nil {
+			return nil, err
+		}
+		o.Set("user", u)
+	}
+
+	switch tsa := o.Get("target_session_attrs"); tsa {
+	case "", "any", "read-write":
+	default:
+		return nil, fmt.Errorf(`pq: unsupported target_session_attrs %q; only "any" (default) and "read-write" supported`, tsa)
+	}
+
+	hosts, err := splitHosts(o)
+	if err != nil {
+		return nil, err
+	}
+	// Try each host in turn, and report the error from the last one if none
+	// of them work out.
+	for _, ho := range hosts {
+		var cn *conn
+		cn, err = dialHost(cfg, ho, timeout, done)
+		if err == nil {
+			return cn, nil
+		}
+	}
+	return nil, err
+}
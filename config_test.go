@@ -0,0 +1,73 @@
+package pq
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig("host=a,b port=1,2 user=pqgotest password=pencil dbname=configtest connect_timeout=7 search_path=x sslmode=verify-full fallback_application_name=fallback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "a,b" || cfg.Port != "1,2" {
+		t.Errorf("got host %q and port %q", cfg.Host, cfg.Port)
+	}
+	if cfg.User != "pqgotest" || cfg.Password != "pencil" || cfg.Database != "configtest" {
+		t.Errorf("got user %q, password %q and database %q", cfg.User, cfg.Password, cfg.Database)
+	}
+	if cfg.ConnectTimeout != 7*time.Second {
+		t.Errorf("got connect timeout %v", cfg.ConnectTimeout)
+	}
+	want := map[string]string{
+		"search_path":        "x",
+		"application_name":   "fallback",
+		"extra_float_digits": "2",
+	}
+	for k, v := range want {
+		if cfg.RuntimeParams[k] != v {
+			t.Errorf("got run-time parameter %s %q, want %q", k, cfg.RuntimeParams[k], v)
+		}
+	}
+	for _, k := range []string{"sslmode", "host", "user", "dbname", "connect_timeout"} {
+		if _, ok := cfg.RuntimeParams[k]; ok {
+			t.Errorf("%s among the run-time parameters", k)
+		}
+	}
+	if cfg.opts.Get("sslmode") != "verify-full" {
+		t.Errorf("got sslmode %q", cfg.opts.Get("sslmode"))
+	}
+
+	cfg, err = ParseConfig("postgres://pqgotest@a:1/configtest?connect_timeout=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "a" || cfg.Port != "1" || cfg.User != "pqgotest" || cfg.Database != "configtest" || cfg.ConnectTimeout != 3*time.Second {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	if _, err := ParseConfig("connect_timeout=soon"); err == nil {
+		t.Error("expected an error for an invalid connect_timeout")
+	}
+}
+
+func TestConfigValues(t *testing.T) {
+	cfg := &Config{
+		Host:          "db",
+		User:          "pqgotest",
+		Database:      "configtest",
+		RuntimeParams: map[string]string{"search_path": "x"},
+		opts:          values{"sslmode": "disable"},
+	}
+	want := values{
+		"host":        "db",
+		"user":        "pqgotest",
+		"dbname":      "configtest",
+		"search_path": "x",
+		"sslmode":     "disable",
+	}
+	if o := cfg.values(); !reflect.DeepEqual(o, want) {
+		t.Errorf("got %v, want %v", o, want)
+	}
+}
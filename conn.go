@@ -3,6 +3,8 @@ package pq
 import (
 	"bufio"
 	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
@@ -23,6 +25,7 @@ import (
 	"unicode"
 
 	"github.com/lib/pq/oid"
+	"github.com/lib/pq/scram"
 )
 
 // Common error types
@@ -52,6 +55,18 @@ type parameterStatus struct {
 	// the current location based on the TimeZone value of the session, if
 	// available
 	currentLocation *time.Location
+
+	// whether the server stores timestamps as floating point numbers of
+	// seconds instead of integers of microseconds (integer_datetimes is off)
+	floatDatetimes bool
+
+	// the session's IntervalStyle, which determines the text format of
+	// intervals, or "" if unknown
+	intervalStyle string
+
+	// the codecs of the types registered with RegisterType and
+	// RegisterTypeOID, by their OIDs in the connection's database
+	types map[oid.Oid]*TypeCodec
 }
 
 type transactionStatus byte
@@ -103,6 +118,23 @@ type conn struct {
 	saveMessageType   byte
 	saveMessageBuffer []byte
 
+	// The configuration and options this connection was established with,
+	// and the process ID and secret key reported by the server in
+	// BackendKeyData.  These are needed to send a CancelRequest over a
+	// separate connection.
+	cfg       *Config
+	opts      values
+	processID int
+	secretKey int
+
+	// If set, this function must be called when the current transaction
+	// ends; see BeginTx.
+	txnFinish func()
+
+	// If set, NoticeResponses received on this connection are passed to this
+	// function; see SetNoticeHandler.
+	noticeHandler func(*Error)
+
 	// If true, this connection is bad and all public-facing functions should
 	// return ErrBadConn.
 	bad bool
@@ -111,6 +143,18 @@ type conn struct {
 	// receiving query results from prepared statements.  Only provided for
 	// debugging.
 	disablePreparedBinaryResult bool
+
+	// If set, this connection always sends the parameters of prepared
+	// statements in the text format.
+	disableBinaryParameters bool
+
+	// If set, Query and Exec use named prepared statements from this cache;
+	// see the statement_cache_capacity setting.
+	stmtCache *stmtCache
+
+	// The version of the registry of types which parameterStatus.types was
+	// built from; see resolveTypes.
+	typesVersion int
 }
 
 // Handle driver-side settings in parsed connection string.
@@ -122,7 +166,7 @@ func (c *conn) handleDriverSettings(o values) (err error) {
 			} else if value == "no" {
 				*val = false
 			} else {
-				return fmt.Errorf("unrecognized value %q for disable_prepared_binary_result", value)
+				return fmt.Errorf("unrecognized value %q for %s", value, key)
 			}
 		}
 		return nil
@@ -132,6 +176,20 @@ func (c *conn) handleDriverSettings(o values) (err error) {
 	if err != nil {
 		return err
 	}
+	err = boolSetting("disable_binary_parameters", &c.disableBinaryParameters)
+	if err != nil {
+		return err
+	}
+
+	if value := o.Get("statement_cache_capacity"); value != "" {
+		capacity, err := strconv.Atoi(value)
+		if err != nil || capacity < 0 {
+			return fmt.Errorf("invalid value %q for statement_cache_capacity", value)
+		}
+		if capacity > 0 {
+			c.stmtCache = newStmtCache(capacity)
+		}
+	}
 	return nil
 }
 
@@ -148,119 +206,156 @@ func Open(name string) (_ driver.Conn, err error) {
 }
 
 func DialOpen(d Dialer, name string) (_ driver.Conn, err error) {
-	// Handle any panics during connection initialization.  Note that we
-	// specifically do *not* want to use errRecover(), as that would turn any
-	// connection errors into ErrBadConns, hiding the real error message from
-	// the user.
-	defer errRecoverNoErrBadConn(&err)
-
-	o := make(values)
-
-	// A number of defaults are applied here, in this order:
-	//
-	// * Very low precedence defaults applied in every situation
-	// * Environment variables
-	// * Explicitly passed connection information
-	o.Set("host", "localhost")
-	o.Set("port", "5432")
-	// N.B.: Extra float digits should be set to 3, but that breaks
-	// Postgres 8.4 and older, where the max is 2.
-	o.Set("extra_float_digits", "2")
-	for k, v := range parseEnviron(os.Environ()) {
-		o.Set(k, v)
+	cfg, err := ParseConfig(name)
+	if err != nil {
+		return nil, err
 	}
-
-	if strings.HasPrefix(name, "postgres://") || strings.HasPrefix(name, "postgresql://") {
-		name, err = ParseURL(name)
-		if err != nil {
-			return nil, err
-		}
+	cfg.Dialer = d
+	cn, err := cfg.open(cfg.ConnectTimeout, nil)
+	if err != nil {
+		return nil, err
 	}
+	return cn, nil
+}
 
-	if err := parseOpts(name, o); err != nil {
-		return nil, err
+// splitHosts splits the comma-separated lists of hosts and ports in o into a
+// copy of o for each host, in the order in which the hosts should be tried.
+// Like in libpq, a single port applies to every host, and empty entries stand
+// for the default host or port.
+func splitHosts(o values) ([]values, error) {
+	hosts := strings.Split(o.Get("host"), ",")
+	ports := strings.Split(o.Get("port"), ",")
+	if len(ports) != 1 && len(ports) != len(hosts) {
+		return nil, fmt.Errorf("pq: could not match %d port numbers to %d hosts", len(ports), len(hosts))
 	}
 
-	// Use the "fallback" application name if necessary
-	if fallback := o.Get("fallback_application_name"); fallback != "" {
-		if !o.Isset("application_name") {
-			o.Set("application_name", fallback)
+	list := make([]values, len(hosts))
+	for i, host := range hosts {
+		port := ports[0]
+		if len(ports) > 1 {
+			port = ports[i]
+		}
+		if host == "" {
+			host = "localhost"
+		}
+		if port == "" {
+			port = "5432"
+		}
+
+		ho := make(values, len(o))
+		for k, v := range o {
+			ho[k] = v
 		}
+		ho.Set("host", host)
+		ho.Set("port", port)
+		list[i] = ho
 	}
+	return list, nil
+}
 
-	// We can't work with any client_encoding other than UTF-8 currently.
-	// However, we have historically allowed the user to set it to UTF-8
-	// explicitly, and there's no reason to break such programs, so allow that.
-	// Note that the "options" setting could also set client_encoding, but
-	// parsing its value is not worth it.  Instead, we always explicitly send
-	// client_encoding as a separate run-time parameter, which should override
-	// anything set in options.
-	if enc := o.Get("client_encoding"); enc != "" && !isUTF8(enc) {
-		return nil, errors.New("client_encoding must be absent or 'UTF8'")
+// dialHost establishes a connection to the single server described by o,
+// which was derived from cfg.
+func dialHost(cfg *Config, o values, timeout time.Duration, done <-chan struct{}) (*conn, error) {
+	if o.Get("sslmode") != "allow" {
+		return dialHostSSLMode(cfg, o, timeout, done)
 	}
-	o.Set("client_encoding", "UTF8")
-	// DateStyle needs a similar treatment.
-	if datestyle := o.Get("datestyle"); datestyle != "" {
-		if datestyle != "ISO, MDY" {
-			panic(fmt.Sprintf("setting datestyle must be absent or %v; got %v",
-				"ISO, MDY", datestyle))
+	// Try without SSL first, and only if the server rejects the connection
+	// (for instance because pg_hba.conf requires hostssl) try again with SSL.
+	withMode := func(mode string) values {
+		mo := make(values, len(o))
+		for k, v := range o {
+			mo[k] = v
 		}
-	} else {
-		o.Set("datestyle", "ISO, MDY")
+		mo.Set("sslmode", mode)
+		return mo
+	}
+	cn, err := dialHostSSLMode(cfg, withMode("disable"), timeout, done)
+	if _, ok := err.(*Error); ok {
+		cn, err = dialHostSSLMode(cfg, withMode("require"), timeout, done)
 	}
+	return cn, err
+}
 
-	// If a user is not provided by any other means, the last
-	// resort is to use the current operating system provided user
-	// name.
-	if o.Get("user") == "" {
-		u, err := userCurrent()
-		if err != nil {
-			return nil, err
-		} else {
-			o.Set("user", u)
+// dialHostSSLMode establishes a connection to the server described by o,
+// whose sslmode must not be "allow".
+func dialHostSSLMode(cfg *Config, o values, timeout time.Duration, done <-chan struct{}) (_ *conn, err error) {
+	cn := &conn{cfg: cfg, opts: o, noticeHandler: cfg.NoticeHandler}
+	defer func() {
+		if err != nil && cn.c != nil {
+			cn.c.Close()
 		}
-	}
+	}()
+	var stopWatch func() bool
+	defer func() {
+		if stopWatch != nil && stopWatch() {
+			err = errConnectCanceled
+		}
+	}()
+	defer errRecoverNoErrBadConn(&err)
 
-	cn := &conn{}
 	err = cn.handleDriverSettings(o)
 	if err != nil {
 		return nil, err
 	}
+	if o.Get("password") == "" {
+		if pw := passfilePassword(o); pw != "" {
+			o.Set("password", pw)
+		}
+	}
 
-	cn.c, err = dial(d, o)
+	cn.c, err = dialDone(cfg.dialer(), o, timeout, done)
 	if err != nil {
 		return nil, err
 	}
+	if done != nil {
+		stopWatch = watchDone(cn.c, done)
+	}
 	cn.ssl(o)
 	cn.buf = bufio.NewReader(cn.c)
 	cn.startup(o)
+	if o.Get("target_session_attrs") == "read-write" && cn.isReadOnly() {
+		_, addr := network(o)
+		return nil, fmt.Errorf("pq: server at %s is read-only, but target_session_attrs is read-write", addr)
+	}
 	// reset the deadline, in case one was set (see dial)
-	if timeout := o.Get("connect_timeout"); timeout != "" && timeout != "0" {
+	if timeout > 0 {
 		err = cn.c.SetDeadline(time.Time{})
 	}
 	return cn, err
 }
 
-func dial(d Dialer, o values) (net.Conn, error) {
+// isReadOnly reports whether the server only accepts read-only transactions,
+// which is the case for hot standby servers.
+func (cn *conn) isReadOnly() bool {
+	rows, err := cn.simpleQuery("SHOW transaction_read_only")
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil {
+		panic(err)
+	}
+	v, _ := dest[0].([]byte)
+	return string(v) == "on"
+}
+
+func dial(d Dialer, o values, timeout time.Duration) (net.Conn, error) {
 	ntw, addr := network(o)
 	// SSL is not necessary or supported over UNIX domain sockets
 	if ntw == "unix" {
 		o["sslmode"] = "disable"
 	}
 
-	// Zero or not specified means wait indefinitely.
-	if timeout := o.Get("connect_timeout"); timeout != "" && timeout != "0" {
-		seconds, err := strconv.ParseInt(timeout, 10, 0)
-		if err != nil {
-			return nil, fmt.Errorf("invalid value for parameter connect_timeout: %s", err)
-		}
-		duration := time.Duration(seconds) * time.Second
+	// Zero means wait indefinitely.
+	if timeout > 0 {
 		// connect_timeout should apply to the entire connection establishment
 		// procedure, so we both use a timeout for the TCP connection
 		// establishment and set a deadline for doing the initial handshake.
 		// The deadline is then reset after startup() is done.
-		deadline := time.Now().Add(duration)
-		conn, err := d.DialTimeout(ntw, addr, duration)
+		deadline := time.Now().Add(timeout)
+		conn, err := d.DialTimeout(ntw, addr, timeout)
 		if err != nil {
 			return nil, err
 		}
@@ -270,6 +365,68 @@ func dial(d Dialer, o values) (net.Conn, error) {
 	return d.Dial(ntw, addr)
 }
 
+// errConnectCanceled is the error of a connection attempt abandoned because
+// its done channel was closed.
+var errConnectCanceled = errors.New("pq: connection attempt canceled")
+
+// dialDone is dial, except that it gives up once done is closed, if done is
+// not nil.
+func dialDone(d Dialer, o values, timeout time.Duration, done <-chan struct{}) (net.Conn, error) {
+	if done == nil {
+		return dial(d, o, timeout)
+	}
+	select {
+	case <-done:
+		return nil, errConnectCanceled
+	default:
+	}
+
+	type result struct {
+		c   net.Conn
+		err error
+	}
+	dialed := make(chan result, 1)
+	go func() {
+		c, err := dial(d, o, timeout)
+		dialed <- result{c, err}
+	}()
+	select {
+	case r := <-dialed:
+		return r.c, r.err
+	case <-done:
+		// The Dialer can't be interrupted; close the connection it
+		// eventually returns.
+		go func() {
+			if r := <-dialed; r.c != nil {
+				r.c.Close()
+			}
+		}()
+		return nil, errConnectCanceled
+	}
+}
+
+// watchDone closes c if done is closed before the returned function is
+// called, which makes the reads and writes of the connection attempt fail.
+// The returned function reports whether c was closed.
+func watchDone(c net.Conn, done <-chan struct{}) func() bool {
+	finished := make(chan struct{})
+	closed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-done:
+			c.Close()
+			closed <- true
+		case <-finished:
+			closed <- false
+		}
+	}()
+
+	return func() bool {
+		close(finished)
+		return <-closed
+	}
+}
+
 func network(o values) (string, string) {
 	host := o.Get("host")
 
@@ -278,7 +435,7 @@ func network(o values) (string, string) {
 		return "unix", sockPath
 	}
 
-	return "tcp", host + ":" + o.Get("port")
+	return "tcp", net.JoinHostPort(host, o.Get("port"))
 }
 
 type values map[string]string
@@ -420,13 +577,23 @@ func (cn *conn) checkIsInTransaction(intxn bool) {
 }
 
 func (cn *conn) Begin() (_ driver.Tx, err error) {
+	return cn.begin("")
+}
+
+// begin starts a transaction, appending mode (which should start with a
+// space if not empty) to the BEGIN statement.
+func (cn *conn) begin(mode string) (_ driver.Tx, err error) {
 	if cn.bad {
 		return nil, driver.ErrBadConn
 	}
 	defer cn.errRecover(&err)
 
 	cn.checkIsInTransaction(false)
-	_, commandTag, err := cn.simpleExec("BEGIN")
+	// The registered types can't be looked up once the transaction starts.
+	if err := cn.resolveTypes(); err != nil {
+		return nil, err
+	}
+	_, commandTag, err := cn.simpleExec("BEGIN" + mode)
 	if err != nil {
 		return nil, err
 	}
@@ -441,7 +608,16 @@ func (cn *conn) Begin() (_ driver.Tx, err error) {
 	return cn, nil
 }
 
+// closeTxn calls txnFinish, if set.
+func (cn *conn) closeTxn() {
+	if finish := cn.txnFinish; finish != nil {
+		cn.txnFinish = nil
+		finish()
+	}
+}
+
 func (cn *conn) Commit() (err error) {
+	defer cn.closeTxn()
 	if cn.bad {
 		return driver.ErrBadConn
 	}
@@ -477,6 +653,7 @@ func (cn *conn) Commit() (err error) {
 }
 
 func (cn *conn) Rollback() (err error) {
+	defer cn.closeTxn()
 	if cn.bad {
 		return driver.ErrBadConn
 	}
@@ -530,7 +707,9 @@ func (cn *conn) simpleExec(q string) (res driver.Result, commandTag string, err
 func (cn *conn) simpleQuery(q string) (res *rows, err error) {
 	defer cn.errRecover(&err)
 
-	st := &stmt{cn: cn, name: ""}
+	if err := cn.resolveTypes(); err != nil {
+		return nil, err
+	}
 
 	b := cn.writeBuf('Q')
 	b.string(q)
@@ -540,20 +719,26 @@ func (cn *conn) simpleQuery(q string) (res *rows, err error) {
 		t, r := cn.recv1()
 		switch t {
 		case 'C', 'I':
-			// We allow queries which don't return any results through Query as
-			// well as Exec.  We still have to give database/sql a rows object
-			// the user can close, though, to avoid connections from being
-			// leaked.  A "rows" with done=true works fine for that purpose.
 			if err != nil {
 				cn.bad = true
 				errorf("unexpected message %q in simple query execution", t)
 			}
-			res = &rows{
-				cn:      cn,
-				cols:    st.cols,
-				rowTyps: st.rowTyps,
-				rowFmts: st.rowFmts,
-				done:    true,
+			if res != nil && !res.done {
+				// The first result set is empty; the rest of the results,
+				// if any, are read by Next.
+				if t == 'C' {
+					res.tag = r.string()
+				}
+				return
+			}
+			// We allow queries which don't return any results through Query as
+			// well as Exec.  We still have to give database/sql a rows object
+			// the user can close, though, to avoid connections from being
+			// leaked.  A "rows" with done=true works fine for that purpose.
+			// It's replaced if a later statement returns rows.
+			res = &rows{cn: cn, done: true}
+			if t == 'C' {
+				res.tag = r.string()
 			}
 		case 'Z':
 			cn.processReadyForQuery(r)
@@ -573,8 +758,7 @@ func (cn *conn) simpleQuery(q string) (res *rows, err error) {
 		case 'T':
 			// res might be non-nil here if we received a previous
 			// CommandComplete, but that's fine; just overwrite it
-			res = &rows{cn: cn}
-			res.cols, res.rowFmts, res.rowTyps = parseMeta(r)
+			res = &rows{cn: cn, rowsHeader: parseMeta(r)}
 
 			// To work around a bug in QueryRow in Go 1.2 and earlier, wait
 			// until the first DataRow has been received.
@@ -587,7 +771,7 @@ func (cn *conn) simpleQuery(q string) (res *rows, err error) {
 
 // Decides which column formats to use for a prepared statement.  The input is
 // an array of type oids, one element per result column.
-func decideColumnFormats(rowTyps []oid.Oid, forceText bool) (rowFmts []format, rowFmtData []byte) {
+func decideColumnFormats(parameterStatus *parameterStatus, rowTyps []oid.Oid, forceText bool) (rowFmts []format, rowFmtData []byte) {
 	if len(rowTyps) == 0 {
 		return nil, rowFmtDataAllText
 	}
@@ -600,21 +784,20 @@ func decideColumnFormats(rowTyps []oid.Oid, forceText bool) (rowFmts []format, r
 	allBinary := true
 	allText := true
 	for i, o := range rowTyps {
-		switch o {
-		// This is the list of types to use binary mode for when receiving them
-		// through a prepared statement.  If a type appears in this list, it
-		// must also be implemented in binaryDecode in encode.go.
-		case oid.T_bytea:
-			fallthrough
-		case oid.T_int8:
-			fallthrough
-		case oid.T_int4:
-			fallthrough
-		case oid.T_int2:
+		// The types to use binary mode for when receiving them through a
+		// prepared statement are those binaryDecode in encode.go implements,
+		// or whose registered TypeCodec can decode the binary format.
+		if c := parameterStatus.types[o]; c != nil && (c.DecodeText != nil || c.DecodeBinary != nil) {
+			if c.DecodeBinary != nil {
+				rowFmts[i] = formatBinary
+				allText = false
+			} else {
+				allBinary = false
+			}
+		} else if d, ok := binaryDecoders[o]; ok && (d.usable == nil || d.usable(parameterStatus)) {
 			rowFmts[i] = formatBinary
 			allText = false
-
-		default:
+		} else {
 			allBinary = false
 		}
 	}
@@ -634,6 +817,9 @@ func decideColumnFormats(rowTyps []oid.Oid, forceText bool) (rowFmts []format, r
 }
 
 func (cn *conn) prepareTo(q, stmtName string) (_ *stmt, err error) {
+	if err := cn.resolveTypes(); err != nil {
+		return nil, err
+	}
 	st := &stmt{cn: cn, name: stmtName}
 
 	b := cn.writeBuf('P')
@@ -660,8 +846,8 @@ func (cn *conn) prepareTo(q, stmtName string) (_ *stmt, err error) {
 				st.paramTyps[i] = r.oid()
 			}
 		case 'T':
-			st.cols, st.rowTyps = parseStatementRowDescribe(r)
-			st.rowFmts, st.rowFmtData = decideColumnFormats(st.rowTyps, cn.disablePreparedBinaryResult)
+			st.cols, st.rowTyps, st.fields = parseStatementRowDescribe(r)
+			st.rowFmts, st.rowFmtData = decideColumnFormats(&cn.parameterStatus, st.rowTyps, cn.disablePreparedBinaryResult)
 		case 'n':
 			// no data
 			st.rowFmtData = rowFmtDataAllText
@@ -706,7 +892,15 @@ func (cn *conn) Close() (err error) {
 }
 
 // Implement the "Queryer" interface
-func (cn *conn) Query(query string, args []driver.Value) (_ driver.Rows, err error) {
+func (cn *conn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	r, err := cn.query(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (cn *conn) query(query string, args []driver.Value) (_ *rows, err error) {
 	if cn.bad {
 		return nil, driver.ErrBadConn
 	}
@@ -718,17 +912,22 @@ func (cn *conn) Query(query string, args []driver.Value) (_ driver.Rows, err err
 		return cn.simpleQuery(query)
 	}
 
-	st, err := cn.prepareTo(query, "")
-	if err != nil {
-		panic(err)
+	var st *stmt
+	if cn.stmtCache != nil {
+		cn.withCachedStmt(query, func(cst *stmt) {
+			cst.exec(args)
+			st = cst
+		})
+	} else {
+		st, err = cn.prepareTo(query, "")
+		if err != nil {
+			panic(err)
+		}
+		st.exec(args)
 	}
-
-	st.exec(args)
 	return &rows{
-		cn:      cn,
-		cols:    st.cols,
-		rowTyps: st.rowTyps,
-		rowFmts: st.rowFmts,
+		cn:         cn,
+		rowsHeader: st.rowsHeader,
 	}, nil
 }
 
@@ -747,6 +946,17 @@ func (cn *conn) Exec(query string, args []driver.Value) (_ driver.Result, err er
 		return r, err
 	}
 
+	if cn.stmtCache != nil {
+		var r driver.Result
+		cn.withCachedStmt(query, func(st *stmt) {
+			r, err = st.Exec(args)
+			if err != nil {
+				panic(err)
+			}
+		})
+		return r, nil
+	}
+
 	// Use the unnamed statement to defer planning until bind
 	// time, or else value-based selectivity estimates cannot be
 	// used.
@@ -841,8 +1051,8 @@ func (cn *conn) recvMessage(r *readBuf) (byte, error) {
 
 // recv receives a message from the backend, but if an error happened while
 // reading the message or the received message was an ErrorResponse, it panics.
-// NoticeResponses are ignored.  This function should generally be used only
-// during the startup sequence.
+// NoticeResponses are passed to the notice handler.  This function should
+// generally be used only during the startup sequence.
 func (cn *conn) recv() (t byte, r *readBuf) {
 	for {
 		var err error
@@ -856,7 +1066,7 @@ func (cn *conn) recv() (t byte, r *readBuf) {
 		case 'E':
 			panic(parseError(r))
 		case 'N':
-			// ignore
+			cn.processNotice(r)
 		default:
 			return
 		}
@@ -873,8 +1083,10 @@ func (cn *conn) recv1Buf(r *readBuf) byte {
 		}
 
 		switch t {
-		case 'A', 'N':
+		case 'A':
 			// ignore
+		case 'N':
+			cn.processNotice(r)
 		case 'S':
 			cn.processParameterStatus(r)
 		default:
@@ -885,7 +1097,7 @@ func (cn *conn) recv1Buf(r *readBuf) byte {
 
 // recv1 receives a message from the backend, panicking if an error occurs
 // while attempting to read it.  All asynchronous messages are ignored, with
-// the exception of ErrorResponse.
+// the exception of ErrorResponse and NoticeResponse.
 func (cn *conn) recv1() (t byte, r *readBuf) {
 	r = &readBuf{}
 	t = cn.recv1Buf(r)
@@ -895,8 +1107,9 @@ func (cn *conn) recv1() (t byte, r *readBuf) {
 func (cn *conn) ssl(o values) {
 	verifyCaOnly := false
 	tlsConf := tls.Config{}
-	switch mode := o.Get("sslmode"); mode {
-	case "require", "":
+	mode := o.Get("sslmode")
+	switch mode {
+	case "require", "prefer", "":
 		tlsConf.InsecureSkipVerify = true
 	case "verify-ca":
 		// We must skip TLS's own verification since it requires full
@@ -908,11 +1121,18 @@ func (cn *conn) ssl(o values) {
 	case "disable":
 		return
 	default:
-		errorf(`unsupported sslmode %q; only "require" (default), "verify-full", and "disable" supported`, mode)
+		errorf(`unsupported sslmode %q; only "require" (default), "verify-full", "verify-ca", "prefer", "allow" and "disable" supported`, mode)
 	}
 
-	cn.setupSSLClientCertificates(&tlsConf, o)
-	cn.setupSSLCA(&tlsConf, o)
+	conf := &tlsConf
+	if cn.cfg != nil && cn.cfg.TLSConfig != nil {
+		// The application's configuration replaces the one derived from the
+		// connection parameters.
+		conf, verifyCaOnly = cn.cfg.TLSConfig, false
+	} else {
+		cn.setupSSLClientCertificates(&tlsConf, o)
+		cn.setupSSLCA(&tlsConf, o)
+	}
 
 	w := cn.writeBuf(0)
 	w.int32(80877103)
@@ -925,12 +1145,16 @@ func (cn *conn) ssl(o values) {
 	}
 
 	if b[0] != 'S' {
+		if mode == "prefer" {
+			// carry on without SSL
+			return
+		}
 		panic(ErrSSLNotSupported)
 	}
 
-	client := tls.Client(cn.c, &tlsConf)
+	client := tls.Client(cn.c, conf)
 	if verifyCaOnly {
-		cn.verifyCA(client, &tlsConf)
+		cn.verifyCA(client, conf)
 	}
 	cn.c = client
 }
@@ -1045,7 +1269,9 @@ func isDriverSetting(key string) bool {
 	switch key {
 	case "host", "port":
 		return true
-	case "password":
+	case "password", "passfile":
+		return true
+	case "service", "servicefile":
 		return true
 	case "sslmode", "sslcert", "sslkey", "sslrootcert":
 		return true
@@ -1053,7 +1279,11 @@ func isDriverSetting(key string) bool {
 		return true
 	case "connect_timeout":
 		return true
-	case "disable_prepared_binary_result":
+	case "target_session_attrs":
+		return true
+	case "disable_prepared_binary_result", "disable_binary_parameters":
+		return true
+	case "statement_cache_capacity":
 		return true
 
 	default:
@@ -1088,6 +1318,7 @@ func (cn *conn) startup(o values) {
 		t, r := cn.recv()
 		switch t {
 		case 'K':
+			cn.processBackendKeyData(r)
 		case 'S':
 			cn.processParameterStatus(r)
 		case 'R':
@@ -1132,11 +1363,127 @@ func (cn *conn) auth(r *readBuf, o values) {
 		if r.int32() != 0 {
 			errorf("unexpected authentication response: %q", t)
 		}
+	case 10:
+		cn.saslAuth(r, o)
 	default:
 		errorf("unknown authentication response: %d", code)
 	}
 }
 
+// saslAuth carries out SASL authentication, in response to an
+// AuthenticationSASL message whose body is in r.  SCRAM-SHA-256 is the only
+// supported mechanism; if the connection is using SSL and the server offers
+// SCRAM-SHA-256-PLUS, the exchange is bound to the server's certificate using
+// the tls-server-end-point channel binding type.
+func (cn *conn) saslAuth(r *readBuf, o values) {
+	var scramOffered, scramPlusOffered bool
+	for {
+		mechanism := r.string()
+		if mechanism == "" {
+			break
+		}
+		switch mechanism {
+		case "SCRAM-SHA-256":
+			scramOffered = true
+		case "SCRAM-SHA-256-PLUS":
+			scramPlusOffered = true
+		}
+	}
+
+	// The user name sent in the SCRAM exchange is ignored by the server, which
+	// uses the one from the startup packet instead; do what libpq does and
+	// leave it empty.
+	sc := scram.NewClient(sha256.New, "", o.Get("password"))
+	mechanism := "SCRAM-SHA-256"
+	if client, ok := cn.c.(*tls.Conn); ok {
+		cbind := tlsServerEndPoint(client)
+		if scramPlusOffered && cbind != nil {
+			mechanism = "SCRAM-SHA-256-PLUS"
+			sc.SetChannelBinding("tls-server-end-point", cbind)
+		} else if !scramPlusOffered {
+			sc.SetChannelBindingSupported()
+		}
+	}
+	if mechanism == "SCRAM-SHA-256" && !scramOffered {
+		errorf("none of the server's SASL authentication mechanisms are supported")
+	}
+
+	sc.Step(nil)
+	if sc.Err() != nil {
+		errorf("SCRAM-SHA-256 error: %s", sc.Err())
+	}
+	out := sc.Out()
+	w := cn.writeBuf('p')
+	w.string(mechanism)
+	w.int32(len(out))
+	w.bytes(out)
+	cn.send(w)
+
+	t, r := cn.recv()
+	if t != 'R' {
+		errorf("unexpected SASL response: %q", t)
+	}
+	if code := r.int32(); code != 11 {
+		errorf("unexpected authentication response during SASL exchange: %d", code)
+	}
+
+	sc.Step(r.next(len(*r)))
+	if sc.Err() != nil {
+		errorf("SCRAM-SHA-256 error: %s", sc.Err())
+	}
+	w = cn.writeBuf('p')
+	w.bytes(sc.Out())
+	cn.send(w)
+
+	t, r = cn.recv()
+	if t != 'R' {
+		errorf("unexpected SASL response: %q", t)
+	}
+	if code := r.int32(); code != 12 {
+		errorf("unexpected authentication response during SASL exchange: %d", code)
+	}
+
+	sc.Step(r.next(len(*r)))
+	if sc.Err() != nil {
+		errorf("SCRAM-SHA-256 error: %s", sc.Err())
+	}
+
+	t, r = cn.recv()
+	if t != 'R' {
+		errorf("unexpected SASL response: %q", t)
+	}
+	if r.int32() != 0 {
+		errorf("unexpected authentication response: %q", t)
+	}
+}
+
+// tlsServerEndPoint returns the channel binding data for the
+// tls-server-end-point channel binding type (RFC 5929), which is a hash of the
+// server's certificate.  It returns nil if the handshake has not produced a
+// certificate, or if its signature algorithm has no well-defined hash.
+func tlsServerEndPoint(client *tls.Conn) []byte {
+	certs := client.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+	cert := certs[0]
+	switch cert.SignatureAlgorithm {
+	case x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1,
+		x509.SHA256WithRSA, x509.DSAWithSHA256, x509.ECDSAWithSHA256, x509.SHA256WithRSAPSS:
+		// MD5 and SHA-1 are replaced by SHA-256 as per RFC 5929
+		h := sha256.Sum256(cert.Raw)
+		return h[:]
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384, x509.SHA384WithRSAPSS:
+		h := sha512.Sum384(cert.Raw)
+		return h[:]
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512, x509.SHA512WithRSAPSS:
+		h := sha512.Sum512(cert.Raw)
+		return h[:]
+	default:
+		return nil
+	}
+}
+
 type format int
 
 const formatText format = 0
@@ -1149,12 +1496,11 @@ var rowFmtDataAllBinary []byte = []byte{0, 1, 0, 1}
 var rowFmtDataAllText []byte = []byte{0, 0}
 
 type stmt struct {
-	cn         *conn
-	name       string
-	cols       []string
-	rowFmts    []format
+	cn       *conn
+	name     string
+	cacheKey string // the query text, for statements in the statement cache
+	rowsHeader
 	rowFmtData []byte
-	rowTyps    []oid.Oid
 	paramTyps  []oid.Oid
 	closed     bool
 }
@@ -1192,7 +1538,15 @@ func (st *stmt) Close() (err error) {
 	return nil
 }
 
-func (st *stmt) Query(v []driver.Value) (r driver.Rows, err error) {
+func (st *stmt) Query(v []driver.Value) (driver.Rows, error) {
+	r, err := st.query(v)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (st *stmt) query(v []driver.Value) (r *rows, err error) {
 	if st.cn.bad {
 		return nil, driver.ErrBadConn
 	}
@@ -1200,10 +1554,8 @@ func (st *stmt) Query(v []driver.Value) (r driver.Rows, err error) {
 
 	st.exec(v)
 	return &rows{
-		cn:      st.cn,
-		cols:    st.cols,
-		rowTyps: st.rowTyps,
-		rowFmts: st.rowFmts,
+		cn:         st.cn,
+		rowsHeader: st.rowsHeader,
 	}, nil
 }
 
@@ -1243,18 +1595,38 @@ func (st *stmt) exec(v []driver.Value) {
 		errorf("got %d parameters but the statement requires %d", len(v), len(st.paramTyps))
 	}
 
+	params := make([][]byte, len(v))
+	fmts := make([]format, len(v))
+	nulls := make([]bool, len(v))
+	anyBinary := false
+	for i, x := range v {
+		x = convertParameter(&st.cn.parameterStatus, x, st.paramTyps[i])
+		if x == nil {
+			nulls[i] = true
+			continue
+		}
+		params[i], fmts[i] = encodeParameter(&st.cn.parameterStatus, x, st.paramTyps[i], !st.cn.disableBinaryParameters)
+		anyBinary = anyBinary || fmts[i] == formatBinary
+	}
+
 	w := st.cn.writeBuf('B')
 	w.byte(0)
 	w.string(st.name)
-	w.int16(0)
+	if anyBinary {
+		w.int16(len(fmts))
+		for _, f := range fmts {
+			w.int16(int(f))
+		}
+	} else {
+		w.int16(0)
+	}
 	w.int16(len(v))
-	for i, x := range v {
-		if x == nil {
+	for i := range v {
+		if nulls[i] {
 			w.int32(-1)
 		} else {
-			b := encode(&st.cn.parameterStatus, x, st.paramTyps[i])
-			w.int32(len(b))
-			w.bytes(b)
+			w.int32(len(params[i]))
+			w.bytes(params[i])
 		}
 	}
 	w.bytes(st.rowFmtData)
@@ -1326,11 +1698,48 @@ func (st *stmt) NumInput() int {
 	return len(st.paramTyps)
 }
 
+// Result is the driver.Result of the statements executed by pq.  Besides the
+// number of rows affected, it holds the command tag reported by the server.
+//
+// database/sql wraps the results of Exec in a type of its own, so the
+// Result is only accessible when executing statements on a driver.Conn, for
+// instance one obtained with sql.Conn.Raw.
+type Result struct {
+	tag          string
+	command      string
+	rowsAffected int64
+}
+
+// LastInsertId is not supported; use a RETURNING clause instead.
+func (r Result) LastInsertId() (int64, error) {
+	return 0, errNoLastInsertID
+}
+
+// RowsAffected returns the number of rows affected by the statement, or zero
+// if its command tag doesn't include a number of rows.
+func (r Result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+// CommandTag returns the command tag, such as "INSERT 0 5" or "COPY 1000".
+func (r Result) CommandTag() string {
+	return r.tag
+}
+
+// Command returns the command that was executed, such as "INSERT" or
+// "CREATE TABLE"; this is the command tag without the number of rows.
+func (r Result) Command() string {
+	return r.command
+}
+
+var errNoLastInsertID = errors.New("LastInsertId is not supported by this driver")
+
 // parseComplete parses the "command tag" from a CommandComplete message, and
-// returns the number of rows affected (if applicable) and a string
-// identifying only the command that was executed, e.g. "ALTER TABLE".  If the
-// command tag could not be parsed, parseComplete panics.
-func (cn *conn) parseComplete(commandTag string) (driver.Result, string) {
+// returns a Result holding it and a string identifying only the command that
+// was executed, e.g. "ALTER TABLE".  If the command tag could not be parsed,
+// parseComplete panics.
+func (cn *conn) parseComplete(commandTag string) (Result, string) {
+	res := Result{tag: commandTag}
 	commandsWithAffectedRows := []string{
 		"SELECT ",
 		// INSERT is handled below
@@ -1363,35 +1772,58 @@ func (cn *conn) parseComplete(commandTag string) (driver.Result, string) {
 		affectedRows = &parts[len(parts)-1]
 		commandTag = "INSERT"
 	}
+	res.command = commandTag
 	// There should be no affected rows attached to the tag, just return it
 	if affectedRows == nil {
-		return driver.RowsAffected(0), commandTag
+		return res, commandTag
 	}
 	n, err := strconv.ParseInt(*affectedRows, 10, 64)
 	if err != nil {
 		cn.bad = true
 		errorf("could not parse commandTag: %s", err)
 	}
-	return driver.RowsAffected(n), commandTag
+	res.rowsAffected = n
+	return res, commandTag
 }
 
-type rows struct {
-	cn      *conn
+// rowsHeader describes the columns of a result set.
+type rowsHeader struct {
 	cols    []string
 	rowTyps []oid.Oid
 	rowFmts []format
-	done    bool
-	rb      readBuf
+	fields  []fieldDesc
+}
+
+type rows struct {
+	cn     *conn
+	finish func()
+	rowsHeader
+	// the command tag of the current result set, once it has been read
+	tag string
+	// the columns of the next result set of a multi-statement query, once
+	// its RowDescription has been read
+	next *rowsHeader
+	done bool
+	rb   readBuf
 }
 
 func (rs *rows) Close() error {
+	if finish := rs.finish; finish != nil {
+		rs.finish = nil
+		defer finish()
+	}
 	// no need to look at cn.bad as Next() will
 	for {
 		err := rs.Next(nil)
 		switch err {
 		case nil:
 		case io.EOF:
-			return nil
+			if rs.next == nil {
+				return nil
+			}
+			// The columns of the next result set have been read already, so
+			// this can't fail.
+			rs.NextResultSet()
 		default:
 			return err
 		}
@@ -1403,7 +1835,7 @@ func (rs *rows) Columns() []string {
 }
 
 func (rs *rows) Next(dest []driver.Value) (err error) {
-	if rs.done {
+	if rs.done || rs.next != nil {
 		return io.EOF
 	}
 
@@ -1418,8 +1850,19 @@ func (rs *rows) Next(dest []driver.Value) (err error) {
 		switch t {
 		case 'E':
 			err = parseError(&rs.rb)
-		case 'C', 'I':
+		case 'C':
+			// Only the first CommandComplete ends the current result set;
+			// any others are of statements which don't return rows.
+			if rs.tag == "" {
+				rs.tag = rs.rb.string()
+			}
+		case 'I':
 			continue
+		case 'T':
+			// the start of the next result set
+			next := parseMeta(&rs.rb)
+			rs.next = &next
+			return io.EOF
 		case 'Z':
 			conn.processReadyForQuery(&rs.rb)
 			rs.done = true
@@ -1447,6 +1890,31 @@ func (rs *rows) Next(dest []driver.Value) (err error) {
 	}
 }
 
+// HasNextResultSet reports whether another result set follows the current
+// one, which must have been read to the end.  Only multi-statement queries
+// sent without arguments return several result sets, one for each statement
+// which returns rows.
+func (rs *rows) HasNextResultSet() bool {
+	return rs.next != nil
+}
+
+// NextResultSet skips the remaining rows of the current result set, and
+// advances to the next one.
+func (rs *rows) NextResultSet() error {
+	for rs.next == nil {
+		if rs.done {
+			return io.EOF
+		}
+		if err := rs.Next(nil); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	rs.rowsHeader = *rs.next
+	rs.next = nil
+	rs.tag = ""
+	return nil
+}
+
 // QuoteIdentifier quotes an "identifier" (e.g. a table or a column name) to be
 // used as part of an SQL statement.  For example:
 //
@@ -1491,6 +1959,12 @@ func (c *conn) processParameterStatus(r *readBuf) {
 			c.parameterStatus.currentLocation = nil
 		}
 
+	case "integer_datetimes":
+		c.parameterStatus.floatDatetimes = r.string() == "off"
+
+	case "IntervalStyle":
+		c.parameterStatus.intervalStyle = r.string()
+
 	default:
 		// ignore
 	}
@@ -1500,32 +1974,87 @@ func (c *conn) processReadyForQuery(r *readBuf) {
 	c.txnStatus = transactionStatus(r.byte())
 }
 
-func parseStatementRowDescribe(r *readBuf) (cols []string, rowTyps []oid.Oid) {
+func (c *conn) processBackendKeyData(r *readBuf) {
+	c.processID = r.int32()
+	c.secretKey = r.int32()
+}
+
+// Cancel asks the server to cancel the query currently being executed on c,
+// which must be a connection returned by Open or DialOpen.  The request is
+// sent over a new connection, established with the same Dialer and SSL
+// settings as c.  If no query is being executed on c, the server does
+// nothing.
+//
+// Cancel is safe to call from a goroutine other than the one using c.  A nil
+// return value does not mean that the query was actually cancelled; if it
+// was, the caller of the query will receive an *Error with the
+// query_canceled error code.
+func Cancel(c driver.Conn) error {
+	cn, ok := c.(*conn)
+	if !ok {
+		return fmt.Errorf("pq: Cancel called with a connection of type %T", c)
+	}
+	return cn.cancel()
+}
+
+// cancelTimeout limits how long cancel waits for the server, if no
+// connect_timeout is set.
+var cancelTimeout = 10 * time.Second
+
+func (cn *conn) cancel() (err error) {
+	defer errRecoverNoErrBadConn(&err)
+
+	// The deadline dial sets also covers waiting for the server to close the
+	// connection below, which a stalled server or proxy might never do.
+	timeout := cn.cfg.ConnectTimeout
+	if timeout <= 0 {
+		timeout = cancelTimeout
+	}
+	c, err := dial(cn.cfg.dialer(), cn.opts, timeout)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	can := &conn{c: c, cfg: cn.cfg}
+	can.ssl(cn.opts)
+
+	w := can.writeBuf(0)
+	w.int32(80877102) // cancel request code
+	w.int32(cn.processID)
+	w.int32(cn.secretKey)
+	can.sendStartupPacket(w)
+
+	// The server closes the connection once it has received the request;
+	// wait for that to happen so that we know the request was delivered.
+	_, err = io.Copy(ioutil.Discard, can.c)
+	return err
+}
+
+func parseStatementRowDescribe(r *readBuf) (cols []string, rowTyps []oid.Oid, fields []fieldDesc) {
 	n := r.int16()
 	cols = make([]string, n)
 	rowTyps = make([]oid.Oid, n)
+	fields = make([]fieldDesc, n)
 	for i := range cols {
 		cols[i] = r.string()
-		r.next(6)
-		rowTyps[i] = r.oid()
-		r.next(6)
+		rowTyps[i] = fields[i].parse(r)
 		// format code not known; always 0
 		r.next(2)
 	}
 	return
 }
 
-func parseMeta(r *readBuf) (cols []string, rowFmts []format, rowTyps []oid.Oid) {
+func parseMeta(r *readBuf) (h rowsHeader) {
 	n := r.int16()
-	cols = make([]string, n)
-	rowFmts = make([]format, n)
-	rowTyps = make([]oid.Oid, n)
-	for i := range cols {
-		cols[i] = r.string()
-		r.next(6)
-		rowTyps[i] = r.oid()
-		r.next(6)
-		rowFmts[i] = format(r.int16())
+	h.cols = make([]string, n)
+	h.rowFmts = make([]format, n)
+	h.rowTyps = make([]oid.Oid, n)
+	h.fields = make([]fieldDesc, n)
+	for i := range h.cols {
+		h.cols[i] = r.string()
+		h.rowTyps[i] = h.fields[i].parse(r)
+		h.rowFmts[i] = format(r.int16())
 	}
 	return
 }
@@ -1570,7 +2099,13 @@ func parseEnviron(env []string) (out map[string]string) {
 			accrue("user")
 		case "PGPASSWORD":
 			accrue("password")
-		case "PGPASSFILE", "PGSERVICE", "PGSERVICEFILE", "PGREALM":
+		case "PGPASSFILE":
+			accrue("passfile")
+		case "PGSERVICE":
+			accrue("service")
+		case "PGSERVICEFILE":
+			accrue("servicefile")
+		case "PGREALM":
 			unsupported()
 		case "PGOPTIONS":
 			accrue("options")
@@ -1600,7 +2135,9 @@ func parseEnviron(env []string) (out map[string]string) {
 			accrue("timezone")
 		case "PGGEQO":
 			accrue("geqo")
-		case "PGSYSCONFDIR", "PGLOCALEDIR":
+		case "PGSYSCONFDIR":
+			// read when looking up a service; see serviceOptions
+		case "PGLOCALEDIR":
 			unsupported()
 		}
 	}
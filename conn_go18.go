@@ -0,0 +1,226 @@
+// +build go1.8
+
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// Implement the "QueryerContext" interface
+func (cn *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	list, err := namedValueToValue(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	finish := cn.watchCancel(ctx)
+	r, err := cn.query(query, list)
+	if err != nil {
+		if finish != nil {
+			finish()
+		}
+		return nil, err
+	}
+	r.finish = finish
+	return r, nil
+}
+
+// Implement the "ExecerContext" interface
+func (cn *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	list, err := namedValueToValue(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if finish := cn.watchCancel(ctx); finish != nil {
+		defer finish()
+	}
+	return cn.Exec(query, list)
+}
+
+// Implement the "ConnPrepareContext" interface
+func (cn *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if finish := cn.watchCancel(ctx); finish != nil {
+		defer finish()
+	}
+	return cn.Prepare(query)
+}
+
+// Implement the "ConnBeginTx" interface
+func (cn *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var mode string
+
+	switch sql.IsolationLevel(opts.Isolation) {
+	case sql.LevelDefault:
+		// Don't touch mode: use the server's default
+	case sql.LevelReadUncommitted:
+		mode = " ISOLATION LEVEL READ UNCOMMITTED"
+	case sql.LevelReadCommitted:
+		mode = " ISOLATION LEVEL READ COMMITTED"
+	case sql.LevelRepeatableRead:
+		mode = " ISOLATION LEVEL REPEATABLE READ"
+	case sql.LevelSerializable:
+		mode = " ISOLATION LEVEL SERIALIZABLE"
+	default:
+		return nil, fmt.Errorf("pq: isolation level not supported: %d", opts.Isolation)
+	}
+
+	// Without ReadOnly, use the server's default access mode, which
+	// default_transaction_read_only might make read-only.
+	if opts.ReadOnly {
+		mode += " READ ONLY"
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	finish := cn.watchCancel(ctx)
+	tx, err := cn.begin(mode)
+	if err != nil {
+		if finish != nil {
+			finish()
+		}
+		return nil, err
+	}
+	// Keep watching the context for the lifetime of the transaction, so that
+	// whatever is executing when it is cancelled gets cancelled as well.
+	cn.txnFinish = finish
+	return tx, nil
+}
+
+// Implement the "Pinger" interface
+func (cn *conn) Ping(ctx context.Context) error {
+	if cn.bad {
+		return driver.ErrBadConn
+	}
+	if finish := cn.watchCancel(ctx); finish != nil {
+		defer finish()
+	}
+	rows, err := cn.simpleQuery(";")
+	if err != nil {
+		return driver.ErrBadConn // https://golang.org/pkg/database/sql/driver/#Pinger
+	}
+	rows.Close()
+	return nil
+}
+
+// Implement the "NamedValueChecker" interface.  *big.Int, *big.Rat and
+// *big.Float values are converted to numerics.  If any registered types have
+// encoders, other values which aren't driver values are passed on as they
+// are, so that they can reach the encoders; see convertParameter.
+func (cn *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, ok, err := numericParameter(nv.Value); ok {
+		nv.Value = v
+		return err
+	}
+	if _, ok := nv.Value.(driver.Valuer); ok || !hasTypeEncoders() {
+		return driver.ErrSkip
+	}
+	return nil
+}
+
+// Implement the "NamedValueChecker" interface, so that the values of COPY
+// rows other than *big.Int, *big.Rat and *big.Float values are always
+// converted by database/sql.
+func (ci *copyin) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, ok, err := numericParameter(nv.Value); ok {
+		nv.Value = v
+		return err
+	}
+	return driver.ErrSkip
+}
+
+// watchCancel starts watching ctx, and sends a CancelRequest for whatever
+// the connection is executing if ctx is done before the returned function is
+// called.  The server answers the cancellation with an ErrorResponse, so the
+// connection remains usable afterwards.  The returned function must be called
+// once the operation is over; it waits for any cancellation in progress to
+// have been delivered, so that it can't affect a later query.
+//
+// watchCancel returns nil if ctx can never be done.
+func (cn *conn) watchCancel(ctx context.Context) func() {
+	done := ctx.Done()
+	if done == nil {
+		return nil
+	}
+
+	finished := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-done:
+			if err := cn.cancel(); err != nil {
+				// We couldn't reach the server, so the query would go on
+				// regardless; closing the socket is the only way to stop
+				// waiting for it.  The goroutine executing the query will
+				// mark the connection bad once its read fails.
+				cn.c.Close()
+			}
+		case <-finished:
+		}
+	}()
+
+	return func() {
+		close(finished)
+		<-stopped
+	}
+}
+
+// Implement the "StmtQueryContext" interface
+func (st *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	list, err := namedValueToValue(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	finish := st.cn.watchCancel(ctx)
+	r, err := st.query(list)
+	if err != nil {
+		if finish != nil {
+			finish()
+		}
+		return nil, err
+	}
+	r.finish = finish
+	return r, nil
+}
+
+// Implement the "StmtExecContext" interface
+func (st *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	list, err := namedValueToValue(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if finish := st.cn.watchCancel(ctx); finish != nil {
+		defer finish()
+	}
+	return st.Exec(list)
+}
+
+func namedValueToValue(named []driver.NamedValue) ([]driver.Value, error) {
+	args := make([]driver.Value, len(named))
+	for n, param := range named {
+		if len(param.Name) > 0 {
+			return nil, errors.New("pq: Driver does not support the use of Named Parameters")
+		}
+		args[n] = param.Value
+	}
+	return args, nil
+}
@@ -0,0 +1,452 @@
+// +build go1.8
+
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq/oid"
+)
+
+func TestBeginTxOptions(t *testing.T) {
+	tests := []struct {
+		opts driver.TxOptions
+		mode string
+	}{
+		{driver.TxOptions{}, "BEGIN"},
+		{driver.TxOptions{ReadOnly: true}, "BEGIN READ ONLY"},
+		{driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelReadUncommitted)}, "BEGIN ISOLATION LEVEL READ UNCOMMITTED"},
+		{driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelReadCommitted)}, "BEGIN ISOLATION LEVEL READ COMMITTED"},
+		{driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelRepeatableRead)}, "BEGIN ISOLATION LEVEL REPEATABLE READ"},
+		{driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSerializable), ReadOnly: true}, "BEGIN ISOLATION LEVEL SERIALIZABLE READ ONLY"},
+	}
+
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		for _, test := range tests {
+			s.expectQuery(test.mode)
+			s.sendCommandComplete("BEGIN")
+			s.sendReadyForQueryStatus(txnStatusIdleInTransaction)
+			s.expectQuery("ROLLBACK")
+			s.sendCommandComplete("ROLLBACK")
+			s.sendReadyForQuery()
+		}
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.(*conn).c.Close()
+
+	for _, test := range tests {
+		tx, err := cn.(driver.ConnBeginTx).BeginTx(context.Background(), test.opts)
+		if err != nil {
+			t.Fatalf("%s: %s", test.mode, err)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("%s: %s", test.mode, err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cn.(driver.ConnBeginTx).BeginTx(context.Background(), driver.TxOptions{
+		Isolation: driver.IsolationLevel(sql.LevelLinearizable),
+	})
+	if err == nil {
+		t.Fatal("expected an error for an unsupported isolation level")
+	}
+}
+
+func TestContextCancelBeginFake(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan struct{})
+
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.recvStartupPacket()
+		s.sendAuth(0, nil)
+		w := newFakeMessage('K')
+		w.int32(42)
+		w.int32(43)
+		s.send(w)
+		s.sendReadyForQuery()
+
+		s.expectQuery("BEGIN")
+		// BEGIN is now blocked, for instance behind a lock
+		cancel()
+		<-cancelled
+		s.sendError("ERROR", "57014", "canceling statement due to user request")
+		s.sendReadyForQuery()
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.(*conn).c.Close()
+
+	cancelDone := d.add().serve(func(s *fakeServer) {
+		code, r := s.recvStartup()
+		if code != 80877102 || r.int32() != 42 || r.int32() != 43 {
+			s.fail("unexpected CancelRequest")
+		}
+		close(cancelled)
+	})
+
+	_, err = cn.(driver.ConnBeginTx).BeginTx(ctx, driver.TxOptions{})
+	if pge, ok := err.(*Error); !ok || pge.Code.Name() != "query_canceled" {
+		t.Fatalf("expected query_canceled, got %#v", err)
+	}
+	if err := <-cancelDone; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextCancelExecFake(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan struct{})
+
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.recvStartupPacket()
+		s.sendAuth(0, nil)
+		w := newFakeMessage('K')
+		w.int32(42)
+		w.int32(43)
+		s.send(w)
+		s.sendReadyForQuery()
+
+		s.expectQuery("SELECT pg_sleep(10)")
+		// the query is now "running"
+		cancel()
+		<-cancelled
+		s.sendError("ERROR", "57014", "canceling statement due to user request")
+		s.sendReadyForQuery()
+
+		s.expectQuery("SELECT 1")
+		s.sendCommandComplete("SELECT 1")
+		s.sendReadyForQuery()
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.(*conn).c.Close()
+
+	cancelDone := d.add().serve(func(s *fakeServer) {
+		code, r := s.recvStartup()
+		if code != 80877102 || r.int32() != 42 || r.int32() != 43 {
+			s.fail("unexpected CancelRequest")
+		}
+		close(cancelled)
+	})
+
+	_, err = cn.(driver.ExecerContext).ExecContext(ctx, "SELECT pg_sleep(10)", nil)
+	if pge, ok := err.(*Error); !ok || pge.Code.Name() != "query_canceled" {
+		t.Fatalf("expected query_canceled, got %#v", err)
+	}
+	if err := <-cancelDone; err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cn.(driver.ExecerContext).ExecContext(context.Background(), "SELECT 1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPingFake(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		s.expectQuery(";")
+		s.send(newFakeMessage('I'))
+		s.sendReadyForQuery()
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cn.(driver.Pinger).Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// the server has gone away
+	if err := cn.(driver.Pinger).Ping(context.Background()); err != driver.ErrBadConn {
+		t.Fatalf("expected ErrBadConn, got %v", err)
+	}
+}
+
+func TestNamedParameters(t *testing.T) {
+	cn := &conn{}
+	_, err := cn.QueryContext(context.Background(), "SELECT $1", []driver.NamedValue{{Name: "foo", Ordinal: 1, Value: int64(1)}})
+	if err == nil {
+		t.Fatal("expected an error for named parameters")
+	}
+}
+
+func TestContextCancelQuery(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	rows, err := db.QueryContext(ctx, "SELECT pg_sleep(10)")
+	if err == nil {
+		for rows.Next() {
+		}
+		err = rows.Err()
+		rows.Close()
+	}
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("the query was not cancelled")
+	}
+
+	// the connection pool should still work
+	var i int
+	if err := db.QueryRow("SELECT 1").Scan(&i); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextCancelExec(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := db.ExecContext(ctx, "SELECT pg_sleep(10)")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("the query was not cancelled")
+	}
+}
+
+func TestContextCancelBegin(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err = tx.Exec("SELECT pg_sleep(10)")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("the query was not cancelled")
+	}
+	if err := tx.Rollback(); err != sql.ErrTxDone {
+		t.Fatalf("expected sql.ErrTxDone, got %v", err)
+	}
+}
+
+func TestTxOptions(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		level     sql.IsolationLevel
+		isolation string
+	}{
+		{
+			level:     sql.LevelDefault,
+			isolation: "",
+		},
+		{
+			level:     sql.LevelReadUncommitted,
+			isolation: "read uncommitted",
+		},
+		{
+			level:     sql.LevelReadCommitted,
+			isolation: "read committed",
+		},
+		{
+			level:     sql.LevelRepeatableRead,
+			isolation: "repeatable read",
+		},
+		{
+			level:     sql.LevelSerializable,
+			isolation: "serializable",
+		},
+	}
+
+	for _, test := range tests {
+		for _, ro := range []bool{true, false} {
+			tx, err := db.BeginTx(ctx, &sql.TxOptions{
+				Isolation: test.level,
+				ReadOnly:  ro,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var isolation string
+			err = tx.QueryRow("select current_setting('transaction_isolation')").Scan(&isolation)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.isolation != "" && isolation != test.isolation {
+				t.Errorf("wrong isolation level: %s != %s", isolation, test.isolation)
+			}
+
+			var isRO string
+			err = tx.QueryRow("select current_setting('transaction_read_only')").Scan(&isRO)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ro != (isRO == "on") {
+				t.Errorf("read/[write,only] not set: %t != %s for level %s",
+					ro, isRO, test.isolation)
+			}
+
+			tx.Rollback()
+		}
+	}
+}
+
+func TestColumnTypes(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT 1::int8, 'a'::varchar(10), 1.5::numeric(5, 2), now()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"INT8", "VARCHAR", "NUMERIC", "TIMESTAMPTZ"}
+	for i, ct := range types {
+		if ct.DatabaseTypeName() != names[i] {
+			t.Errorf("column %d: got type name %q, want %q", i, ct.DatabaseTypeName(), names[i])
+		}
+	}
+	if length, ok := types[1].Length(); length != 10 || !ok {
+		t.Errorf("got length %d, %v", length, ok)
+	}
+	if p, s, ok := types[2].DecimalSize(); p != 5 || s != 2 || !ok {
+		t.Errorf("got decimal size %d, %d, %v", p, s, ok)
+	}
+}
+
+func TestMultipleResultSets(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT 1 AS a; SELECT 'x' AS b WHERE false; SELECT 2 AS c, 3 AS d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	want := [][]string{{"a"}, {"b"}, {"c", "d"}}
+	for i, cols := range want {
+		if i > 0 && !rows.NextResultSet() {
+			t.Fatalf("result set %d missing: %v", i, rows.Err())
+		}
+		got, err := rows.Columns()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, cols) {
+			t.Errorf("result set %d: got columns %v, want %v", i, got, cols)
+		}
+		for rows.Next() {
+		}
+	}
+	if rows.NextResultSet() {
+		t.Error("unexpected result set")
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckNamedValue(t *testing.T) {
+	cn := &conn{}
+	nv := &driver.NamedValue{Ordinal: 1, Value: mood("happy")}
+	if err := cn.CheckNamedValue(nv); err != driver.ErrSkip {
+		t.Fatalf("got %v without registered encoders", err)
+	}
+
+	defer resetTypeRegistry()
+	RegisterType("mood", moodCodec)
+	if err := cn.CheckNamedValue(nv); err != nil {
+		t.Fatal(err)
+	}
+	if nv.Value != mood("happy") {
+		t.Errorf("value converted to %#v", nv.Value)
+	}
+	nv.Value = NullTime{}
+	if err := cn.CheckNamedValue(nv); err != driver.ErrSkip {
+		t.Errorf("got %v for a driver.Valuer", err)
+	}
+
+	nv.Value = big.NewRat(-3, 8)
+	if err := cn.CheckNamedValue(nv); err != nil {
+		t.Fatal(err)
+	}
+	if nv.Value != "-0.375" {
+		t.Errorf("*big.Rat converted to %#v", nv.Value)
+	}
+	nv.Value = big.NewRat(1, 3)
+	if err := cn.CheckNamedValue(nv); err == nil {
+		t.Error("expected an error for a *big.Rat without a finite decimal representation")
+	}
+	nv.Value = big.NewInt(42)
+	if err := (&copyin{}).CheckNamedValue(nv); err != nil || nv.Value != "42" {
+		t.Errorf("got %#v, %v for COPY", nv.Value, err)
+	}
+
+	// values which no encoder takes care of are converted when encoded
+	ps := &parameterStatus{}
+	if x := convertParameter(ps, int32(1), oid.T_int4); x != int64(1) {
+		t.Errorf("got %#v", x)
+	}
+	ps.types = map[oid.Oid]*TypeCodec{16500: &moodCodec}
+	if x := convertParameter(ps, mood("sad"), 16500); x != mood("sad") {
+		t.Errorf("got %#v", x)
+	}
+}
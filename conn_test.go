@@ -1,14 +1,28 @@
 package pq
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/lib/pq/oid"
 )
 
 type Fatalistic interface {
@@ -936,6 +950,10 @@ var envParseTests = []struct {
 		Env:      []string{"PGCONNECT_TIMEOUT=30"},
 		Expected: map[string]string{"connect_timeout": "30"},
 	},
+	{
+		Env:      []string{"PGPASSFILE=/tmp/pgpass"},
+		Expected: map[string]string{"passfile": "/tmp/pgpass"},
+	},
 }
 
 func TestParseEnviron(t *testing.T) {
@@ -968,6 +986,15 @@ func TestParseComplete(t *testing.T) {
 		if n != affectedRows {
 			t.Errorf("Expected %d, got %d", affectedRows, n)
 		}
+		if tag := res.CommandTag(); tag != commandTag {
+			t.Errorf("Expected command tag %v, got %v", commandTag, tag)
+		}
+		if res.Command() != command {
+			t.Errorf("Expected command %v, got %v", command, res.Command())
+		}
+		if _, err := res.LastInsertId(); err == nil {
+			t.Error("Expected an error from LastInsertId")
+		}
 	}
 
 	tpc("ALTER TABLE", "ALTER TABLE", 0, false)
@@ -1285,3 +1312,780 @@ func TestQuoteIdentifier(t *testing.T) {
 		}
 	}
 }
+
+// fakeServer plays the server's side of the protocol over an in-memory
+// connection, for testing parts of the driver which can't easily be exercised
+// against a real server.
+type fakeServer struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// fakeDialer hands out the client sides of the connections to fake servers
+// created with add, in order.
+type fakeDialer chan net.Conn
+
+func (d fakeDialer) Dial(ntw, addr string) (net.Conn, error) {
+	select {
+	case c := <-d:
+		return c, nil
+	default:
+		return nil, errors.New("fake server: no more connections")
+	}
+}
+
+func (d fakeDialer) DialTimeout(ntw, addr string, timeout time.Duration) (net.Conn, error) {
+	return d.Dial(ntw, addr)
+}
+
+// add creates a new fake server which will be connected to by the next
+// unanswered dial.
+func (d fakeDialer) add() *fakeServer {
+	client, server := net.Pipe()
+	d <- client
+	return &fakeServer{Conn: server, r: bufio.NewReader(server)}
+}
+
+func newFakeServer() (*fakeServer, fakeDialer) {
+	d := make(fakeDialer, 8)
+	return d.add(), d
+}
+
+// serve runs script in a new goroutine.  The returned channel receives nil
+// once the script has finished, or the error it failed with.
+func (s *fakeServer) serve(script func(s *fakeServer)) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		defer s.Close()
+		defer func() {
+			if e := recover(); e != nil {
+				done <- fmt.Errorf("fake server: %v", e)
+			}
+			close(done)
+		}()
+		script(s)
+	}()
+	return done
+}
+
+func (s *fakeServer) fail(format string, args ...interface{}) {
+	panic(fmt.Sprintf(format, args...))
+}
+
+// recvStartup reads a message without a type byte, as used during connection
+// startup, and returns its request code and the remainder of the message.
+func (s *fakeServer) recvStartup() (code int, r readBuf) {
+	var x [4]byte
+	if _, err := io.ReadFull(s.r, x[:]); err != nil {
+		panic(err)
+	}
+	r = make(readBuf, int(binary.BigEndian.Uint32(x[:]))-4)
+	if _, err := io.ReadFull(s.r, r); err != nil {
+		panic(err)
+	}
+	return r.int32(), r
+}
+
+// recvStartupPacket reads a StartupMessage and returns the parameters in it.
+func (s *fakeServer) recvStartupPacket() map[string]string {
+	code, r := s.recvStartup()
+	if code != 196608 {
+		s.fail("unexpected startup request code %d", code)
+	}
+	params := make(map[string]string)
+	for {
+		k := r.string()
+		if k == "" {
+			return params
+		}
+		params[k] = r.string()
+	}
+}
+
+func (s *fakeServer) recv() (byte, readBuf) {
+	var x [5]byte
+	if _, err := io.ReadFull(s.r, x[:]); err != nil {
+		panic(err)
+	}
+	r := make(readBuf, int(binary.BigEndian.Uint32(x[1:]))-4)
+	if _, err := io.ReadFull(s.r, r); err != nil {
+		panic(err)
+	}
+	return x[0], r
+}
+
+func (s *fakeServer) expect(typ byte) readBuf {
+	t, r := s.recv()
+	if t != typ {
+		s.fail("expected message %q, got %q", typ, t)
+	}
+	return r
+}
+
+func newFakeMessage(typ byte) *writeBuf {
+	return &writeBuf{buf: []byte{typ, 0, 0, 0, 0}, pos: 1}
+}
+
+func (s *fakeServer) send(w *writeBuf) {
+	if _, err := s.Write(w.wrap()); err != nil {
+		panic(err)
+	}
+}
+
+func (s *fakeServer) sendAuth(code int, data []byte) {
+	w := newFakeMessage('R')
+	w.int32(code)
+	w.bytes(data)
+	s.send(w)
+}
+
+func (s *fakeServer) sendReadyForQuery() {
+	s.sendReadyForQueryStatus('I')
+}
+
+func (s *fakeServer) sendReadyForQueryStatus(status transactionStatus) {
+	w := newFakeMessage('Z')
+	w.byte(byte(status))
+	s.send(w)
+}
+
+func (s *fakeServer) sendCommandComplete(tag string) {
+	w := newFakeMessage('C')
+	w.string(tag)
+	s.send(w)
+}
+
+// expectQuery reads a simple Query message and checks its query string.
+func (s *fakeServer) expectQuery(query string) {
+	r := s.expect('Q')
+	if q := r.string(); q != query {
+		s.fail("expected query %q, got %q", query, q)
+	}
+}
+
+// startup accepts a StartupMessage without asking for a password.
+func (s *fakeServer) startup() map[string]string {
+	params := s.recvStartupPacket()
+	s.sendAuth(0, nil)
+	s.sendReadyForQuery()
+	return params
+}
+
+func (s *fakeServer) sendError(severity, code, message string) {
+	s.sendErrorOrNotice('E', severity, code, message)
+}
+
+func (s *fakeServer) sendNotice(severity, code, message string) {
+	s.sendErrorOrNotice('N', severity, code, message)
+}
+
+func (s *fakeServer) sendErrorOrNotice(typ byte, severity, code, message string) {
+	w := newFakeMessage(typ)
+	w.byte('S')
+	w.string(severity)
+	w.byte('C')
+	w.string(code)
+	w.byte('M')
+	w.string(message)
+	w.byte(0)
+	s.send(w)
+}
+
+// startTLS answers an SSLRequest and switches the connection to TLS, using
+// the test certificates in certs/.
+func (s *fakeServer) startTLS() *tls.Config {
+	if code, _ := s.recvStartup(); code != 80877103 {
+		s.fail("expected SSLRequest, got request code %d", code)
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join("certs", "server.crt"), filepath.Join("certs", "server.key"))
+	if err != nil {
+		panic(err)
+	}
+	if _, err := s.Write([]byte{'S'}); err != nil {
+		panic(err)
+	}
+	conf := &tls.Config{Certificates: []tls.Certificate{cert}}
+	s.Conn = tls.Server(s.Conn, conf)
+	s.r = bufio.NewReader(s.Conn)
+	return conf
+}
+
+// scramServer performs the server side of a SCRAM-SHA-256 exchange for
+// password.  If cbind is not nil, the client is expected to use
+// SCRAM-SHA-256-PLUS with cbind as the channel binding data.
+func (s *fakeServer) scramServer(password string, cbind []byte, serverSignature func([]byte) []byte) {
+	w := newFakeMessage('R')
+	w.int32(10)
+	w.string("SCRAM-SHA-256")
+	if cbind != nil {
+		w.string("SCRAM-SHA-256-PLUS")
+	}
+	w.string("")
+	s.send(w)
+
+	wantMechanism, wantGS2 := "SCRAM-SHA-256", "n,,"
+	if cbind != nil {
+		wantMechanism, wantGS2 = "SCRAM-SHA-256-PLUS", "p=tls-server-end-point,,"
+	}
+
+	r := s.expect('p')
+	if m := r.string(); m != wantMechanism {
+		s.fail("expected mechanism %s, got %s", wantMechanism, m)
+	}
+	clientFirst := string(r.next(r.int32()))
+	if !strings.HasPrefix(clientFirst, wantGS2+"n=,r=") {
+		s.fail("unexpected client-first-message %q", clientFirst)
+	}
+	clientFirstBare := clientFirst[len(wantGS2):]
+	nonce := clientFirstBare[len("n=,r="):] + "3rfcNHYJY1ZVvWVs7j"
+	salt := []byte("saltSALTsaltSALT")
+	serverFirst := "r=" + nonce + ",s=" + base64.StdEncoding.EncodeToString(salt) + ",i=4096"
+	s.sendAuth(11, []byte(serverFirst))
+
+	r = s.expect('p')
+	clientFinal := string(r)
+	wantWithoutProof := "c=" + base64.StdEncoding.EncodeToString(append([]byte(wantGS2), cbind...)) + ",r=" + nonce
+	if !strings.HasPrefix(clientFinal, wantWithoutProof+",p=") {
+		s.fail("unexpected client-final-message %q, want prefix %q", clientFinal, wantWithoutProof)
+	}
+	proof, err := base64.StdEncoding.DecodeString(clientFinal[len(wantWithoutProof+",p="):])
+	if err != nil {
+		panic(err)
+	}
+
+	hmacSHA256 := func(key, msg []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(msg)
+		return mac.Sum(nil)
+	}
+	// Hi() from RFC 5802
+	u := hmacSHA256([]byte(password), append(salt, 0, 0, 0, 1))
+	saltedPassword := append([]byte(nil), u...)
+	for i := 1; i < 4096; i++ {
+		u = hmacSHA256([]byte(password), u)
+		for j := range u {
+			saltedPassword[j] ^= u[j]
+		}
+	}
+	authMessage := []byte(clientFirstBare + "," + serverFirst + "," + wantWithoutProof)
+	clientKey := hmacSHA256(saltedPassword, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	clientSignature := hmacSHA256(storedKey[:], authMessage)
+	for i := range proof {
+		proof[i] ^= clientSignature[i]
+	}
+	if h := sha256.Sum256(proof); !hmac.Equal(h[:], storedKey[:]) {
+		s.sendError("FATAL", "28P01", "password authentication failed")
+		return
+	}
+
+	signature := hmacSHA256(hmacSHA256(saltedPassword, []byte("Server Key")), authMessage)
+	if serverSignature != nil {
+		signature = serverSignature(signature)
+	}
+	s.sendAuth(12, []byte("v="+base64.StdEncoding.EncodeToString(signature)))
+	s.sendAuth(0, nil)
+	s.sendReadyForQuery()
+}
+
+func TestSCRAMAuth(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.recvStartupPacket()
+		s.scramServer("pencil", nil, nil)
+	})
+	cn, err := DialOpen(d, "user=pqgotest password=pencil sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	cn.(*conn).c.Close()
+}
+
+func TestSCRAMAuthWrongPassword(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.recvStartupPacket()
+		s.scramServer("pencil", nil, nil)
+	})
+	_, err := DialOpen(d, "user=pqgotest password=crayon sslmode=disable")
+	if e, ok := err.(*Error); !ok || e.Code.Name() != "invalid_password" {
+		t.Fatalf("expected invalid_password, got %#v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSCRAMAuthBadServerSignature(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		defer func() {
+			// the client hangs up on us after rejecting the signature
+			recover()
+		}()
+		s.recvStartupPacket()
+		s.scramServer("pencil", nil, func(sig []byte) []byte {
+			sig[0] ^= 0xff
+			return sig
+		})
+	})
+	_, err := DialOpen(d, "user=pqgotest password=pencil sslmode=disable")
+	if err == nil || !strings.Contains(err.Error(), "server signature") {
+		t.Fatalf("expected server signature error, got %v", err)
+	}
+	srv.Close()
+	<-done
+}
+
+func TestSCRAMAuthChannelBinding(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		conf := s.startTLS()
+		s.recvStartupPacket()
+		cert, err := x509.ParseCertificate(conf.Certificates[0].Certificate[0])
+		if err != nil {
+			panic(err)
+		}
+		cbind := sha256.Sum256(cert.Raw)
+		s.scramServer("pencil", cbind[:], nil)
+	})
+	cn, err := DialOpen(d, "user=pqgotest password=pencil sslmode=require")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	cn.(*conn).c.Close()
+}
+
+func TestCancel(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.recvStartupPacket()
+		s.sendAuth(0, nil)
+		w := newFakeMessage('K')
+		w.int32(1234)
+		w.int32(5678)
+		s.send(w)
+		s.sendReadyForQuery()
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.(*conn).c.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	done = d.add().serve(func(s *fakeServer) {
+		code, r := s.recvStartup()
+		if code != 80877102 {
+			s.fail("expected CancelRequest, got request code %d", code)
+		}
+		if pid, key := r.int32(), r.int32(); pid != 1234 || key != 5678 {
+			s.fail("unexpected CancelRequest for process %d with key %d", pid, key)
+		}
+	})
+	if err := Cancel(cn); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCancelTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { cancelTimeout = timeout }(cancelTimeout)
+	cancelTimeout = 50 * time.Millisecond
+
+	_, d := newFakeServer()
+	cn := &conn{cfg: &Config{Dialer: d}, opts: values{"sslmode": "disable"}}
+	d.add().serve(func(s *fakeServer) {
+		s.recvStartup()
+		// don't close the connection until the client gives up
+		s.r.ReadByte()
+	})
+	errc := make(chan error, 1)
+	go func() { errc <- Cancel(cn) }()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("expected a timeout error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Cancel did not time out")
+	}
+}
+
+func TestCancelQuery(t *testing.T) {
+	// sets up the environment for Open
+	db := openTestConn(t)
+	defer db.Close()
+
+	cn, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.Close()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if err := Cancel(cn); err != nil {
+			t.Error(err)
+		}
+	}()
+	_, err = cn.(driver.Execer).Exec("SELECT pg_sleep(10)", nil)
+	if pge, ok := err.(*Error); !ok || pge.Code.Name() != "query_canceled" {
+		t.Fatalf("expected query_canceled, got %#v", err)
+	}
+
+	// the connection should still be usable
+	_, err = cn.(driver.Execer).Exec("SELECT 1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sendRowDescription sends a RowDescription for text format columns with the
+// given names and types.
+func (s *fakeServer) sendRowDescription(cols []string, typs []oid.Oid) {
+	w := newFakeMessage('T')
+	w.int16(len(cols))
+	for i, col := range cols {
+		w.string(col)
+		w.int32(0)
+		w.int16(0)
+		w.int32(int(typs[i]))
+		w.int16(-1)
+		w.int32(-1)
+		w.int16(0)
+	}
+	s.send(w)
+}
+
+// sendDataRow sends a DataRow containing values; nil stands for NULL.
+func (s *fakeServer) sendDataRow(values ...[]byte) {
+	w := newFakeMessage('D')
+	w.int16(len(values))
+	for _, v := range values {
+		if v == nil {
+			w.int32(-1)
+			continue
+		}
+		w.int32(len(v))
+		w.bytes(v)
+	}
+	s.send(w)
+}
+
+// recordingDialer records the addresses it is asked to dial, and refuses to
+// connect to those in refuse.
+type recordingDialer struct {
+	fakeDialer
+	addrs  []string
+	refuse map[string]bool
+}
+
+func (d *recordingDialer) Dial(ntw, addr string) (net.Conn, error) {
+	d.addrs = append(d.addrs, addr)
+	if d.refuse[addr] {
+		return nil, errors.New("connection refused")
+	}
+	return d.fakeDialer.Dial(ntw, addr)
+}
+
+func (d *recordingDialer) DialTimeout(ntw, addr string, timeout time.Duration) (net.Conn, error) {
+	return d.Dial(ntw, addr)
+}
+
+func TestSplitHosts(t *testing.T) {
+	tests := []struct {
+		host, port string
+		want       []string
+	}{
+		{"a", "1", []string{"a:1"}},
+		{"a,b", "1", []string{"a:1", "b:1"}},
+		{"a,,/tmp", "1,2,3", []string{"a:1", "localhost:2", "/tmp:3"}},
+		{"a,b", "1,", []string{"a:1", "b:5432"}},
+	}
+	for _, tt := range tests {
+		list, err := splitHosts(values{"host": tt.host, "port": tt.port, "user": "u"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, o := range list {
+			if o["user"] != "u" {
+				t.Errorf("option not copied: %v", o)
+			}
+			got = append(got, o["host"]+":"+o["port"])
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("host=%s port=%s: got %v, want %v", tt.host, tt.port, got, tt.want)
+		}
+	}
+
+	if _, err := splitHosts(values{"host": "a,b,c", "port": "1,2"}); err == nil {
+		t.Error("expected an error for mismatched hosts and ports")
+	}
+}
+
+func TestMultiHostFailover(t *testing.T) {
+	srv, fd := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		s.expect('X')
+	})
+	d := &recordingDialer{fakeDialer: fd, refuse: map[string]bool{"a:5432": true}}
+
+	cn, err := DialOpen(d, "host=a,b,c port=5432,5433,5434 user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a:5432", "b:5433"}; !reflect.DeepEqual(d.addrs, want) {
+		t.Errorf("dialed %v, want %v", d.addrs, want)
+	}
+	if o := cn.(*conn).opts; o["host"] != "b" || o["port"] != "5433" {
+		t.Errorf("connection options refer to %s:%s, want b:5433", o["host"], o["port"])
+	}
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// all hosts failing
+	d = &recordingDialer{fakeDialer: make(fakeDialer), refuse: map[string]bool{"a:1": true, "b:1": true}}
+	_, err = DialOpen(d, "postgres://pqgotest@a:1,b:1/db?sslmode=disable")
+	if err == nil || err.Error() != "connection refused" {
+		t.Errorf("expected connection refused, got %v", err)
+	}
+	if want := []string{"a:1", "b:1"}; !reflect.DeepEqual(d.addrs, want) {
+		t.Errorf("dialed %v, want %v", d.addrs, want)
+	}
+
+	// IPv6 addresses
+	for _, dsn := range []string{
+		"postgres://pqgotest@[::1]:1,[fe80::1]:2,a/db?sslmode=disable",
+		"host=::1,fe80::1,a port=1,2,5432 user=pqgotest sslmode=disable",
+	} {
+		d = &recordingDialer{fakeDialer: make(fakeDialer), refuse: map[string]bool{"[::1]:1": true, "[fe80::1]:2": true, "a:5432": true}}
+		_, err = DialOpen(d, dsn)
+		if err == nil || err.Error() != "connection refused" {
+			t.Errorf("%s: expected connection refused, got %v", dsn, err)
+		}
+		if want := []string{"[::1]:1", "[fe80::1]:2", "a:5432"}; !reflect.DeepEqual(d.addrs, want) {
+			t.Errorf("%s: dialed %v, want %v", dsn, d.addrs, want)
+		}
+	}
+}
+
+func TestTargetSessionAttrs(t *testing.T) {
+	readOnly := func(value string) func(s *fakeServer) {
+		return func(s *fakeServer) {
+			s.startup()
+			s.expectQuery("SHOW transaction_read_only")
+			s.sendRowDescription([]string{"transaction_read_only"}, []oid.Oid{oid.T_text})
+			s.sendDataRow([]byte(value))
+			s.sendCommandComplete("SHOW")
+			s.sendReadyForQuery()
+			if value == "off" {
+				s.expect('X')
+			}
+		}
+	}
+	standby, fd := newFakeServer()
+	standbyDone := standby.serve(readOnly("on"))
+	primary := fd.add()
+	primaryDone := primary.serve(readOnly("off"))
+	d := &recordingDialer{fakeDialer: fd}
+
+	cn, err := DialOpen(d, "host=standby,primary user=pqgotest sslmode=disable target_session_attrs=read-write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn.Close()
+	if err := <-standbyDone; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-primaryDone; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"standby:5432", "primary:5432"}; !reflect.DeepEqual(d.addrs, want) {
+		t.Errorf("dialed %v, want %v", d.addrs, want)
+	}
+
+	// only a standby
+	standby, fd = newFakeServer()
+	standbyDone = standby.serve(readOnly("on"))
+	_, err = DialOpen(fd, "host=standby user=pqgotest sslmode=disable target_session_attrs=read-write")
+	if err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("expected a read-only error, got %v", err)
+	}
+	if err := <-standbyDone; err != nil {
+		t.Fatal(err)
+	}
+
+	// "any" doesn't probe the server
+	srv, fd := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		params := s.startup()
+		if _, ok := params["target_session_attrs"]; ok {
+			s.fail("target_session_attrs sent to the server")
+		}
+		s.expect('X')
+	})
+	cn, err = DialOpen(fd, "host=standby user=pqgotest sslmode=disable target_session_attrs=any")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = DialOpen(make(fakeDialer), "user=pqgotest target_session_attrs=read-only")
+	if err == nil || !strings.Contains(err.Error(), "target_session_attrs") {
+		t.Errorf("expected an error for an unsupported value, got %v", err)
+	}
+}
+
+// refuseTLS answers an SSLRequest with 'N', as servers without SSL support do.
+func (s *fakeServer) refuseTLS() {
+	if code, _ := s.recvStartup(); code != 80877103 {
+		s.fail("expected SSLRequest, got request code %d", code)
+	}
+	if _, err := s.Write([]byte{'N'}); err != nil {
+		panic(err)
+	}
+}
+
+func TestSSLModePrefer(t *testing.T) {
+	for _, ssl := range []bool{false, true} {
+		srv, d := newFakeServer()
+		done := srv.serve(func(s *fakeServer) {
+			if ssl {
+				s.startTLS()
+			} else {
+				s.refuseTLS()
+			}
+			s.startup()
+			s.expect('X')
+		})
+		cn, err := DialOpen(d, "user=pqgotest sslmode=prefer connect_timeout=5")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, isTLS := cn.(*conn).c.(*tls.Conn); isTLS != ssl {
+			t.Errorf("server SSL support %v, but connection over TLS is %v", ssl, isTLS)
+		}
+		cn.Close()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSSLModeAllow(t *testing.T) {
+	// a server which accepts connections without SSL
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		s.expect('X')
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=allow connect_timeout=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, isTLS := cn.(*conn).c.(*tls.Conn); isTLS {
+		t.Error("connection unexpectedly over TLS")
+	}
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// a server which requires SSL
+	plain, d := newFakeServer()
+	plainDone := plain.serve(func(s *fakeServer) {
+		s.recvStartupPacket()
+		s.sendError("FATAL", "28000", `no pg_hba.conf entry for host "127.0.0.1", user "pqgotest", database "pqgotest", SSL off`)
+	})
+	secure := d.add()
+	secureDone := secure.serve(func(s *fakeServer) {
+		s.startTLS()
+		s.startup()
+		s.expect('X')
+	})
+	cn, err = DialOpen(d, "user=pqgotest sslmode=allow connect_timeout=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, isTLS := cn.(*conn).c.(*tls.Conn); !isTLS {
+		t.Error("connection not over TLS")
+	}
+	cn.Close()
+	if err := <-plainDone; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-secureDone; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBinaryParameters(t *testing.T) {
+	tests := []struct {
+		conninfo string
+		formats  []int
+		param    []byte
+	}{
+		{"user=pqgotest sslmode=disable", []int{1}, []byte{0, 0, 0, 42}},
+		{"user=pqgotest sslmode=disable disable_binary_parameters=yes", nil, []byte("42")},
+	}
+	for _, tt := range tests {
+		srv, d := newFakeServer()
+		done := srv.serve(func(s *fakeServer) {
+			s.startup()
+			s.expectPrepare("1", "SELECT $1")
+			r := s.expect('B')
+			r.string()
+			r.string()
+			var formats []int
+			for i := r.int16(); i > 0; i-- {
+				formats = append(formats, r.int16())
+			}
+			if !reflect.DeepEqual(formats, tt.formats) {
+				s.fail("expected parameter formats %v, got %v", tt.formats, formats)
+			}
+			if n := r.int16(); n != 1 {
+				s.fail("expected 1 parameter, got %d", n)
+			}
+			if param := r.next(r.int32()); !bytes.Equal(param, tt.param) {
+				s.fail("expected parameter %q, got %q", tt.param, param)
+			}
+			s.expect('E')
+			s.expect('S')
+			s.sendBindComplete("SELECT 1")
+			s.expect('X')
+		})
+		cn, err := DialOpen(d, tt.conninfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		st, err := cn.Prepare("SELECT $1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.Exec([]driver.Value{int64(42)}); err != nil {
+			t.Fatal(err)
+		}
+		cn.Close()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
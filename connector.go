@@ -0,0 +1,64 @@
+// +build go1.10
+
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// Connector establishes connections as described by a Config.  It implements
+// driver.Connector, and can be passed to sql.OpenDB:
+//
+//	cfg, err := pq.ParseConfig("dbname=pqgotest")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	cfg.TLSConfig = tlsConfig
+//	db := sql.OpenDB(pq.NewConnector(cfg))
+type Connector struct {
+	cfg *Config
+}
+
+// NewConnector returns a Connector for cfg.  Changes made to cfg after
+// NewConnector returns don't affect the Connector.
+func NewConnector(cfg *Config) *Connector {
+	c := cfg.copy()
+	if c.TLSConfig != nil {
+		c.TLSConfig = c.TLSConfig.Clone()
+	}
+	return &Connector{cfg: c}
+}
+
+// Connect establishes a new connection.  If ctx has a deadline, the
+// connection must be established by then, even if the Config's
+// ConnectTimeout is longer.  If ctx is canceled while the connection is being
+// established, Connect gives up and returns ctx.Err().
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	timeout := c.cfg.ConnectTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if d := time.Until(deadline); timeout == 0 || d < timeout {
+			timeout = d
+		}
+		if timeout <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+	}
+	cn, err := c.cfg.open(timeout, ctx.Done())
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return cn, nil
+}
+
+// Driver returns the driver of the Connector.
+func (c *Connector) Driver() driver.Driver {
+	return &drv{}
+}
@@ -0,0 +1,187 @@
+// +build go1.10
+
+package pq
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql/driver"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConnector(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startTLS()
+		params := s.startup()
+		if params["application_name"] != "connector" {
+			s.fail("got application_name %q", params["application_name"])
+		}
+		if params["database"] != "configtest" {
+			s.fail("got database %q", params["database"])
+		}
+		s.expect('X')
+	})
+
+	cfg, err := ParseConfig("user=pqgotest dbname=configtest sslmode=require")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified := false
+	cfg.Dialer = d
+	cfg.RuntimeParams["application_name"] = "connector"
+	cfg.TLSConfig = &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func([][]byte, [][]*x509.Certificate) error {
+			verified = true
+			return nil
+		},
+	}
+	c := NewConnector(cfg)
+	// changes to cfg don't affect the connector
+	cfg.Database = "other"
+	cfg.RuntimeParams["application_name"] = "other"
+	cfg.TLSConfig.InsecureSkipVerify = false
+
+	cn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Error("the TLS configuration wasn't used")
+	}
+}
+
+func TestConnectorDeadline(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.recvStartupPacket()
+		// never answer, until the client gives up
+		io.Copy(ioutil.Discard, s)
+	})
+	cfg, err := ParseConfig("user=pqgotest sslmode=disable connect_timeout=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Dialer = d
+	c := NewConnector(cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Connect(ctx); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Connect(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// blockingDialer blocks in Dial until unblock is closed.
+type blockingDialer struct {
+	fakeDialer
+	unblock chan struct{}
+}
+
+func (d blockingDialer) Dial(ntw, addr string) (net.Conn, error) {
+	<-d.unblock
+	return d.fakeDialer.Dial(ntw, addr)
+}
+
+func (d blockingDialer) DialTimeout(ntw, addr string, timeout time.Duration) (net.Conn, error) {
+	return d.Dial(ntw, addr)
+}
+
+func TestConnectorCancel(t *testing.T) {
+	// while waiting for the server
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.recvStartupPacket()
+		io.Copy(ioutil.Discard, s)
+	})
+	cfg, err := ParseConfig("user=pqgotest sslmode=disable connect_timeout=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Dialer = d
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := NewConnector(cfg).Connect(ctx); err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// while dialing
+	srv, fd := newFakeServer()
+	done = srv.serve(func(s *fakeServer) {
+		if _, err := s.r.ReadByte(); err != io.EOF {
+			s.fail("expected the connection to be closed, got %v", err)
+		}
+	})
+	bd := blockingDialer{fakeDialer: fd, unblock: make(chan struct{})}
+	cfg.Dialer = bd
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := NewConnector(cfg).Connect(ctx); err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	// the connection which is eventually established is closed
+	close(bd.unblock)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectorNoticeHandler(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.recvStartupPacket()
+		s.sendAuth(0, nil)
+		s.sendNotice("WARNING", "01000", "startup notice")
+		s.sendReadyForQuery()
+
+		s.expectQuery("SELECT raise_notice()")
+		s.sendNotice("NOTICE", "00000", "hello")
+		s.sendCommandComplete("SELECT 1")
+		s.sendReadyForQuery()
+		s.expect('X')
+	})
+	cfg, err := ParseConfig("user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notices []string
+	cfg.Dialer = d
+	cfg.NoticeHandler = func(e *Error) {
+		notices = append(notices, e.Message)
+	}
+	cn, err := NewConnector(cfg).Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cn.(driver.Execer).Exec("SELECT raise_notice()", nil); err != nil {
+		t.Fatal(err)
+	}
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"startup notice", "hello"}; !reflect.DeepEqual(notices, want) {
+		t.Errorf("got notices %q, want %q", notices, want)
+	}
+}
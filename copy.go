@@ -1,17 +1,24 @@
 package pq
 
 import (
+	"bytes"
 	"database/sql/driver"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"sync"
+
+	"github.com/lib/pq/oid"
 )
 
 var (
 	errCopyInClosed               = errors.New("pq: copyin statement has already been closed")
 	errBinaryCopyNotSupported     = errors.New("pq: only text format supported for COPY")
-	errCopyToNotSupported         = errors.New("pq: COPY TO is not supported")
+	errCopyToNotSupported         = errors.New("pq: COPY TO is not supported; use CopyOut or QueryCopyOut")
+	errCopyFromNotSupported       = errors.New("pq: COPY FROM is not supported by CopyOut; use CopyIn")
+	errNotCopyOut                 = errors.New("pq: query did not start a COPY TO STDOUT")
 	errCopyNotSupportedOutsideTxn = errors.New("pq: COPY is only allowed inside a transaction")
 )
 
@@ -43,14 +50,79 @@ func CopyInSchema(schema, table string, columns ...string) string {
 	return stmt
 }
 
+// CopyInBinary is like CopyIn, but creates a statement which sends the data
+// in the binary COPY format.  This avoids formatting every value as text, which
+// can be considerably faster, especially for timestamps and bytea values.
+//
+// Preparing the statement looks up the types of the target columns, and each
+// value passed to Exec must be convertible to the binary format of its column's
+// type.  Only a limited set of types is supported: the integer, floating-point,
+// bool, character, bytea, json, jsonb, date, timestamp, timestamptz and uuid
+// types.  Preparing the statement fails if a column has any other type, or is
+// a timestamp on a server which doesn't use integer datetimes.
+func CopyInBinary(table string, columns ...string) string {
+	return CopyIn(table, columns...) + copyInBinarySuffix
+}
+
+// CopyInSchemaBinary is like CopyInSchema, but creates a statement which sends
+// the data in the binary COPY format.  See CopyInBinary.
+func CopyInSchemaBinary(schema, table string, columns ...string) string {
+	return CopyInSchema(schema, table, columns...) + copyInBinarySuffix
+}
+
+const copyInBinarySuffix = " WITH (FORMAT binary)"
+
+// binaryCopyHeader is the signature, flags field and header extension length
+// which start the binary COPY format.
+var binaryCopyHeader = []byte("PGCOPY\n\xff\r\n\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+
+// copyInBinaryLookup returns a query which selects no rows from the columns a
+// binary COPY statement created by CopyInBinary or CopyInSchemaBinary copies
+// into, so that their types can be found by describing it.  ok is false if q
+// was not created by one of those functions.
+func copyInBinaryLookup(q string) (lookup string, ok bool) {
+	const prefix, suffix = "COPY ", ") FROM STDIN" + copyInBinarySuffix
+	if !strings.HasPrefix(q, prefix) || !strings.HasSuffix(q, suffix) {
+		return "", false
+	}
+	target := q[len(prefix) : len(q)-len(suffix)]
+
+	// Look for the start of the column list outside of quoted identifiers.
+	quoted := false
+	for i := 0; i < len(target); i++ {
+		switch target[i] {
+		case '"':
+			quoted = !quoted
+		case '(':
+			if quoted || i == 0 || target[i-1] != ' ' {
+				continue
+			}
+			table, columns := target[:i-1], target[i+1:]
+			if columns == "" {
+				columns = "*"
+			}
+			return "SELECT " + columns + " FROM " + table + " LIMIT 0", true
+		}
+	}
+	return "", false
+}
+
 type copyin struct {
 	cn      *conn
 	buffer  []byte
 	rowData chan []byte
 	done    chan bool
 
+	// the types of the columns, if the COPY uses the binary format
+	binaryTyps []oid.Oid
+
 	closed bool
 
+	// the command tag of the COPY, set by resploop before it signals done
+	tag string
+	// the result of the COPY, once Close has returned
+	result Result
+
 	sync.Mutex // guards err
 	err        error
 }
@@ -74,6 +146,22 @@ func (cn *conn) prepareCopyIn(q string) (_ driver.Stmt, err error) {
 	// add CopyData identifier + 4 bytes for message length
 	ci.buffer = append(ci.buffer, 'd', 0, 0, 0, 0)
 
+	var typs []oid.Oid
+	if lookup, ok := copyInBinaryLookup(q); ok {
+		st, err := cn.prepareTo(lookup, "")
+		if err != nil {
+			return nil, err
+		}
+		// Check the column types before starting the COPY, rather than
+		// failing on the first row.
+		for _, typ := range st.rowTyps {
+			if err := checkBinaryEncodable(&cn.parameterStatus, typ); err != nil {
+				return nil, err
+			}
+		}
+		typs = st.rowTyps
+	}
+
 	b := cn.writeBuf('Q')
 	b.string(q)
 	cn.send(b)
@@ -84,8 +172,16 @@ awaitCopyInResponse:
 		switch t {
 		case 'G':
 			if r.byte() != 0 {
-				err = errBinaryCopyNotSupported
-				break awaitCopyInResponse
+				if typs == nil {
+					err = errBinaryCopyNotSupported
+					break awaitCopyInResponse
+				}
+				if n := r.int16(); n != len(typs) {
+					err = fmt.Errorf("pq: binary COPY expects %d columns, but the column lookup found %d", n, len(typs))
+					break awaitCopyInResponse
+				}
+				ci.binaryTyps = typs
+				ci.buffer = append(ci.buffer, binaryCopyHeader...)
 			}
 			go ci.resploop()
 			return ci, nil
@@ -149,9 +245,9 @@ func (ci *copyin) resploop() {
 		}
 		switch t {
 		case 'C':
-			// complete
+			ci.tag = r.string()
 		case 'N':
-			// NoticeResponse
+			ci.cn.processNotice(&r)
 		case 'Z':
 			ci.cn.processReadyForQuery(&r)
 			ci.done <- true
@@ -217,18 +313,27 @@ func (ci *copyin) Exec(v []driver.Value) (r driver.Result, err error) {
 	if len(v) == 0 {
 		err = ci.Close()
 		ci.closed = true
-		return nil, err
+		if err != nil {
+			return nil, err
+		}
+		return ci.result, nil
 	}
 
-	numValues := len(v)
-	for i, value := range v {
-		ci.buffer = appendEncodedText(&ci.cn.parameterStatus, ci.buffer, value)
-		if i < numValues-1 {
-			ci.buffer = append(ci.buffer, '\t')
+	if ci.binaryTyps != nil {
+		if err := ci.appendBinaryRow(v); err != nil {
+			return nil, err
+		}
+	} else {
+		numValues := len(v)
+		for i, value := range v {
+			ci.buffer = appendEncodedText(&ci.cn.parameterStatus, ci.buffer, value)
+			if i < numValues-1 {
+				ci.buffer = append(ci.buffer, '\t')
+			}
 		}
-	}
 
-	ci.buffer = append(ci.buffer, '\n')
+		ci.buffer = append(ci.buffer, '\n')
+	}
 
 	if len(ci.buffer) > ciBufferFlushSize {
 		ci.flush(ci.buffer)
@@ -239,6 +344,33 @@ func (ci *copyin) Exec(v []driver.Value) (r driver.Result, err error) {
 	return driver.RowsAffected(0), nil
 }
 
+// appendBinaryRow appends v to the buffer as a tuple in the binary COPY
+// format.  If a value can't be encoded, the buffer is left unchanged.
+func (ci *copyin) appendBinaryRow(v []driver.Value) error {
+	if len(v) != len(ci.binaryTyps) {
+		return fmt.Errorf("pq: expected %d values in binary COPY row, got %d", len(ci.binaryTyps), len(v))
+	}
+
+	start := len(ci.buffer)
+	ci.buffer = appendUint16(ci.buffer, uint16(len(v)))
+	for i, value := range v {
+		if value == nil {
+			ci.buffer = appendUint32(ci.buffer, 0xffffffff) // -1 length for NULL
+			continue
+		}
+		lenPos := len(ci.buffer)
+		ci.buffer = append(ci.buffer, 0, 0, 0, 0)
+		var err error
+		ci.buffer, err = appendBinaryEncoded(&ci.cn.parameterStatus, ci.buffer, value, ci.binaryTyps[i])
+		if err != nil {
+			ci.buffer = ci.buffer[:start]
+			return err
+		}
+		binary.BigEndian.PutUint32(ci.buffer[lenPos:], uint32(len(ci.buffer)-lenPos-4))
+	}
+	return nil
+}
+
 func (ci *copyin) Close() (err error) {
 	if ci.closed {
 		return errCopyInClosed
@@ -249,6 +381,10 @@ func (ci *copyin) Close() (err error) {
 	}
 	defer ci.cn.errRecover(&err)
 
+	if ci.binaryTyps != nil {
+		// file trailer: a tuple field count of -1
+		ci.buffer = append(ci.buffer, 0xff, 0xff)
+	}
 	if len(ci.buffer) > 0 {
 		ci.flush(ci.buffer)
 	}
@@ -264,5 +400,485 @@ func (ci *copyin) Close() (err error) {
 		err = ci.err
 		return err
 	}
+	ci.result, _ = ci.cn.parseComplete(ci.tag)
 	return nil
 }
+
+// CopyOut executes query, which must be a COPY ... TO STDOUT statement, on c
+// and writes the data it produces to w.  c must be a connection returned by
+// Open or DialOpen.  The data is written to w exactly as sent by the server,
+// with one Write call per CopyData message (which is one row in the text and
+// CSV formats), so its layout depends on the options given to COPY.  CopyOut
+// returns the number of rows copied.
+//
+// If a call to w.Write fails, the rest of the data is read and discarded so
+// that c remains usable, and the error from w is returned.
+func CopyOut(c driver.Conn, w io.Writer, query string) (int64, error) {
+	cn, ok := c.(*conn)
+	if !ok {
+		return 0, fmt.Errorf("pq: CopyOut called with a connection of type %T", c)
+	}
+	// The data is passed on as it is, so there's no need for the types.
+	rows, err := cn.queryCopyOut(query, false)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		data, err := rows.nextData()
+		if err == io.EOF {
+			return rows.RowsCopied(), nil
+		} else if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if _, err := w.Write(data); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return 0, cerr
+			}
+			return 0, err
+		}
+	}
+}
+
+// CopyOutRows iterates over the rows produced by a COPY ... TO STDOUT
+// statement.  See QueryCopyOut.
+type CopyOutRows struct {
+	cn      *conn
+	binary  bool
+	numCols int
+	done    bool
+	copied  int64
+	err     error
+
+	rb  readBuf
+	buf []byte
+
+	// the types of the columns, if they could be looked up
+	typs []oid.Oid
+}
+
+// QueryCopyOut executes query, which must be a COPY ... TO STDOUT statement
+// in the default text format, on c.  c must be a connection returned by Open
+// or DialOpen.  The returned CopyOutRows must be closed before c is used for
+// anything else.
+//
+// Each field is unescaped according to the rules of the COPY text format, the
+// inverse of the encoding used by CopyIn, and then decoded into the value
+// Query returns for its column's type, or nil for NULL.  For instance, bigint
+// columns are returned as int64 values and bytea columns as the raw bytes.
+// To find the types of the columns, the table or query the COPY reads from is
+// described before the COPY is executed, in a savepoint if c is in a
+// transaction.  If query is too unusual for its source to be made out, for
+// example because the source query contains comments or dollar quotes, or if
+// the source can't be described, every field is returned as the []byte of
+// its text.
+func QueryCopyOut(c driver.Conn, query string) (*CopyOutRows, error) {
+	cn, ok := c.(*conn)
+	if !ok {
+		return nil, fmt.Errorf("pq: QueryCopyOut called with a connection of type %T", c)
+	}
+	return cn.queryCopyOut(query, true)
+}
+
+// copyOutSavepoint is the savepoint in which copyOutTypes runs its lookup in
+// a transaction.
+const copyOutSavepoint = "pq_copy_out_lookup"
+
+// copyOutTypes returns the types of the columns of lookup, the query made by
+// copyOutLookup, or nil if they can't be looked up; the COPY might still
+// succeed, for instance if the lookup can't express it or isn't permitted.
+// In a transaction, the lookup runs in a savepoint, so that its failure
+// doesn't abort the transaction.  In a failed transaction, there's nothing to
+// look up, since the COPY fails too.
+func (cn *conn) copyOutTypes(lookup string) []oid.Oid {
+	switch cn.txnStatus {
+	case txnStatusIdle:
+	case txnStatusIdleInTransaction:
+		if _, _, err := cn.simpleExec("SAVEPOINT " + copyOutSavepoint); err != nil {
+			panic(err)
+		}
+	default:
+		return nil
+	}
+
+	st, err := cn.prepareTo(lookup, "")
+	if cn.txnStatus != txnStatusIdle {
+		q := "RELEASE SAVEPOINT " + copyOutSavepoint
+		if err != nil {
+			q = "ROLLBACK TO SAVEPOINT " + copyOutSavepoint + "; " + q
+		}
+		if _, _, err := cn.simpleExec(q); err != nil {
+			panic(err)
+		}
+	}
+	if err != nil {
+		return nil
+	}
+	return st.rowTyps
+}
+
+// queryCopyOut executes the COPY ... TO STDOUT statement q.  If lookupTypes
+// is set, the types of the columns are looked up first.
+func (cn *conn) queryCopyOut(q string, lookupTypes bool) (_ *CopyOutRows, err error) {
+	if cn.bad {
+		return nil, driver.ErrBadConn
+	}
+	defer cn.errRecover(&err)
+
+	var typs []oid.Oid
+	if lookup, ok := copyOutLookup(q); ok && lookupTypes {
+		typs = cn.copyOutTypes(lookup)
+	}
+
+	b := cn.writeBuf('Q')
+	b.string(q)
+	cn.send(b)
+
+	for {
+		t, r := cn.recv1()
+		switch t {
+		case 'H':
+			co := &CopyOutRows{cn: cn}
+			co.binary = r.byte() != 0
+			co.numCols = r.int16()
+			// Columns which SELECT * includes, but COPY doesn't, such as
+			// generated columns, make the lookup useless.
+			if len(typs) == co.numCols {
+				co.typs = typs
+			}
+			return co, nil
+		case 'G':
+			// We have nothing to send; abort the COPY, and wait for the
+			// server to acknowledge that with an ErrorResponse.
+			err = errCopyFromNotSupported
+			b := cn.writeBuf('f')
+			b.string(err.Error())
+			cn.send(b)
+		case 'E':
+			if err == nil {
+				err = parseError(r)
+			}
+		case 'Z':
+			cn.processReadyForQuery(r)
+			if err == nil {
+				err = errNotCopyOut
+			}
+			return nil, err
+		case 'T', 'D', 'C', 'I':
+			// not a COPY TO STDOUT; ignore any results
+		default:
+			cn.bad = true
+			errorf("unknown response for copy query: %q", t)
+		}
+	}
+}
+
+// nextData returns the contents of the next CopyData message.  The data is
+// only valid until the next call.  Once the COPY is over, nextData returns the
+// error reported by the server, if any, or io.EOF.
+func (co *CopyOutRows) nextData() (data []byte, err error) {
+	if co.done {
+		if co.err != nil {
+			return nil, co.err
+		}
+		return nil, io.EOF
+	}
+
+	cn := co.cn
+	if cn.bad {
+		return nil, driver.ErrBadConn
+	}
+	defer cn.errRecover(&err)
+
+	for {
+		t := cn.recv1Buf(&co.rb)
+		switch t {
+		case 'd':
+			return co.rb, nil
+		case 'c':
+			// CopyDone; CommandComplete follows
+		case 'C':
+			res, _ := cn.parseComplete(co.rb.string())
+			co.copied, _ = res.RowsAffected()
+		case 'E':
+			co.err = parseError(&co.rb)
+		case 'Z':
+			cn.processReadyForQuery(&co.rb)
+			co.done = true
+			if co.err != nil {
+				return nil, co.err
+			}
+			return nil, io.EOF
+		default:
+			cn.bad = true
+			errorf("unexpected message during COPY TO STDOUT: %q", t)
+		}
+	}
+}
+
+// NumColumns returns the number of columns in each row.
+func (co *CopyOutRows) NumColumns() int {
+	return co.numCols
+}
+
+// Next decodes the next row into dest, which must have room for
+// NumColumns() values.  The []byte values stored in dest are only valid until
+// the next call to Next or Close.  Next returns io.EOF once all rows have been
+// read.
+func (co *CopyOutRows) Next(dest []driver.Value) (err error) {
+	if co.binary && !co.done {
+		return errBinaryCopyNotSupported
+	}
+	data, err := co.nextData()
+	if err != nil {
+		return err
+	}
+	if len(dest) < co.numCols {
+		return fmt.Errorf("pq: expected room for %d values in dest, got %d", co.numCols, len(dest))
+	}
+	co.buf, err = decodeCopyRow(co.buf[:0], data, dest[:co.numCols])
+	if err != nil || co.typs == nil {
+		return err
+	}
+	defer co.cn.errRecover(&err)
+	for i, typ := range co.typs {
+		if dest[i] != nil {
+			dest[i] = decode(&co.cn.parameterStatus, dest[i].([]byte), typ, formatText)
+		}
+	}
+	return nil
+}
+
+// RowsCopied returns the number of rows reported by the server when the COPY
+// completed.  It returns 0 until Next has returned io.EOF.
+func (co *CopyOutRows) RowsCopied() int64 {
+	return co.copied
+}
+
+// Close reads and discards any remaining rows, making the connection usable
+// again.  It returns the error reported by the server, if any.
+func (co *CopyOutRows) Close() error {
+	for {
+		_, err := co.nextData()
+		switch err {
+		case nil:
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// copyOutLookup returns a query which has the same columns as the COPY ... TO
+// STDOUT statement q, so that their types can be found by describing it.  ok
+// is false if the table or query which q copies from can't be made out.
+func copyOutLookup(q string) (lookup string, ok bool) {
+	q = strings.TrimLeft(q, copySpace)
+	if len(q) < 5 || !strings.EqualFold(q[:4], "COPY") || !isCopySpace(q[4]) {
+		return "", false
+	}
+	q = strings.TrimLeft(q[4:], copySpace)
+
+	var rest string
+	if strings.HasPrefix(q, "(") {
+		end, ok := copyParenEnd(q)
+		if !ok {
+			return "", false
+		}
+		lookup, rest = q[1:end], q[end+1:]
+	} else {
+		// a possibly qualified and quoted table name, and a column list
+		i := 0
+		for quoted := false; i < len(q); i++ {
+			c := q[i]
+			if c == '"' {
+				quoted = !quoted
+			} else if !quoted && !(c == '_' || c == '.' || c >= 0x80 ||
+				'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+				break
+			}
+		}
+		table := q[:i]
+		rest = strings.TrimLeft(q[i:], copySpace)
+		columns := "*"
+		if strings.HasPrefix(rest, "(") {
+			end, ok := copyParenEnd(rest)
+			if !ok {
+				return "", false
+			}
+			columns, rest = rest[1:end], rest[end+1:]
+		}
+		if table == "" {
+			return "", false
+		}
+		lookup = "SELECT " + columns + " FROM " + table + " LIMIT 0"
+	}
+
+	rest = strings.TrimLeft(rest, copySpace)
+	if len(rest) < 3 || !strings.EqualFold(rest[:2], "TO") || !isCopySpace(rest[2]) {
+		return "", false
+	}
+	return lookup, true
+}
+
+const copySpace = " \t\r\n"
+
+func isCopySpace(c byte) bool {
+	return strings.IndexByte(copySpace, c) >= 0
+}
+
+// copyParenEnd returns the index of the parenthesis which closes the one s
+// starts with.  Only quoted identifiers and standard string literals are
+// recognized, so ok is false if s contains anything else which could hide a
+// parenthesis, such as comments or dollar quotes.
+func copyParenEnd(s string) (end int, ok bool) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' {
+				return 0, false
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i, true
+			}
+		case c == '$' || strings.HasPrefix(s[i:], "--") || strings.HasPrefix(s[i:], "/*"):
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// decodeCopyRow splits a row in the COPY text format into its fields and
+// unescapes them, storing the results in dest.  The unescaped data is
+// appended to buf, and the extended buffer is returned.
+func decodeCopyRow(buf, row []byte, dest []driver.Value) ([]byte, error) {
+	if n := len(row); n > 0 && row[n-1] == '\n' {
+		row = row[:n-1]
+	}
+
+	// Unescape all fields into buf first, since appending to it may move it.
+	var ends [][2]int
+	for i := 0; ; i++ {
+		if i >= len(dest) {
+			return buf, fmt.Errorf("pq: COPY row has more than %d fields", len(dest))
+		}
+		end := bytes.IndexByte(row, '\t')
+		field := row
+		if end >= 0 {
+			field = row[:end]
+		}
+		if string(field) == `\N` {
+			ends = append(ends, [2]int{-1, -1})
+		} else {
+			start := len(buf)
+			var err error
+			if buf, err = appendCopyUnescaped(buf, field); err != nil {
+				return buf, err
+			}
+			ends = append(ends, [2]int{start, len(buf)})
+		}
+		if end < 0 {
+			break
+		}
+		row = row[end+1:]
+	}
+	if len(ends) != len(dest) {
+		return buf, fmt.Errorf("pq: COPY row has %d fields, expected %d", len(ends), len(dest))
+	}
+
+	for i, e := range ends {
+		if e[0] < 0 {
+			dest[i] = nil
+		} else {
+			dest[i] = buf[e[0]:e[1]:e[1]]
+		}
+	}
+	return buf, nil
+}
+
+// appendCopyUnescaped appends field, a value in the COPY text format, to buf
+// with all backslash escape sequences replaced by the characters they stand
+// for.
+//
+// See http://www.postgresql.org/docs/current/static/sql-copy.html#AEN66874
+func appendCopyUnescaped(buf, field []byte) ([]byte, error) {
+	for {
+		i := bytes.IndexByte(field, '\\')
+		if i < 0 {
+			return append(buf, field...), nil
+		}
+		buf = append(buf, field[:i]...)
+		field = field[i+1:]
+		if len(field) == 0 {
+			return buf, errors.New("pq: COPY field ends with an incomplete escape sequence")
+		}
+
+		c := field[0]
+		field = field[1:]
+		switch c {
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'v':
+			buf = append(buf, '\v')
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// up to three octal digits
+			v := c - '0'
+			for j := 0; j < 2 && len(field) > 0 && field[0] >= '0' && field[0] <= '7'; j++ {
+				v = v<<3 | (field[0] - '0')
+				field = field[1:]
+			}
+			buf = append(buf, v)
+		case 'x':
+			// one or two hex digits; a lone \x stands for an x
+			var v byte
+			j := 0
+			for ; j < 2 && j < len(field); j++ {
+				d, ok := unhex(field[j])
+				if !ok {
+					break
+				}
+				v = v<<4 | d
+			}
+			if j == 0 {
+				buf = append(buf, 'x')
+			} else {
+				buf = append(buf, v)
+				field = field[j:]
+			}
+		default:
+			buf = append(buf, c)
+		}
+	}
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
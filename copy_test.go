@@ -3,8 +3,15 @@ package pq
 import (
 	"bytes"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/lib/pq/oid"
 )
 
 func TestCopyInStmt(t *testing.T) {
@@ -73,10 +80,13 @@ func TestCopyInMultipleValues(t *testing.T) {
 		}
 	}
 
-	_, err = stmt.Exec()
+	res, err := stmt.Exec()
 	if err != nil {
 		t.Fatal(err)
 	}
+	if n, _ := res.RowsAffected(); n != 500 {
+		t.Fatalf("expected 500 rows copied, not %d", n)
+	}
 
 	err = stmt.Close()
 	if err != nil {
@@ -460,3 +470,830 @@ func BenchmarkCopyIn(b *testing.B) {
 		b.Fatalf("expected %d items, not %d", b.N, num)
 	}
 }
+
+func TestAppendCopyUnescaped(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{``, ``},
+		{`abc`, `abc`},
+		{`a\tb\nc\rd`, "a\tb\nc\rd"},
+		{`\b\f\v`, "\b\f\v"},
+		{`\\x00`, `\x00`},
+		{`\101\0102`, "A\b2"},
+		{`\x41\x4a\x4Bc\xg`, "AJKcxg"},
+		{`\x7`, "\x07"},
+		{`\.\N`, `.N`},
+	}
+	for _, tt := range tests {
+		got, err := appendCopyUnescaped([]byte("prefix"), []byte(tt.in))
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if string(got) != "prefix"+tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got[len("prefix"):], tt.want)
+		}
+	}
+
+	if _, err := appendCopyUnescaped(nil, []byte(`abc\`)); err == nil {
+		t.Error("expected an error for an incomplete escape sequence")
+	}
+}
+
+func TestDecodeCopyRow(t *testing.T) {
+	dest := make([]driver.Value, 4)
+	buf, err := decodeCopyRow(nil, []byte("1\t\\N\t\t\\\\x0102\n"), dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []driver.Value{[]byte("1"), nil, []byte{}, []byte(`\x0102`)}
+	if !reflect.DeepEqual(dest, want) {
+		t.Fatalf("got %q, want %q", dest, want)
+	}
+
+	// the buffer is reused
+	if _, err := decodeCopyRow(buf[:0], []byte("a\tb\tc\td\n"), dest); err != nil {
+		t.Fatal(err)
+	}
+	if string(dest[0].([]byte)) != "a" || string(dest[3].([]byte)) != "d" {
+		t.Fatalf("unexpected values %q", dest)
+	}
+
+	for _, row := range []string{"1\t2\t3\n", "1\t2\t3\t4\t5\n", "1\t2\t3\t\\\n"} {
+		if _, err := decodeCopyRow(nil, []byte(row), dest); err == nil {
+			t.Errorf("%q: expected an error", row)
+		}
+	}
+}
+
+// TestCopyRoundTripEncoding checks that values encoded by CopyIn are decoded
+// back by CopyOut.
+func TestCopyRoundTripEncoding(t *testing.T) {
+	values := []driver.Value{
+		int64(-42),
+		"tab\there\nnewline\\backslash\rcr",
+		[]byte{0, '\t', '\\', 0xff},
+		nil,
+		true,
+	}
+	var row []byte
+	for i, v := range values {
+		if i > 0 {
+			row = append(row, '\t')
+		}
+		row = appendEncodedText(&parameterStatus{serverVersion: 90000}, row, v)
+	}
+	row = append(row, '\n')
+
+	dest := make([]driver.Value, len(values))
+	if _, err := decodeCopyRow(nil, row, dest); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(dest[0].([]byte)); got != "-42" {
+		t.Errorf("int64: got %q", got)
+	}
+	if got := string(dest[1].([]byte)); got != values[1] {
+		t.Errorf("string: got %q", got)
+	}
+	if got, err := parseBytea(dest[2].([]byte)); err != nil || !bytes.Equal(got, values[2].([]byte)) {
+		t.Errorf("bytea: got %q, %v", got, err)
+	}
+	if dest[3] != nil {
+		t.Errorf("nil: got %q", dest[3])
+	}
+	if got := string(dest[4].([]byte)); got != "true" {
+		t.Errorf("bool: got %q", got)
+	}
+}
+
+func sendCopyOutResponse(s *fakeServer, format byte, numCols int) {
+	w := newFakeMessage('H')
+	w.byte(format)
+	w.int16(numCols)
+	for i := 0; i < numCols; i++ {
+		w.int16(int(format))
+	}
+	s.send(w)
+}
+
+func sendCopyData(s *fakeServer, data string) {
+	w := newFakeMessage('d')
+	w.bytes([]byte(data))
+	s.send(w)
+}
+
+func TestCopyOutFake(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+
+		s.expectQuery("COPY temp TO STDOUT")
+		sendCopyOutResponse(s, 0, 2)
+		sendCopyData(s, "1\ta\n")
+		s.sendNotice("NOTICE", "00000", "halfway")
+		sendCopyData(s, "2\t\\N\n")
+		s.send(newFakeMessage('c'))
+		s.sendCommandComplete("COPY 2")
+		s.sendReadyForQuery()
+
+		s.expectQuery("COPY temp TO STDOUT")
+		sendCopyOutResponse(s, 0, 2)
+		sendCopyData(s, "1\ta\n")
+		s.sendError("ERROR", "57014", "canceling statement due to user request")
+		s.sendReadyForQuery()
+
+		s.expectQuery("SELECT 1")
+		s.sendCommandComplete("SELECT 1")
+		s.sendReadyForQuery()
+
+		s.expectQuery("COPY temp FROM STDIN")
+		w := newFakeMessage('G')
+		w.byte(0)
+		w.int16(0)
+		s.send(w)
+		s.expect('f')
+		s.sendError("ERROR", "57014", "COPY from stdin failed")
+		s.sendReadyForQuery()
+
+		s.expectQuery("COPY temp TO STDOUT")
+		sendCopyOutResponse(s, 0, 1)
+		sendCopyData(s, "1\n")
+		sendCopyData(s, "2\n")
+		s.send(newFakeMessage('c'))
+		s.sendCommandComplete("COPY 2")
+		s.sendReadyForQuery()
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.(*conn).c.Close()
+
+	var notices int
+	SetNoticeHandler(cn, func(*Error) { notices++ })
+
+	var buf bytes.Buffer
+	n, err := CopyOut(cn, &buf, "COPY temp TO STDOUT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rows, got %d", n)
+	}
+	if got := buf.String(); got != "1\ta\n2\t\\N\n" {
+		t.Errorf("unexpected data %q", got)
+	}
+	if notices != 1 {
+		t.Errorf("expected 1 notice, got %d", notices)
+	}
+
+	buf.Reset()
+	_, err = CopyOut(cn, &buf, "COPY temp TO STDOUT")
+	if pge, ok := err.(*Error); !ok || pge.Code.Name() != "query_canceled" {
+		t.Errorf("expected query_canceled, got %v", err)
+	}
+
+	if _, err = CopyOut(cn, &buf, "SELECT 1"); err != errNotCopyOut {
+		t.Errorf("expected %v, got %v", errNotCopyOut, err)
+	}
+	if _, err = CopyOut(cn, &buf, "COPY temp FROM STDIN"); err != errCopyFromNotSupported {
+		t.Errorf("expected %v, got %v", errCopyFromNotSupported, err)
+	}
+
+	// a failing writer must leave the connection usable
+	_, err = CopyOut(cn, failWriter{}, "COPY temp TO STDOUT")
+	if err != errWriteFailed {
+		t.Errorf("expected %v, got %v", errWriteFailed, err)
+	}
+	if cn.(*conn).bad {
+		t.Error("connection was marked bad")
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+var errWriteFailed = errors.New("write failed")
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, errWriteFailed }
+
+func TestCopyOutLookup(t *testing.T) {
+	tests := []struct {
+		stmt, lookup string
+	}{
+		{"COPY temp TO STDOUT", "SELECT * FROM temp LIMIT 0"},
+		{"copy\n\"s (\".t (a, \"b)\")  to stdout (FORMAT csv)", `SELECT a, "b)" FROM "s (".t LIMIT 0`},
+		{"COPY (SELECT ')', f(x) FROM t) TO STDOUT", "SELECT ')', f(x) FROM t"},
+		{"COPY (DELETE FROM t RETURNING *) TO STDOUT", "DELETE FROM t RETURNING *"},
+		{"COPY (SELECT 1 -- )\n) TO STDOUT", ""},
+		{"COPY (SELECT $$)$$) TO STDOUT", ""},
+		{"COPY (SELECT E'\\')') TO STDOUT", ""},
+		{"COPY (SELECT 1 TO STDOUT", ""},
+		{"COPY temp FROM STDIN", ""},
+		{"COPY temp; SELECT 1", ""},
+		{"SELECT 1", ""},
+	}
+	for _, tt := range tests {
+		lookup, ok := copyOutLookup(tt.stmt)
+		if ok != (tt.lookup != "") || lookup != tt.lookup {
+			t.Errorf("%s: got %q, %v, want %q", tt.stmt, lookup, ok, tt.lookup)
+		}
+	}
+}
+
+// expectCopyOutLookup reads the Parse, Describe and Sync messages of the
+// lookup of the column types of a COPY ... TO STDOUT statement, and answers
+// them with typs.
+func (s *fakeServer) expectCopyOutLookup(query string, typs ...oid.Oid) {
+	r := s.expect('P')
+	r.string()
+	if q := r.string(); q != query {
+		s.fail("unexpected lookup query %q", q)
+	}
+	s.expect('D')
+	s.expect('S')
+	s.send(newFakeMessage('1'))
+	w := newFakeMessage('t')
+	w.int16(0)
+	s.send(w)
+	s.sendRowDescription(make([]string, len(typs)), typs)
+	s.sendReadyForQuery()
+}
+
+func TestQueryCopyOutLookupFails(t *testing.T) {
+	failLookup := func(s *fakeServer, status transactionStatus) {
+		s.expect('P')
+		s.expect('D')
+		s.expect('S')
+		s.sendError("ERROR", "42501", "permission denied for table temp")
+		s.sendReadyForQueryStatus(status)
+	}
+	copyOut := func(s *fakeServer, status transactionStatus) {
+		s.expectQuery("COPY temp TO STDOUT")
+		sendCopyOutResponse(s, 0, 1)
+		sendCopyData(s, "1\n")
+		s.send(newFakeMessage('c'))
+		s.sendCommandComplete("COPY 1")
+		s.sendReadyForQueryStatus(status)
+	}
+	inTxn := txnStatusIdleInTransaction
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		failLookup(s, txnStatusIdle)
+		copyOut(s, txnStatusIdle)
+
+		s.expectQuery("BEGIN")
+		s.sendCommandComplete("BEGIN")
+		s.sendReadyForQueryStatus(inTxn)
+		// the failure is confined to a savepoint
+		s.expectQuery("SAVEPOINT pq_copy_out_lookup")
+		s.sendCommandComplete("SAVEPOINT")
+		s.sendReadyForQueryStatus(inTxn)
+		failLookup(s, txnStatusInFailedTransaction)
+		s.expectQuery("ROLLBACK TO SAVEPOINT pq_copy_out_lookup; RELEASE SAVEPOINT pq_copy_out_lookup")
+		s.sendCommandComplete("ROLLBACK")
+		s.sendCommandComplete("RELEASE")
+		s.sendReadyForQueryStatus(inTxn)
+		copyOut(s, inTxn)
+
+		s.expectQuery("SAVEPOINT pq_copy_out_lookup")
+		s.sendCommandComplete("SAVEPOINT")
+		s.sendReadyForQueryStatus(inTxn)
+		s.expect('P')
+		s.expect('D')
+		s.expect('S')
+		s.send(newFakeMessage('1'))
+		w := newFakeMessage('t')
+		w.int16(0)
+		s.send(w)
+		s.sendRowDescription([]string{"i"}, []oid.Oid{oid.T_int8})
+		s.sendReadyForQueryStatus(inTxn)
+		s.expectQuery("RELEASE SAVEPOINT pq_copy_out_lookup")
+		s.sendCommandComplete("RELEASE")
+		s.sendReadyForQueryStatus(inTxn)
+		copyOut(s, inTxn)
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.(*conn).c.Close()
+
+	check := func(want driver.Value) {
+		rows, err := QueryCopyOut(cn, "COPY temp TO STDOUT")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest := make([]driver.Value, 1)
+		if err := rows.Next(dest); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(dest[0], want) {
+			t.Errorf("got %#v, want %#v", dest[0], want)
+		}
+		if err := rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check([]byte("1"))
+	if _, err := cn.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	check([]byte("1"))
+	if cn.(*conn).txnStatus != inTxn {
+		t.Errorf("got transaction status %v", cn.(*conn).txnStatus)
+	}
+	check(int64(1))
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryCopyOutFake(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+
+		s.expectCopyOutLookup("SELECT * FROM temp LIMIT 0", oid.T_int8, oid.T_bytea, oid.T_text)
+		s.expectQuery("COPY temp TO STDOUT")
+		sendCopyOutResponse(s, 0, 3)
+		sendCopyData(s, "1\thello\\tworld\t\\N\n")
+		sendCopyData(s, "2\t\\\\x00ff\t\n")
+		sendCopyData(s, "3\tx\ty\n")
+		s.send(newFakeMessage('c'))
+		s.sendCommandComplete("COPY 3")
+		s.sendReadyForQuery()
+
+		// the types are ignored if the columns don't match
+		s.expectCopyOutLookup("SELECT * FROM temp LIMIT 0", oid.T_int8)
+		s.expectQuery("COPY temp TO STDOUT")
+		sendCopyOutResponse(s, 0, 2)
+		sendCopyData(s, "1\t2\n")
+		s.send(newFakeMessage('c'))
+		s.sendCommandComplete("COPY 1")
+		s.sendReadyForQuery()
+
+		s.expectCopyOutLookup("SELECT * FROM temp LIMIT 0", oid.T_int8)
+		s.expectQuery("COPY temp TO STDOUT (FORMAT binary)")
+		sendCopyOutResponse(s, 1, 1)
+		sendCopyData(s, "PGCOPY\n\xff\r\n\x00")
+		s.send(newFakeMessage('c'))
+		s.sendCommandComplete("COPY 0")
+		s.sendReadyForQuery()
+
+		s.expectQuery("SELECT 1")
+		s.sendCommandComplete("SELECT 1")
+		s.sendReadyForQuery()
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.(*conn).c.Close()
+
+	rows, err := QueryCopyOut(cn, "COPY temp TO STDOUT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows.NumColumns() != 3 {
+		t.Fatalf("expected 3 columns, got %d", rows.NumColumns())
+	}
+	dest := make([]driver.Value, 3)
+	if err := rows.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if want := []driver.Value{int64(1), []byte("hello\tworld"), nil}; !reflect.DeepEqual(dest, want) {
+		t.Errorf("got %q, want %q", dest, want)
+	}
+	if err := rows.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if want := []driver.Value{int64(2), []byte{0, 0xff}, []byte{}}; !reflect.DeepEqual(dest, want) {
+		t.Errorf("got %q, want %q", dest, want)
+	}
+	if rows.RowsCopied() != 0 {
+		t.Errorf("expected no row count before the end, got %d", rows.RowsCopied())
+	}
+	// Close discards the remaining row
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if rows.RowsCopied() != 3 {
+		t.Errorf("expected 3 rows, got %d", rows.RowsCopied())
+	}
+	if err := rows.Next(dest); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	rows, err = QueryCopyOut(cn, "COPY temp TO STDOUT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rows.Next(dest[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if want := []driver.Value{[]byte("1"), []byte("2")}; !reflect.DeepEqual(dest[:2], want) {
+		t.Errorf("got %q, want %q", dest[:2], want)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err = QueryCopyOut(cn, "COPY temp TO STDOUT (FORMAT binary)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rows.Next(dest); err != errBinaryCopyNotSupported {
+		t.Errorf("expected %v, got %v", errBinaryCopyNotSupported, err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cn.(driver.Execer).Exec("SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyOut(t *testing.T) {
+	// sets up the environment for Open
+	db := openTestConn(t)
+	defer db.Close()
+
+	cn, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.Close()
+
+	_, err = cn.(driver.Execer).Exec(`CREATE TEMP TABLE temp AS
+		SELECT i AS a, E'tab\tnew\nline' AS b, decode(lpad(to_hex(i), 4, '0'), 'hex') AS c
+		FROM generate_series(0, 255) i`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := CopyOut(cn, &buf, "COPY temp TO STDOUT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 256 {
+		t.Fatalf("expected 256 rows, got %d", n)
+	}
+	if want := "0\ttab\\tnew\\nline\t\\\\x0000\n"; !strings.HasPrefix(buf.String(), want) {
+		t.Fatalf("expected data to start with %q, got %q", want, buf.String())
+	}
+
+	rows, err := QueryCopyOut(cn, "COPY temp TO STDOUT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, rows.NumColumns())
+	i := 0
+	for ; ; i++ {
+		err := rows.Next(dest)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if dest[0] != int64(i) {
+			t.Fatalf("unexpected value %v", dest[0])
+		}
+		if string(dest[1].([]byte)) != "tab\tnew\nline" {
+			t.Fatalf("unexpected value %q", dest[1])
+		}
+		if !bytes.Equal(dest[2].([]byte), []byte{0, byte(i)}) {
+			t.Fatalf("unexpected value %q", dest[2])
+		}
+	}
+	if i != 256 || rows.RowsCopied() != 256 {
+		t.Fatalf("expected 256 rows, got %d and %d", i, rows.RowsCopied())
+	}
+}
+
+// TestCopyInOutRoundTrip checks that values copied in by CopyIn are returned
+// as they were by QueryCopyOut.
+func TestCopyInOutRoundTrip(t *testing.T) {
+	// sets up the environment for Open
+	db := openTestConn(t)
+	defer db.Close()
+
+	cn, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.Close()
+
+	txn, err := cn.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer txn.Rollback()
+	_, err = cn.(driver.Execer).Exec("CREATE TEMP TABLE temp (a bytea, b int8, c bool, d timestamptz)", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := []driver.Value{
+		[]byte{0, '\t', '\\', 0xff},
+		int64(-1) << 40,
+		true,
+		time.Date(2001, 2, 3, 4, 5, 6, 789000000, time.FixedZone("", -7*3600)),
+	}
+	stmt, err := cn.Prepare(CopyIn("temp", "a", "b", "c", "d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.Exec(in); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.Exec(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := stmt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := QueryCopyOut(cn, "COPY temp TO STDOUT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, len(in))
+	if err := rows.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dest[0].([]byte), in[0].([]byte)) {
+		t.Errorf("bytea: got %q", dest[0])
+	}
+	if dest[1] != in[1] || dest[2] != in[2] {
+		t.Errorf("got %v and %v", dest[1], dest[2])
+	}
+	if got, ok := dest[3].(time.Time); !ok || !got.Equal(in[3].(time.Time)) {
+		t.Errorf("timestamptz: got %v", dest[3])
+	}
+}
+
+func TestCopyInBinaryStmt(t *testing.T) {
+	if stmt := CopyInBinary("table name", "a"); stmt != `COPY "table name" ("a") FROM STDIN WITH (FORMAT binary)` {
+		t.Fatal(stmt)
+	}
+	if stmt := CopyInSchemaBinary("schema", "table", "a", "b"); stmt != `COPY "schema"."table" ("a", "b") FROM STDIN WITH (FORMAT binary)` {
+		t.Fatal(stmt)
+	}
+}
+
+func TestCopyInBinaryLookup(t *testing.T) {
+	tests := []struct {
+		stmt, lookup string
+	}{
+		{CopyInBinary("temp", "a", "b"), `SELECT "a", "b" FROM "temp" LIMIT 0`},
+		{CopyInBinary("temp"), `SELECT * FROM "temp" LIMIT 0`},
+		{CopyInSchemaBinary("s (", "t) (", `c "(`), `SELECT "c ""(" FROM "s ("."t) (" LIMIT 0`},
+		{"COPY temp (a) FROM STDIN WITH (FORMAT binary)", `SELECT a FROM temp LIMIT 0`},
+		{CopyIn("temp", "a"), ""},
+		{"COPY temp (a) FROM STDIN WITH binary", ""},
+		{"COPY (a) FROM STDIN WITH (FORMAT binary)", ""},
+	}
+	for _, tt := range tests {
+		lookup, ok := copyInBinaryLookup(tt.stmt)
+		if ok != (tt.lookup != "") || lookup != tt.lookup {
+			t.Errorf("%s: got %q, %v, want %q", tt.stmt, lookup, ok, tt.lookup)
+		}
+	}
+}
+
+func TestCopyInBinaryFake(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+
+		s.expectQuery("BEGIN")
+		s.sendCommandComplete("BEGIN")
+		s.sendReadyForQueryStatus(txnStatusIdleInTransaction)
+
+		r := s.expect('P')
+		r.string()
+		if q := r.string(); q != `SELECT "a", "b" FROM "temp" LIMIT 0` {
+			s.fail("unexpected lookup query %q", q)
+		}
+		s.expect('D')
+		s.expect('S')
+		s.send(newFakeMessage('1'))
+		w := newFakeMessage('t')
+		w.int16(0)
+		s.send(w)
+		w = newFakeMessage('T')
+		w.int16(2)
+		for _, typ := range []oid.Oid{oid.T_int4, oid.T_text} {
+			w.string("col")
+			w.int32(0)
+			w.int16(0)
+			w.int32(int(typ))
+			w.int16(4)
+			w.int32(-1)
+			w.int16(0)
+		}
+		s.send(w)
+		s.sendReadyForQueryStatus(txnStatusIdleInTransaction)
+
+		s.expectQuery(CopyInBinary("temp", "a", "b"))
+		w = newFakeMessage('G')
+		w.byte(1)
+		w.int16(2)
+		w.int16(1)
+		w.int16(1)
+		s.send(w)
+
+		var data []byte
+		for {
+			t, r := s.recv()
+			if t == 'c' {
+				break
+			} else if t != 'd' {
+				s.fail("unexpected message %q", t)
+			}
+			data = append(data, r...)
+		}
+		want := "PGCOPY\n\xff\r\n\x00\x00\x00\x00\x00\x00\x00\x00\x00" +
+			"\x00\x02\x00\x00\x00\x04\x00\x00\x00\x01\x00\x00\x00\x02hi" +
+			"\x00\x02\xff\xff\xff\xff\x00\x00\x00\x00" +
+			"\xff\xff"
+		if string(data) != want {
+			s.fail("unexpected COPY data %q", data)
+		}
+		s.sendCommandComplete("COPY 2")
+		s.sendReadyForQueryStatus(txnStatusIdleInTransaction)
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.(*conn).c.Close()
+
+	if _, err := cn.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := cn.Prepare(CopyInBinary("temp", "a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.Exec([]driver.Value{int64(1), "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	// a row which fails to encode must not leave anything in the buffer
+	if _, err := stmt.Exec([]driver.Value{"x", "hi"}); err == nil {
+		t.Fatal("expected an error for an invalid integer")
+	}
+	if _, err := stmt.Exec([]driver.Value{int64(1)}); err == nil {
+		t.Fatal("expected an error for a missing value")
+	}
+	if _, err := stmt.Exec([]driver.Value{nil, ""}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := stmt.Exec(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("got %d rows copied, want 2", n)
+	}
+	if tag := res.(Result).CommandTag(); tag != "COPY 2" {
+		t.Errorf("got command tag %q", tag)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyInBinaryUnsupportedType(t *testing.T) {
+	lookups := [][]oid.Oid{
+		{oid.T_int4, oid.T_numeric},
+		{oid.T_timestamptz},
+	}
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+
+		s.expectQuery("BEGIN")
+		s.sendCommandComplete("BEGIN")
+		s.sendReadyForQueryStatus(txnStatusIdleInTransaction)
+
+		for _, typs := range lookups {
+			s.expect('P')
+			s.expect('D')
+			s.expect('S')
+			s.send(newFakeMessage('1'))
+			w := newFakeMessage('t')
+			w.int16(0)
+			s.send(w)
+			w = newFakeMessage('T')
+			w.int16(len(typs))
+			for _, typ := range typs {
+				w.string("col")
+				w.int32(0)
+				w.int16(0)
+				w.int32(int(typ))
+				w.int16(-1)
+				w.int32(-1)
+				w.int16(0)
+			}
+			s.send(w)
+			s.sendReadyForQueryStatus(txnStatusIdleInTransaction)
+		}
+		// the COPY itself is never started
+		s.expect('X')
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.Close()
+
+	if _, err := cn.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cn.Prepare(CopyInBinary("temp", "a", "b")); err == nil || !strings.Contains(err.Error(), "1700") {
+		t.Errorf("numeric: got %v", err)
+	}
+	// the binary format of timestamps is a float8 without integer datetimes
+	cn.(*conn).parameterStatus.floatDatetimes = true
+	if _, err := cn.Prepare(CopyInBinary("temp", "a")); err == nil || !strings.Contains(err.Error(), "integer datetimes") {
+		t.Errorf("timestamptz: got %v", err)
+	}
+	if err := cn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyInBinary(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer txn.Rollback()
+
+	_, err = txn.Exec(`CREATE TEMP TABLE temp (
+		a int2, b int4, c int8, d float4, e float8, f bool, g bytea, h text,
+		i varchar, j date, k timestamp, l timestamptz, m uuid
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stmt, err := txn.Prepare(CopyInBinary("temp", "a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2017, 2, 3, 4, 5, 6, 789000000, time.FixedZone("", 3600))
+	_, err = stmt.Exec(int64(1), int64(2), int64(3), 4.5, 5.5, true, []byte{0, 1}, "tab\t",
+		"varchar", ts, ts, ts, "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stmt.Exec(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stmt.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if err = stmt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var text string
+	err = txn.QueryRow(`SELECT format('%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s', a, b, c, d, e, f, g, h, i, j, k,
+		l AT TIME ZONE 'UTC', m) FROM temp WHERE a IS NOT NULL`).Scan(&text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1|2|3|4.5|5.5|t|\\x0001|tab\t|varchar|2017-02-03|2017-02-03 04:05:06.789|2017-02-03 03:05:06.789|a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"
+	if text != want {
+		t.Fatalf("got %q, want %q", text, want)
+	}
+
+	var nulls int
+	if err = txn.QueryRow("SELECT count(*) FROM temp WHERE a IS NULL AND m IS NULL").Scan(&nulls); err != nil {
+		t.Fatal(err)
+	}
+	if nulls != 1 {
+		t.Fatalf("expected 1 row of NULLs, got %d", nulls)
+	}
+}
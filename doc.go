@@ -43,18 +43,26 @@ supported:
 	* dbname - The name of the database to connect to
 	* user - The user to sign in as
 	* password - The user's password
+	* passfile - The password file to look the password up in, if none is given (default is ~/.pgpass, or %APPDATA%\postgresql\pgpass.conf on Windows)
 	* host - The host to connect to. Values that start with / are for unix domain sockets. (default is localhost)
 	* port - The port to bind to. (default is 5432)
+	* service - The name of a service whose connection parameters are read from the service file
+	* servicefile - The service file (default is ~/.pg_service.conf, then pg_service.conf in PGSYSCONFDIR)
+	* target_session_attrs - Whether the server must accept read-write transactions ("read-write"), or whether any server will do ("any", the default)
 	* sslmode - Whether or not to use SSL (default is require, this is not the default for libpq)
 	* fallback_application_name - An application_name to fall back to if one isn't provided.
 	* connect_timeout - Maximum wait for connection, in seconds. Zero or not specified means wait indefinitely.
 	* sslcert - Cert file location. The file must contain PEM encoded data.
 	* sslkey - Key file location. The file must contain PEM encoded data.
 	* sslrootcert - The location of the root certificate file. The file must contain PEM encoded data.
+	* statement_cache_capacity - The number of prepared statements to cache per connection for queries with arguments. (default is 0, which disables the cache)
+	* disable_binary_parameters - Whether to always send query parameters in the text format ("yes"), or to send those of types with a binary representation, such as bytea and integers, in the binary format ("no", the default)
 
 Valid values for sslmode are:
 
 	* disable - No SSL
+	* allow - First try a connection without SSL, and if the server rejects it try again with SSL (skip verification)
+	* prefer - First try an SSL connection (skip verification), and if the server doesn't support SSL continue without it
 	* require - Always SSL (skip verification)
 	* verify-ca - Always SSL (verify that the certificate presented by the server was signed by a trusted CA)
 	* verify-full - Always SSL (verify that the certification presented by the server was signed by a trusted CA and the server host name matches the one in the certificate)
@@ -62,6 +70,26 @@ Valid values for sslmode are:
 See http://www.postgresql.org/docs/current/static/libpq-connect.html#LIBPQ-CONNSTRING
 for more information about connection string parameters.
 
+Several hosts can be given as comma-separated lists of hosts and ports.  They
+are tried in order until a connection succeeds, and, if target_session_attrs is
+"read-write", the server accepts read-write transactions.  A single port applies
+to all hosts.  In URLs, each host can be followed by its own port:
+
+	"host=db1,db2 port=5432,5433 target_session_attrs=read-write"
+	"postgres://db1:5432,db2:5433/mydb?target_session_attrs=read-write"
+
+If no password is given, pq looks one up in the password file, as described at
+http://www.postgresql.org/docs/current/static/libpq-pgpass.html.  As with libpq,
+the file is ignored on Unix if it can be read by the group or others.
+
+Services defined in a connection service file, as described at
+http://www.postgresql.org/docs/current/static/libpq-pgservice.html, can be
+named with the service parameter or the PGSERVICE environment variable.  The
+parameters of the service override the environment, and are in turn overridden
+by parameters given explicitly:
+
+	"service=reporting dbname=archive"
+
 Use single quotes for values that contain whitespace:
 
     "user=pqgotest password='with spaces'"
@@ -86,6 +114,18 @@ variables not supported by pq are set, pq will panic during connection
 establishment.  Environment variables have a lower precedence than explicitly
 provided connection parameters.
 
+Settings which can't be expressed in a connection string, such as a custom
+tls.Config or Dialer, can be given in a Config.  ParseConfig turns a connection
+string into a Config, and NewConnector turns the Config into a
+driver.Connector for sql.OpenDB:
+
+	cfg, err := pq.ParseConfig("user=pqgotest dbname=pqgotest sslmode=verify-full")
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.TLSConfig = &tls.Config{RootCAs: pool, ServerName: "db.example.com"}
+	db := sql.OpenDB(pq.NewConnector(cfg))
+
 
 Queries
 
@@ -110,8 +150,167 @@ For more details on RETURNING, see the Postgres documentation:
 	http://www.postgresql.org/docs/current/static/sql-update.html
 	http://www.postgresql.org/docs/current/static/sql-delete.html
 
+By default, a query with arguments is prepared as the unnamed statement every
+time it is run.  With statement_cache_capacity set, pq instead keeps the most
+recently used queries prepared as named statements on each connection, and
+deallocates the least recently used one when the cache is full.  A cached
+statement which the server refuses to run because a table it depends on has
+been altered is prepared again and, outside of transactions, retried.
+
+Parameters whose types, as described by the server, are bytea, int2, int4,
+int8, float4, float8, bool, timestamptz or uuid are sent in the binary format,
+which spares large bytea values the hex encoding.  A value which doesn't
+convert to its parameter's type is sent as text, so that the server reports
+the error as it would otherwise.
+
+The ColumnTypes method of sql.Rows reports the database type names of the
+result columns, the lengths of varchar and char columns, and the precision and
+scale of numeric columns.  ColumnTable additionally reports the table and the
+attribute number a column was taken from.
+
+A query without arguments may consist of several statements separated by
+semicolons.  Each statement which returns rows, even if none match, produces a
+result set, which sql.Rows.NextResultSet advances to:
+
+	rows, err := db.Query("SELECT id FROM users; SELECT id FROM groups")
+	...
+	for rows.Next() {
+		// users
+	}
+	rows.NextResultSet()
+	for rows.Next() {
+		// groups
+	}
+
+CommandTag returns the command tag, such as "SELECT 5", of the current result
+set of a driver.Rows.  Similarly, the driver.Result of statements executed on a
+driver.Conn is a pq.Result, whose CommandTag and Command methods report the
+command tag and the command which was executed.
+
 For additional instructions on querying see the documentation for the database/sql package.
 
+Arrays
+
+PostgreSQL arrays can be passed as query parameters and scanned from results by
+wrapping a slice (or a pointer to a slice, when scanning) with pq.Array:
+
+	db.Query(`SELECT * FROM t WHERE id = ANY($1)`, pq.Array([]int64{235, 401}))
+
+	var names []string
+	db.QueryRow(`SELECT array_agg(name) FROM t`).Scan(pq.Array(&names))
+
+Slices of bool, float64, int64, string and []byte are handled by the BoolArray,
+Float64Array, Int64Array, StringArray and ByteaArray types.  Anything else,
+including multidimensional arrays and slices of sql.Scanner implementations such
+as sql.NullString, goes through GenericArray.
+
+Custom types
+
+Values of types pq doesn't know, such as enums, domains and the types of
+extensions like citext or PostGIS, are returned as []byte.  RegisterType makes
+pq convert them with the functions of a TypeCodec instead:
+
+	pq.RegisterType("ltree", pq.TypeCodec{
+		DecodeText: func(src []byte) (interface{}, error) {
+			return strings.Split(string(src), "."), nil
+		},
+		EncodeText: func(x interface{}) ([]byte, error) {
+			path, ok := x.([]string)
+			if !ok {
+				return nil, fmt.Errorf("can't encode %T as ltree", x)
+			}
+			return []byte(strings.Join(path, ".")), nil
+		},
+	})
+
+Each connection looks up the OIDs of the registered type names in pg_type
+before it first runs a query or starts a transaction; types registered while it
+is in a transaction are looked up once the transaction ends.  RegisterTypeOID
+registers a TypeCodec for a type by its OID.  A TypeCodec with a DecodeBinary
+function receives the values of prepared statements in the binary format.
+Parameters are passed to the encoders of their types as they are, unless they
+implement driver.Valuer.
+
+Composite types
+
+Values of composite types and records are received as their text
+representation, such as (pen,1.5,"{blue,red}").  pq.Composite maps their
+attributes onto the fields of a struct, by position or by a `pq:"N"` tag:
+
+	type item struct {
+		Name  string
+		Price float64
+		Tags  []string
+	}
+	var it item
+	err := db.QueryRow("SELECT item FROM inventory").Scan(pq.Composite(&it))
+
+pq.Composite also converts a struct to a parameter of a composite type.  To
+receive the values of a composite type in the binary format, register
+pq.DecodeBinaryRecord as its binary decoder:
+
+	pq.RegisterType("inventory_item", pq.TypeCodec{DecodeBinary: pq.DecodeBinaryRecord})
+
+Ranges
+
+pq.Int64Range, pq.Float64Range and pq.TimeRange scan and convert ranges of
+integers, numerics, timestamps and dates, with the inclusivity of their bounds,
+unbounded sides and empty ranges described by their RangeFlags:
+
+	var r pq.TimeRange
+	err := db.QueryRow("SELECT during FROM reservation").Scan(&r)
+	if !r.UpperInf && r.Upper.Before(time.Now()) {
+		...
+	}
+
+The multiranges of PostgreSQL 14 and later are handled by
+pq.Int64Multirange, pq.Float64Multirange and pq.TimeMultirange, which are
+slices of ranges.
+
+Numerics
+
+Values of type numeric are received as their text representation.  To work
+with them without the loss of precision of a float64, scan them into a
+pq.Numeric, which holds them as a *big.Int and a scale, and can also hold NaN
+and infinities:
+
+	var total pq.Numeric
+	err := db.QueryRow("SELECT sum(amount) FROM invoice").Scan(&total)
+	r := total.Rat()
+
+pq.Numeric values, as well as *big.Int, *big.Rat and *big.Float values, can
+be passed as parameters.
+
+Intervals
+
+Values of type interval are received as their text representation, whose
+format depends on the IntervalStyle setting.  pq.Interval parses all of the
+formats into months, days and microseconds, which are kept apart because the
+length of months and days varies:
+
+	var iv pq.Interval
+	err := db.QueryRow("SELECT age(finished, started) FROM job").Scan(&iv)
+	if d, ok := iv.Duration(); ok {
+		...
+	}
+
+pq.Interval can also be passed as a parameter, and pq.IntervalFromDuration
+converts a time.Duration to an Interval.
+
+JSON
+
+Values of type json and jsonb are returned as []byte.  pq.JSON converts them
+to and from any Go value with the encoding/json package, and pq.JSONArray does
+the same for the elements of arrays of them:
+
+	var attrs map[string]interface{}
+	err := db.QueryRow("SELECT attrs FROM product WHERE id = $1", id).Scan(pq.JSON(&attrs))
+
+	_, err = db.Exec("UPDATE product SET attrs = $1 WHERE id = $2", pq.JSON(attrs), id)
+
+Documents are unmarshaled directly from the buffer they were received into,
+so large ones aren't copied first.
+
 Errors
 
 pq may return errors of type *pq.Error which can be interrogated for error details:
@@ -132,11 +331,17 @@ After all data has been processed you should call Exec() once with no arguments
 to flush all buffered data. Any call to Exec() might return an error which
 should be handled appropriately, but because of the internal buffering an error
 returned by Exec() might not be related to the data passed in the call that
-failed.
+failed.  The RowsAffected method of the result of that final Exec() reports the
+number of rows copied.
 
 CopyIn uses COPY FROM internally. It is not possible to COPY outside of an
 explicit transaction in pq.
 
+Statements created by pq.CopyInBinary (or pq.CopyInSchemaBinary) are used in the
+same way, but send the data in the binary COPY format, which saves formatting
+every value as text.  The types of the target columns are looked up when the
+statement is prepared; see CopyInBinary for the supported types.
+
 Usage example:
 
 	txn, err := db.Begin()
@@ -156,10 +361,12 @@ Usage example:
 		}
 	}
 
-	_, err = stmt.Exec()
+	res, err := stmt.Exec()
 	if err != nil {
 		log.Fatal(err)
 	}
+	copied, _ := res.RowsAffected()
+	log.Printf("copied %d users", copied)
 
 	err = stmt.Close()
 	if err != nil {
@@ -172,6 +379,64 @@ Usage example:
 	}
 
 
+Bulk exports
+
+COPY ... TO STDOUT statements can be executed with pq.CopyOut, which streams
+the data to an io.Writer, or pq.QueryCopyOut, which returns an iterator
+decoding each row of the text format into a []driver.Value.  Both operate
+directly on a driver connection, which can be obtained with sql.Conn.Raw:
+
+	err := conn.Raw(func(driverConn interface{}) error {
+		n, err := pq.CopyOut(driverConn.(driver.Conn), w, "COPY users TO STDOUT (FORMAT csv)")
+		log.Printf("exported %d rows", n)
+		return err
+	})
+
+
+Batches
+
+Queries queued in a pq.Batch are sent to the server together by pq.SendBatch,
+which saves a network round trip per query compared with running them one at a
+time.  SendBatch returns a result, rows or error for every query in the batch:
+
+	var b pq.Batch
+	for _, user := range users {
+		b.Queue("INSERT INTO users (name, age) VALUES ($1, $2)", user.Name, user.Age)
+	}
+	err := conn.Raw(func(driverConn interface{}) error {
+		results, err := pq.SendBatch(driverConn.(driver.Conn), &b)
+		...
+	})
+
+Once a query in a batch fails, the server skips the remaining ones, and their
+results carry pq.ErrBatchAborted.  The first time a query with arguments
+appears in a batch, the batch waits a round trip for the types of its
+parameters, so that its arguments are sent as they would be by Exec.
+
+
+Notices
+
+PostgreSQL sends notices (for example the output of RAISE NOTICE in a PL/pgSQL
+function, or a WARNING about deprecated syntax) alongside the results of a
+query.  By default pq discards them.  To receive them, set a notice handler on
+the connection with SetNoticeHandler, or on a Listener or ListenerConn with
+their SetNoticeHandler methods.  Each notice is passed to the handler as a
+*pq.Error.
+
+With database/sql, a handler set with SetNoticeHandler only applies to the one
+pooled connection it was set on.  To handle the notices of every connection of
+a *sql.DB, set the NoticeHandler of the Config of a Connector:
+
+	cfg, err := pq.ParseConfig("dbname=pqgotest")
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.NoticeHandler = func(notice *pq.Error) {
+		log.Printf("%s: %s", notice.Severity, notice.Message)
+	}
+	db := sql.OpenDB(pq.NewConnector(cfg))
+
+
 Notifications
 
 
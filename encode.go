@@ -46,6 +46,11 @@ func encode(parameterStatus *parameterStatus, x interface{}, pgtypOid oid.Oid) [
 }
 
 func decode(parameterStatus *parameterStatus, s []byte, typ oid.Oid, f format) interface{} {
+	if c := parameterStatus.types[typ]; c != nil {
+		if v, ok := c.decode(s, typ, f); ok {
+			return v
+		}
+	}
 	if f == formatBinary {
 		return binaryDecode(parameterStatus, s, typ)
 	} else {
@@ -54,27 +59,202 @@ func decode(parameterStatus *parameterStatus, s []byte, typ oid.Oid, f format) i
 }
 
 func binaryDecode(parameterStatus *parameterStatus, s []byte, typ oid.Oid) interface{} {
-	switch typ {
-	case oid.T_bytea:
+	d, ok := binaryDecoders[typ]
+	if !ok {
+		errorf("don't know how to decode binary parameter of type %d", uint32(typ))
+	}
+	return d.decode(parameterStatus, s)
+}
+
+// A binaryDecoder decodes values of a type received in the binary format into
+// the same values as textDecode does for the text format.
+type binaryDecoder struct {
+	decode func(parameterStatus *parameterStatus, s []byte) interface{}
+
+	// If set, the binary format is only used if usable returns true for the
+	// connection's parameter status.
+	usable func(parameterStatus *parameterStatus) bool
+}
+
+// binaryDecoders lists the types to use the binary format for when receiving
+// them through a prepared statement; see decideColumnFormats.
+var binaryDecoders = map[oid.Oid]binaryDecoder{
+	oid.T_bytea: {decode: func(ps *parameterStatus, s []byte) interface{} {
 		return s
-	case oid.T_int8:
+	}},
+	oid.T_int8: {decode: func(ps *parameterStatus, s []byte) interface{} {
 		return int64(binary.BigEndian.Uint64(s))
-	case oid.T_int4:
+	}},
+	oid.T_int4: {decode: func(ps *parameterStatus, s []byte) interface{} {
 		return int64(int32(binary.BigEndian.Uint32(s)))
-	case oid.T_int2:
+	}},
+	oid.T_int2: {decode: func(ps *parameterStatus, s []byte) interface{} {
 		return int64(int16(binary.BigEndian.Uint16(s)))
+	}},
+	oid.T_oid: {decode: func(ps *parameterStatus, s []byte) interface{} {
+		// textDecode leaves oids as they are
+		return strconv.AppendUint(nil, uint64(binary.BigEndian.Uint32(s)), 10)
+	}},
+	oid.T_bool: {decode: func(ps *parameterStatus, s []byte) interface{} {
+		return s[0] != 0
+	}},
+	oid.T_float4: {decode: func(ps *parameterStatus, s []byte) interface{} {
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(s)))
+	}},
+	oid.T_float8: {decode: func(ps *parameterStatus, s []byte) interface{} {
+		return math.Float64frombits(binary.BigEndian.Uint64(s))
+	}},
+	oid.T_date: {decode: func(ps *parameterStatus, s []byte) interface{} {
+		switch days := int32(binary.BigEndian.Uint32(s)); days {
+		case math.MinInt32:
+			return decodeInfinityTs("-infinity")
+		case math.MaxInt32:
+			return decodeInfinityTs("infinity")
+		default:
+			return time.Date(2000, time.January, 1+int(days), 0, 0, 0, 0, globalLocationCache.getLocation(0))
+		}
+	}},
+	oid.T_timestamp: {decode: func(ps *parameterStatus, s []byte) interface{} {
+		t, inf := binaryDecodeTimestamp(ps, s)
+		if inf != "" {
+			return decodeInfinityTs(inf)
+		}
+		return t.In(globalLocationCache.getLocation(0))
+	}},
+	oid.T_timestamptz: {
+		decode: func(ps *parameterStatus, s []byte) interface{} {
+			t, inf := binaryDecodeTimestamp(ps, s)
+			if inf != "" {
+				return decodeInfinityTs(inf)
+			}
+			if ps.currentLocation == nil {
+				// the session's TimeZone changed since the statement was
+				// prepared
+				return t.In(globalLocationCache.getLocation(0))
+			}
+			return t.In(ps.currentLocation)
+		},
+		// Without a location for the session's TimeZone, only the text format
+		// tells the offset of the time zone the value should be in.
+		usable: func(ps *parameterStatus) bool {
+			return ps.currentLocation != nil
+		},
+	},
+	oid.T_time: {decode: func(ps *parameterStatus, s []byte) interface{} {
+		us := binaryDecodeMicroseconds(ps, s)
+		return time.Date(0, time.January, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(us) * time.Microsecond)
+	}},
+	oid.T_interval: {
+		decode: func(ps *parameterStatus, s []byte) interface{} {
+			// textDecode leaves intervals as they are
+			iv := Interval{
+				Microseconds: binaryDecodeMicroseconds(ps, s[:8]),
+				Days:         int32(binary.BigEndian.Uint32(s[8:])),
+				Months:       int32(binary.BigEndian.Uint32(s[12:])),
+			}
+			return appendInterval(nil, iv, ps.intervalStyle)
+		},
+		// The text format depends on IntervalStyle.
+		usable: func(ps *parameterStatus) bool {
+			switch ps.intervalStyle {
+			case intervalStylePostgres, intervalStylePostgresVerbose, intervalStyleSQLStandard, intervalStyleISO8601:
+				return true
+			}
+			return false
+		},
+	},
+	oid.T_uuid: {decode: func(ps *parameterStatus, s []byte) interface{} {
+		// textDecode leaves UUIDs as they are
+		b := make([]byte, 36)
+		hex.Encode(b[0:8], s[0:4])
+		b[8] = '-'
+		hex.Encode(b[9:13], s[4:6])
+		b[13] = '-'
+		hex.Encode(b[14:18], s[6:8])
+		b[18] = '-'
+		hex.Encode(b[19:23], s[8:10])
+		b[23] = '-'
+		hex.Encode(b[24:], s[10:16])
+		return b
+	}},
+	oid.T_numeric: {decode: func(ps *parameterStatus, s []byte) interface{} {
+		// textDecode leaves numerics as they are
+		return binaryNumericText(s)
+	}},
+	oid.T_json: {decode: func(ps *parameterStatus, s []byte) interface{} {
+		// The binary format of json is the same as the text format.
+		return s
+	}},
+	oid.T_jsonb: {decode: func(ps *parameterStatus, s []byte) interface{} {
+		// The binary format of jsonb is a version number followed by the
+		// text format.
+		if len(s) == 0 || s[0] != jsonbVersion {
+			errorf("unsupported jsonb format")
+		}
+		return s[1:]
+	}},
+}
 
-	default:
-		errorf("don't know how to decode binary parameter of type %u", uint32(typ))
+// jsonbVersion is the version of the binary format of jsonb.
+const jsonbVersion = 1
+
+// binaryDecodeMicroseconds decodes the binary format of a timestamp or a time,
+// which is a count of microseconds if the server was built with
+// integer_datetimes, or else a count of seconds as a float8.
+func binaryDecodeMicroseconds(ps *parameterStatus, s []byte) int64 {
+	if ps.floatDatetimes {
+		secs := math.Float64frombits(binary.BigEndian.Uint64(s))
+		return int64(math.Floor(secs*1e6 + 0.5))
 	}
+	return int64(binary.BigEndian.Uint64(s))
+}
 
-	panic("not reached")
+// binaryDecodeTimestamp decodes the binary format of a timestamp, or returns
+// "infinity" or "-infinity" as inf for those special values.
+func binaryDecodeTimestamp(ps *parameterStatus, s []byte) (t time.Time, inf string) {
+	if ps.floatDatetimes {
+		secs := math.Float64frombits(binary.BigEndian.Uint64(s))
+		if math.IsInf(secs, 1) {
+			return t, "infinity"
+		} else if math.IsInf(secs, -1) {
+			return t, "-infinity"
+		}
+	} else {
+		switch int64(binary.BigEndian.Uint64(s)) {
+		case math.MaxInt64:
+			return t, "infinity"
+		case math.MinInt64:
+			return t, "-infinity"
+		}
+	}
+	// time.Duration only covers about 292 years, so add whole days
+	// separately.
+	us := binaryDecodeMicroseconds(ps, s)
+	days := us / (86400 * 1000000)
+	us -= days * 86400 * 1000000
+	return postgresEpoch.AddDate(0, 0, int(days)).Add(time.Duration(us) * time.Microsecond), ""
+}
+
+// decodeInfinityTs returns what parseTs returns for str, which is "infinity"
+// or "-infinity".
+func decodeInfinityTs(str string) interface{} {
+	return parseTs(nil, str)
+}
+
+// binaryNumericText converts a numeric value in the binary format into its
+// text format.
+func binaryNumericText(s []byte) []byte {
+	return decodeBinaryNumeric(s).append(nil)
 }
 
 func textDecode(parameterStatus *parameterStatus, s []byte, typ oid.Oid) interface{} {
 	switch typ {
 	case oid.T_bytea:
-		return parseBytea(s)
+		b, err := parseBytea(s)
+		if err != nil {
+			errorf("%s", err)
+		}
+		return b
 	case oid.T_timestamptz:
 		return parseTs(parameterStatus.currentLocation, string(s))
 	case oid.T_timestamp, oid.T_date:
@@ -170,6 +350,281 @@ func appendEscapedText(buf []byte, text string) []byte {
 	return result
 }
 
+// postgresEpoch is the zero point of the binary formats of the date and
+// timestamp types.
+var postgresEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// binaryParameterTypes lists the types of the parameters of prepared
+// statements which are sent in the binary format, unless the
+// disable_binary_parameters setting is on.  appendBinaryEncoded must support
+// all of them.
+var binaryParameterTypes = map[oid.Oid]bool{
+	oid.T_bytea:       true,
+	oid.T_int2:        true,
+	oid.T_int4:        true,
+	oid.T_int8:        true,
+	oid.T_float4:      true,
+	oid.T_float8:      true,
+	oid.T_bool:        true,
+	oid.T_timestamptz: true,
+	oid.T_uuid:        true,
+}
+
+// encodeParameter encodes the parameter x of a prepared statement, whose type
+// is typ, in the binary format if that's possible, or else in the text format.
+func encodeParameter(parameterStatus *parameterStatus, x interface{}, typ oid.Oid, allowBinary bool) ([]byte, format) {
+	if c := parameterStatus.types[typ]; c != nil {
+		if b, f, ok := c.encode(x, typ, allowBinary); ok {
+			return b, f
+		}
+	}
+	if allowBinary && binaryParameterTypes[typ] {
+		// If x doesn't fit the type, or appendBinaryEncoded doesn't
+		// support the type on this server, the text format lets the
+		// server report the problem.
+		if b, err := appendBinaryEncoded(parameterStatus, nil, x, typ); err == nil {
+			return b, formatBinary
+		}
+	}
+	return encode(parameterStatus, x, typ), formatText
+}
+
+// binaryEncodableTypes lists the types appendBinaryEncoded knows the binary
+// format of.
+var binaryEncodableTypes = map[oid.Oid]bool{
+	oid.T_int2:        true,
+	oid.T_int4:        true,
+	oid.T_int8:        true,
+	oid.T_oid:         true,
+	oid.T_float4:      true,
+	oid.T_float8:      true,
+	oid.T_bool:        true,
+	oid.T_bytea:       true,
+	oid.T_text:        true,
+	oid.T_varchar:     true,
+	oid.T_bpchar:      true,
+	oid.T_name:        true,
+	oid.T_unknown:     true,
+	oid.T_json:        true,
+	oid.T_xml:         true,
+	oid.T_jsonb:       true,
+	oid.T_timestamptz: true,
+	oid.T_timestamp:   true,
+	oid.T_date:        true,
+	oid.T_uuid:        true,
+}
+
+// checkBinaryEncodable returns an error if appendBinaryEncoded can't encode
+// any value of the type typ for the server described by parameterStatus.  The
+// binary format of timestamps is a float8 on servers which don't use integer
+// datetimes, which appendBinaryEncoded doesn't support.
+func checkBinaryEncodable(parameterStatus *parameterStatus, typ oid.Oid) error {
+	if !binaryEncodableTypes[typ] {
+		return fmt.Errorf("pq: binary format of the type with OID %d is not supported", typ)
+	}
+	if parameterStatus.floatDatetimes && (typ == oid.T_timestamptz || typ == oid.T_timestamp) {
+		return fmt.Errorf("pq: binary format of the type with OID %d is not supported without integer datetimes", typ)
+	}
+	return nil
+}
+
+// appendBinaryEncoded encodes x in the binary format of the type typ and
+// appends it to buf.  An error is returned if x can't be represented as a
+// value of type typ, or if pq doesn't know the binary format of typ.  x must
+// not be nil, since NULL is not encoded by the value itself.
+func appendBinaryEncoded(parameterStatus *parameterStatus, buf []byte, x interface{}, typ oid.Oid) ([]byte, error) {
+	if err := checkBinaryEncodable(parameterStatus, typ); err != nil {
+		return buf, err
+	}
+	switch typ {
+	case oid.T_int2, oid.T_int4, oid.T_int8, oid.T_oid:
+		i, err := binaryInt(x)
+		if err != nil {
+			return buf, err
+		}
+		switch typ {
+		case oid.T_int2:
+			if i < math.MinInt16 || i > math.MaxInt16 {
+				return buf, fmt.Errorf("pq: value %d out of range for smallint", i)
+			}
+			return appendUint16(buf, uint16(i)), nil
+		case oid.T_int4:
+			if i < math.MinInt32 || i > math.MaxInt32 {
+				return buf, fmt.Errorf("pq: value %d out of range for integer", i)
+			}
+			return appendUint32(buf, uint32(i)), nil
+		case oid.T_oid:
+			if i < 0 || i > math.MaxUint32 {
+				return buf, fmt.Errorf("pq: value %d out of range for oid", i)
+			}
+			return appendUint32(buf, uint32(i)), nil
+		}
+		return appendUint64(buf, uint64(i)), nil
+	case oid.T_float4, oid.T_float8:
+		var f float64
+		switch v := x.(type) {
+		case float64:
+			f = v
+		case int64:
+			f = float64(v)
+		default:
+			return buf, binaryEncodeError(x, typ)
+		}
+		if typ == oid.T_float4 {
+			if math.IsInf(float64(float32(f)), 0) && !math.IsInf(f, 0) {
+				return buf, fmt.Errorf("pq: value %g out of range for real", f)
+			}
+			return appendUint32(buf, math.Float32bits(float32(f))), nil
+		}
+		return appendUint64(buf, math.Float64bits(f)), nil
+	case oid.T_bool:
+		v, ok := x.(bool)
+		if !ok {
+			return buf, binaryEncodeError(x, typ)
+		}
+		if v {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case oid.T_bytea:
+		switch v := x.(type) {
+		case []byte:
+			return append(buf, v...), nil
+		case string:
+			return append(buf, v...), nil
+		}
+		return buf, binaryEncodeError(x, typ)
+	case oid.T_text, oid.T_varchar, oid.T_bpchar, oid.T_name, oid.T_unknown, oid.T_json, oid.T_xml:
+		// The binary format of the character types is the same as the
+		// text format.
+		switch v := x.(type) {
+		case []byte:
+			return append(buf, v...), nil
+		case string:
+			return append(buf, v...), nil
+		}
+		return append(buf, encode(parameterStatus, x, typ)...), nil
+	case oid.T_jsonb:
+		buf = append(buf, jsonbVersion)
+		switch v := x.(type) {
+		case []byte:
+			return append(buf, v...), nil
+		case string:
+			return append(buf, v...), nil
+		}
+		return append(buf, encode(parameterStatus, x, typ)...), nil
+	case oid.T_timestamptz, oid.T_timestamp, oid.T_date:
+		t, ok := x.(time.Time)
+		if !ok {
+			return buf, binaryEncodeError(x, typ)
+		}
+		if infinityTsEnabled {
+			if !t.After(infinityTsNegative) {
+				if typ == oid.T_date {
+					return appendUint32(buf, math.MaxInt32+1), nil
+				}
+				return appendUint64(buf, math.MaxInt64+1), nil
+			}
+			if !t.Before(infinityTsPositive) {
+				if typ == oid.T_date {
+					return appendUint32(buf, math.MaxInt32), nil
+				}
+				return appendUint64(buf, math.MaxInt64), nil
+			}
+		}
+		if typ != oid.T_timestamptz {
+			// Types without a time zone store the wall clock reading.
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		}
+		secs := t.Unix() - postgresEpoch.Unix()
+		if typ == oid.T_date {
+			days := secs / 86400
+			if secs%86400 < 0 {
+				days--
+			}
+			return appendUint32(buf, uint32(days)), nil
+		}
+		// Round to the microseconds the server stores, as it does with
+		// the text format, carrying into the seconds.
+		usecs := secs*1000000 + int64((t.Nanosecond()+500)/1000)
+		return appendUint64(buf, uint64(usecs)), nil
+	case oid.T_uuid:
+		var u []byte
+		switch v := x.(type) {
+		case []byte:
+			if len(v) == 16 {
+				u = v
+			} else {
+				u = parseUUID(v)
+			}
+		case string:
+			u = parseUUID([]byte(v))
+		}
+		if u == nil {
+			return buf, binaryEncodeError(x, typ)
+		}
+		return append(buf, u...), nil
+	}
+	return buf, fmt.Errorf("pq: binary format of the type with OID %d is not supported", typ)
+}
+
+func binaryEncodeError(x interface{}, typ oid.Oid) error {
+	return fmt.Errorf("pq: cannot encode %T in the binary format of the type with OID %d", x, typ)
+}
+
+func binaryInt(x interface{}) (int64, error) {
+	switch v := x.(type) {
+	case int64:
+		return v, nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("pq: cannot encode %T as an integer", x)
+}
+
+// parseUUID parses the text representation of a UUID, and returns nil if it
+// is not valid.  Like PostgreSQL, it accepts hyphens after any group of four
+// digits, and optional surrounding braces.
+func parseUUID(s []byte) []byte {
+	if len(s) > 1 && s[0] == '{' && s[len(s)-1] == '}' {
+		s = s[1 : len(s)-1]
+	}
+	u := make([]byte, 0, 16)
+	for len(s) > 0 {
+		if s[0] == '-' && len(u) > 0 && len(u)%2 == 0 {
+			s = s[1:]
+		}
+		if len(s) < 2 || len(u) == 16 {
+			return nil
+		}
+		hi, ok1 := unhex(s[0])
+		lo, ok2 := unhex(s[1])
+		if !ok1 || !ok2 {
+			return nil
+		}
+		u = append(u, hi<<4|lo)
+		s = s[2:]
+	}
+	if len(u) != 16 {
+		return nil
+	}
+	return u
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(v>>32)), uint32(v))
+}
+
 func mustParse(f string, typ oid.Oid, s []byte) time.Time {
 	str := string(s)
 
@@ -435,14 +890,14 @@ func formatTs(t time.Time) (b []byte) {
 
 // Parse a bytea value received from the server.  Both "hex" and the legacy
 // "escape" format are supported.
-func parseBytea(s []byte) (result []byte) {
+func parseBytea(s []byte) (result []byte, err error) {
 	if len(s) >= 2 && bytes.Equal(s[:2], []byte("\\x")) {
 		// bytea_output = hex
 		s = s[2:] // trim off leading "\\x"
 		result = make([]byte, hex.DecodedLen(len(s)))
 		_, err := hex.Decode(result, s)
 		if err != nil {
-			errorf("%s", err)
+			return nil, err
 		}
 	} else {
 		// bytea_output = escape
@@ -457,11 +912,11 @@ func parseBytea(s []byte) (result []byte) {
 
 				// '\\' followed by an octal number
 				if len(s) < 4 {
-					errorf("invalid bytea sequence %v", s)
+					return nil, fmt.Errorf("invalid bytea sequence %v", s)
 				}
 				r, err := strconv.ParseInt(string(s[1:4]), 8, 9)
 				if err != nil {
-					errorf("could not parse bytea value: %s", err.Error())
+					return nil, fmt.Errorf("could not parse bytea value: %s", err.Error())
 				}
 				result = append(result, byte(r))
 				s = s[4:]
@@ -479,7 +934,7 @@ func parseBytea(s []byte) (result []byte) {
 		}
 	}
 
-	return result
+	return result, nil
 }
 
 func encodeBytea(serverVersion int, v []byte) (result []byte) {
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"database/sql"
 	"fmt"
+	"math"
+	"reflect"
+	"strconv"
 	"testing"
 	"time"
 
@@ -437,6 +440,35 @@ func TestTextToBytea(t *testing.T) {
 	}
 }
 
+func TestBinaryParameterRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	large := make([]byte, 1<<20)
+	for i := range large {
+		large[i] = byte(i)
+	}
+	ts := time.Date(2001, 2, 3, 4, 5, 6, 7000, time.FixedZone("", 3600))
+	var (
+		b   []byte
+		i   int64
+		f   float64
+		ok  bool
+		got time.Time
+	)
+	err := db.QueryRow("SELECT $1::bytea, $2::int8, $3::float8, $4::bool, $5::timestamptz",
+		large, int64(-1)<<40, 0.1, true, ts).Scan(&b, &i, &f, &ok, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, large) {
+		t.Error("bytea value differs")
+	}
+	if i != int64(-1)<<40 || f != 0.1 || !ok || !got.Equal(ts) {
+		t.Errorf("got %v, %v, %v, %v", i, f, ok, got)
+	}
+}
+
 func TestByteaOutputFormatEncoding(t *testing.T) {
 	input := []byte("\\x\x00\x01\x02\xFF\xFEabcdefg0123")
 	want := []byte("\\x5c78000102fffe6162636465666730313233")
@@ -587,3 +619,304 @@ func BenchmarkAppendEscapedTextNoEscape(b *testing.B) {
 		appendEscapedText(nil, longString)
 	}
 }
+
+func TestAppendBinaryEncoded(t *testing.T) {
+	ps := &parameterStatus{serverVersion: 90000}
+	tests := []struct {
+		x    interface{}
+		typ  oid.Oid
+		want []byte
+	}{
+		{int64(-2), oid.T_int2, []byte{0xff, 0xfe}},
+		{int64(1), oid.T_int4, []byte{0, 0, 0, 1}},
+		{"-1", oid.T_int4, []byte{0xff, 0xff, 0xff, 0xff}},
+		{int64(1) << 40, oid.T_int8, []byte{0, 0, 1, 0, 0, 0, 0, 0}},
+		{int64(4294967295), oid.T_oid, []byte{0xff, 0xff, 0xff, 0xff}},
+		{1.5, oid.T_float4, []byte{0x3f, 0xc0, 0, 0}},
+		{int64(2), oid.T_float8, []byte{0x40, 0, 0, 0, 0, 0, 0, 0}},
+		{true, oid.T_bool, []byte{1}},
+		{false, oid.T_bool, []byte{0}},
+		{[]byte{0, '\\'}, oid.T_bytea, []byte{0, '\\'}},
+		{"a\tb", oid.T_text, []byte("a\tb")},
+		{int64(12), oid.T_varchar, []byte("12")},
+		{[]byte(`{"a":1}`), oid.T_json, []byte(`{"a":1}`)},
+		{`{"a":1}`, oid.T_jsonb, []byte("\x01{\"a\":1}")},
+		{time.Date(2000, 1, 1, 0, 0, 1, 500000000, time.UTC), oid.T_timestamptz, []byte{0, 0, 0, 0, 0, 0x16, 0xe3, 0x60}},
+		{time.Date(2000, 1, 1, 1, 0, 0, 0, time.FixedZone("", 3600)), oid.T_timestamptz, []byte{0, 0, 0, 0, 0, 0, 0, 0}},
+		// rounded to the nearest microsecond
+		{time.Date(2000, 1, 1, 0, 0, 0, 999999999, time.UTC), oid.T_timestamptz, []byte{0, 0, 0, 0, 0, 0x0f, 0x42, 0x40}},
+		{time.Date(1999, 12, 31, 23, 59, 59, 999999500, time.UTC), oid.T_timestamptz, []byte{0, 0, 0, 0, 0, 0, 0, 0}},
+		{time.Date(2000, 1, 1, 0, 0, 0, 1499, time.UTC), oid.T_timestamp, []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+		{time.Date(2000, 1, 1, 1, 0, 0, 0, time.FixedZone("", 3600)), oid.T_timestamp, []byte{0, 0, 0, 0, 0xd6, 0x93, 0xa4, 0}},
+		{time.Date(1999, 12, 31, 23, 0, 0, 0, time.UTC), oid.T_date, []byte{0xff, 0xff, 0xff, 0xff}},
+		{time.Date(2000, 1, 3, 0, 0, 0, 0, time.FixedZone("", -3600)), oid.T_date, []byte{0, 0, 0, 2}},
+		{"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", oid.T_uuid, []byte{
+			0xa0, 0xee, 0xbc, 0x99, 0x9c, 0x0b, 0x4e, 0xf8, 0xbb, 0x6d, 0x6b, 0xb9, 0xbd, 0x38, 0x0a, 0x11,
+		}},
+		{"{A0EEBC999C0B4EF8BB6D6BB9BD380A11}", oid.T_uuid, []byte{
+			0xa0, 0xee, 0xbc, 0x99, 0x9c, 0x0b, 0x4e, 0xf8, 0xbb, 0x6d, 0x6b, 0xb9, 0xbd, 0x38, 0x0a, 0x11,
+		}},
+		{[]byte("0123456789abcdef"), oid.T_uuid, []byte("0123456789abcdef")},
+	}
+	for _, tt := range tests {
+		got, err := appendBinaryEncoded(ps, []byte("x"), tt.x, tt.typ)
+		if err != nil {
+			t.Errorf("%v as %d: %v", tt.x, tt.typ, err)
+			continue
+		}
+		if !bytes.Equal(got, append([]byte("x"), tt.want...)) {
+			t.Errorf("%v as %d: got %x, want %x", tt.x, tt.typ, got[1:], tt.want)
+		}
+	}
+}
+
+func TestAppendBinaryEncodedError(t *testing.T) {
+	ps := &parameterStatus{serverVersion: 90000}
+	tests := []struct {
+		x   interface{}
+		typ oid.Oid
+	}{
+		{int64(32768), oid.T_int2},
+		{int64(-2147483649), oid.T_int4},
+		{int64(-1), oid.T_oid},
+		{"x", oid.T_int8},
+		{true, oid.T_int8},
+		{"1.5", oid.T_float8},
+		{"t", oid.T_bool},
+		{int64(1), oid.T_bytea},
+		{"2000-01-01", oid.T_timestamptz},
+		{"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a1", oid.T_uuid},
+		{"a0eebc99--9c0b-4ef8-bb6d-6bb9bd380a11", oid.T_uuid},
+		{"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11-", oid.T_uuid},
+		{"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a1100", oid.T_uuid},
+		{int64(1), oid.T_numeric},
+	}
+	for _, tt := range tests {
+		if got, err := appendBinaryEncoded(ps, nil, tt.x, tt.typ); err == nil {
+			t.Errorf("%v as %d: expected an error, got %x", tt.x, tt.typ, got)
+		}
+	}
+}
+
+func TestAppendBinaryEncodedInfinityTs(t *testing.T) {
+	defer disableInfinityTs()
+	EnableInfinityTs(time.Date(-2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	ps := &parameterStatus{}
+	got, _ := appendBinaryEncoded(ps, nil, time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), oid.T_timestamptz)
+	if want := []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}; !bytes.Equal(got, want) {
+		t.Errorf("infinity: got %x, want %x", got, want)
+	}
+	got, _ = appendBinaryEncoded(ps, nil, time.Date(-3000, 1, 1, 0, 0, 0, 0, time.UTC), oid.T_date)
+	if want := []byte{0x80, 0, 0, 0}; !bytes.Equal(got, want) {
+		t.Errorf("-infinity: got %x, want %x", got, want)
+	}
+}
+
+// numericBytes returns the binary format of a numeric value.
+func numericBytes(weight, sign, dscale int, digits ...int) []byte {
+	b := appendUint16(nil, uint16(len(digits)))
+	b = appendUint16(b, uint16(weight))
+	b = appendUint16(b, uint16(sign))
+	b = appendUint16(b, uint16(dscale))
+	for _, d := range digits {
+		b = appendUint16(b, uint16(d))
+	}
+	return b
+}
+
+// mustBinaryEncode returns the binary format of x as a value of type typ.
+func mustBinaryEncode(t *testing.T, x interface{}, typ oid.Oid) []byte {
+	b, err := appendBinaryEncoded(&parameterStatus{}, nil, x, typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// sameDecoded reports whether textDecode and binaryDecode decoded the same
+// value.
+func sameDecoded(a, b interface{}) bool {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt) && at.Location() == bt.Location() && at.String() == bt.String()
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func TestBinaryDecodeEquivalence(t *testing.T) {
+	ps := &parameterStatus{currentLocation: time.FixedZone("EST", -5*3600)}
+	tests := []struct {
+		typ  oid.Oid
+		text string
+		bin  []byte
+	}{
+		{oid.T_bool, "t", []byte{1}},
+		{oid.T_bool, "f", []byte{0}},
+		{oid.T_int2, "-42", mustBinaryEncode(t, int64(-42), oid.T_int2)},
+		{oid.T_int4, "2147483647", mustBinaryEncode(t, int64(2147483647), oid.T_int4)},
+		{oid.T_int8, "-9223372036854775808", mustBinaryEncode(t, int64(-9223372036854775808), oid.T_int8)},
+		{oid.T_oid, "4294967295", mustBinaryEncode(t, int64(4294967295), oid.T_oid)},
+		{oid.T_float4, "-0.1", mustBinaryEncode(t, -0.1, oid.T_float4)},
+		{oid.T_float4, "1.5", mustBinaryEncode(t, 1.5, oid.T_float4)},
+		{oid.T_float8, "3.141592653589793", mustBinaryEncode(t, 3.141592653589793, oid.T_float8)},
+		{oid.T_float8, "-1e+300", mustBinaryEncode(t, -1e300, oid.T_float8)},
+		{oid.T_bytea, `\x00ff`, []byte{0, 0xff}},
+		{oid.T_date, "2001-02-03", mustBinaryEncode(t, time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC), oid.T_date)},
+		{oid.T_date, "1999-12-31", []byte{0xff, 0xff, 0xff, 0xff}},
+		{oid.T_date, "infinity", []byte{0x7f, 0xff, 0xff, 0xff}},
+		{oid.T_date, "-infinity", []byte{0x80, 0, 0, 0}},
+		{oid.T_timestamp, "2001-02-03 04:05:06.789012", mustBinaryEncode(t, time.Date(2001, 2, 3, 4, 5, 6, 789012000, time.UTC), oid.T_timestamp)},
+		{oid.T_timestamp, "1900-01-01 00:00:00", mustBinaryEncode(t, time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), oid.T_timestamp)},
+		{oid.T_timestamp, "3000-06-01 12:00:00.5", mustBinaryEncode(t, time.Date(3000, 6, 1, 12, 0, 0, 500000000, time.UTC), oid.T_timestamp)},
+		{oid.T_timestamp, "0100-01-01 23:59:59.999999", mustBinaryEncode(t, time.Date(100, 1, 1, 23, 59, 59, 999999000, time.UTC), oid.T_timestamp)},
+		{oid.T_timestamp, "infinity", []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{oid.T_timestamptz, "2001-02-03 04:05:06.5-05", mustBinaryEncode(t, time.Date(2001, 2, 3, 9, 5, 6, 500000000, time.UTC), oid.T_timestamptz)},
+		{oid.T_timestamptz, "-infinity", []byte{0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{oid.T_time, "04:05:06.789", appendUint64(nil, uint64((4*3600+5*60+6)*1000000+789000))},
+		{oid.T_time, "00:00:00", appendUint64(nil, 0)},
+		{oid.T_uuid, "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", mustBinaryEncode(t, "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", oid.T_uuid)},
+		{oid.T_numeric, "0", numericBytes(0, 0, 0)},
+		{oid.T_numeric, "123.45", numericBytes(0, 0, 2, 123, 4500)},
+		{oid.T_numeric, "-0.001", numericBytes(-1, 0x4000, 3, 10)},
+		{oid.T_numeric, "10000", numericBytes(1, 0, 0, 1)},
+		{oid.T_numeric, "1.0000", numericBytes(0, 0, 4, 1)},
+		{oid.T_numeric, "12345678.9", numericBytes(1, 0, 1, 1234, 5678, 9000)},
+		{oid.T_numeric, "0.00000001", numericBytes(-2, 0, 8, 1)},
+		{oid.T_numeric, "NaN", numericBytes(0, 0xc000, 0)},
+		{oid.T_numeric, "-Infinity", numericBytes(0, 0xf000, 0)},
+		{oid.T_json, `{"a": [1, 2]}`, []byte(`{"a": [1, 2]}`)},
+		{oid.T_jsonb, `{"a": [1, 2]}`, []byte("\x01{\"a\": [1, 2]}")},
+		{oid.T_interval, "1 year -2 days +03:04:05.6", append(appendUint64(nil, (3*3600+4*60+5)*1000000+600000), 0xff, 0xff, 0xff, 0xfe, 0, 0, 0, 12)},
+	}
+	for _, tt := range tests {
+		text := textDecode(ps, []byte(tt.text), tt.typ)
+		bin := binaryDecode(ps, tt.bin, tt.typ)
+		if !sameDecoded(text, bin) {
+			t.Errorf("%s as %d: decoded %#v from text, but %#v from binary", tt.text, tt.typ, text, bin)
+		}
+	}
+}
+
+func TestBinaryDecodeFloatDatetimes(t *testing.T) {
+	ps := &parameterStatus{floatDatetimes: true}
+	secs := func(f float64) []byte {
+		return appendUint64(nil, math.Float64bits(f))
+	}
+	tests := []struct {
+		typ  oid.Oid
+		text string
+		bin  []byte
+	}{
+		{oid.T_timestamp, "2000-01-01 00:00:01.5", secs(1.5)},
+		{oid.T_timestamp, "1999-12-31 23:59:59.25", secs(-0.75)},
+		{oid.T_timestamp, "infinity", secs(math.Inf(1))},
+		{oid.T_time, "12:00:00.125", secs(43200.125)},
+	}
+	for _, tt := range tests {
+		text := textDecode(ps, []byte(tt.text), tt.typ)
+		bin := binaryDecode(ps, tt.bin, tt.typ)
+		if !sameDecoded(text, bin) {
+			t.Errorf("%s as %d: decoded %#v from text, but %#v from binary", tt.text, tt.typ, text, bin)
+		}
+	}
+}
+
+func TestDecideColumnFormats(t *testing.T) {
+	ps := &parameterStatus{}
+	typs := []oid.Oid{oid.T_int4, oid.T_text, oid.T_timestamptz, oid.T_numeric}
+	fmts, _ := decideColumnFormats(ps, typs, false)
+	if want := []format{formatBinary, formatText, formatText, formatBinary}; !reflect.DeepEqual(fmts, want) {
+		t.Errorf("got formats %v, want %v", fmts, want)
+	}
+	// timestamptz is only received in binary with a location for the time
+	// zone of the session
+	ps.currentLocation = time.UTC
+	fmts, data := decideColumnFormats(ps, typs[2:], false)
+	if want := []format{formatBinary, formatBinary}; !reflect.DeepEqual(fmts, want) || !bytes.Equal(data, rowFmtDataAllBinary) {
+		t.Errorf("got formats %v (%x), want %v", fmts, data, want)
+	}
+	fmts, data = decideColumnFormats(ps, typs, true)
+	if want := make([]format, len(typs)); !reflect.DeepEqual(fmts, want) || !bytes.Equal(data, rowFmtDataAllText) {
+		t.Errorf("got formats %v (%x), want %v", fmts, data, want)
+	}
+}
+
+func TestBinaryDecodeServerEquivalence(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	exprs := []string{
+		"true",
+		"1.5::float4",
+		"'-1e300'::float8",
+		"'2001-02-03'::date",
+		"'infinity'::date",
+		"'2001-02-03 04:05:06.789012'::timestamp",
+		"'0044-03-15 12:00 BC'::timestamp",
+		"'2001-02-03 04:05:06.5+02'::timestamptz",
+		"'04:05:06.789'::time",
+		"'a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11'::uuid",
+		"'pg_type'::regclass::oid",
+		"'-12345678.000912'::numeric",
+		"'NaN'::numeric",
+		"0.00000001::numeric",
+		"'1 year -2 days 03:04:05.6'::interval",
+		"'-1 mon 1 day -00:00:00.001'::interval",
+		`'{"b": 2, "a": [1, "x"]}'::json`,
+		`'{"b": 2, "a": [1, "x"]}'::jsonb`,
+	}
+	for _, expr := range exprs {
+		// Queries without arguments use the simple query protocol, which
+		// returns text; with arguments, the binary format is used.
+		var text, bin interface{}
+		if err := db.QueryRow("SELECT " + expr).Scan(&text); err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		if err := db.QueryRow("SELECT "+expr+" WHERE $1", true).Scan(&bin); err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		if !sameDecoded(text, bin) {
+			t.Errorf("%s: decoded %#v from text, but %#v from binary", expr, text, bin)
+		}
+	}
+}
+
+func TestEncodeParameter(t *testing.T) {
+	ps := &parameterStatus{serverVersion: 90000}
+	tests := []struct {
+		x      interface{}
+		typ    oid.Oid
+		want   []byte
+		format format
+	}{
+		{[]byte{0, '\\'}, oid.T_bytea, []byte{0, '\\'}, formatBinary},
+		{int64(1), oid.T_int4, []byte{0, 0, 0, 1}, formatBinary},
+		{"12", oid.T_int2, []byte{0, 12}, formatBinary},
+		{true, oid.T_bool, []byte{1}, formatBinary},
+		{1.5, oid.T_float4, []byte{0x3f, 0xc0, 0, 0}, formatBinary},
+		{time.Date(2000, 1, 1, 0, 0, 1, 500000000, time.UTC), oid.T_timestamptz, []byte{0, 0, 0, 0, 0, 0x16, 0xe3, 0x60}, formatBinary},
+		// types which are sent as text
+		{"x", oid.T_text, []byte("x"), formatText},
+		{time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), oid.T_timestamp, []byte("2000-01-01T00:00:00Z"), formatText},
+		{int64(1), oid.T_numeric, []byte("1"), formatText},
+		// values which don't fit their type are left to the server
+		{"one", oid.T_int4, []byte("one"), formatText},
+		{int64(1) << 40, oid.T_int4, []byte("1099511627776"), formatText},
+		{1e300, oid.T_float4, []byte(strconv.FormatFloat(1e300, 'f', -1, 64)), formatText},
+	}
+	for _, tt := range tests {
+		got, f := encodeParameter(ps, tt.x, tt.typ, true)
+		if !bytes.Equal(got, tt.want) || f != tt.format {
+			t.Errorf("%v as %d: got %q in format %d, want %q in format %d", tt.x, tt.typ, got, f, tt.want, tt.format)
+		}
+	}
+
+	if got, f := encodeParameter(ps, int64(1), oid.T_int4, false); string(got) != "1" || f != formatText {
+		t.Errorf("binary disabled: got %q in format %d", got, f)
+	}
+	ps.floatDatetimes = true
+	if _, f := encodeParameter(ps, time.Now(), oid.T_timestamptz, true); f != formatText {
+		t.Errorf("float datetimes: got format %d", f)
+	}
+}
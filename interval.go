@@ -0,0 +1,568 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Interval represents a value of type interval.  Its months, days and
+// microseconds are kept apart, as PostgreSQL does, because the length of a
+// month or a day in microseconds depends on the time it's added to.
+type Interval struct {
+	Months       int32
+	Days         int32
+	Microseconds int64
+}
+
+// The values of IntervalStyle, the setting which determines the text format
+// of intervals.
+const (
+	intervalStylePostgres        = "postgres"
+	intervalStylePostgresVerbose = "postgres_verbose"
+	intervalStyleSQLStandard     = "sql_standard"
+	intervalStyleISO8601         = "iso_8601"
+)
+
+const (
+	usecsPerSec  = 1000000
+	usecsPerMin  = 60 * usecsPerSec
+	usecsPerHour = 60 * usecsPerMin
+)
+
+// IntervalFromDuration returns the Interval of the duration d, truncated to
+// microseconds.
+func IntervalFromDuration(d time.Duration) Interval {
+	return Interval{Microseconds: int64(d / time.Microsecond)}
+}
+
+// Duration returns iv as a time.Duration, if it has no months or days, whose
+// length varies, and fits in a time.Duration.
+func (iv Interval) Duration() (d time.Duration, ok bool) {
+	if iv.Months != 0 || iv.Days != 0 ||
+		iv.Microseconds > math.MaxInt64/int64(time.Microsecond) || iv.Microseconds < math.MinInt64/int64(time.Microsecond) {
+		return 0, false
+	}
+	return time.Duration(iv.Microseconds) * time.Microsecond, true
+}
+
+// String returns iv in the format of the default IntervalStyle, postgres.
+func (iv Interval) String() string {
+	return string(appendInterval(nil, iv, intervalStylePostgres))
+}
+
+// Scan implements the sql.Scanner interface.  It accepts intervals in any of
+// the formats of the IntervalStyle setting.
+func (iv *Interval) Scan(src interface{}) (err error) {
+	switch src := src.(type) {
+	case []byte:
+		*iv, err = parseInterval(string(src))
+		return err
+	case string:
+		*iv, err = parseInterval(src)
+		return err
+	case nil:
+		return fmt.Errorf("pq: cannot convert NULL to Interval")
+	}
+	return fmt.Errorf("pq: cannot convert %T to Interval", src)
+}
+
+// Value implements the driver.Valuer interface.  Intervals are sent in the ISO
+// 8601 format, whose meaning doesn't depend on IntervalStyle.
+func (iv Interval) Value() (driver.Value, error) {
+	return string(appendInterval(nil, iv, intervalStyleISO8601)), nil
+}
+
+// intervalFields splits iv into the fields PostgreSQL formats it with.
+func intervalFields(iv Interval) (year, mon, day int, hour, min, sec, usec int64) {
+	year, mon = int(iv.Months/12), int(iv.Months%12)
+	t := iv.Microseconds
+	hour, t = t/usecsPerHour, t%usecsPerHour
+	min, t = t/usecsPerMin, t%usecsPerMin
+	sec, usec = t/usecsPerSec, t%usecsPerSec
+	return year, mon, int(iv.Days), hour, min, sec, usec
+}
+
+// appendInterval appends iv to b in the text format of the IntervalStyle
+// style, as the server would output it.
+func appendInterval(b []byte, iv Interval, style string) []byte {
+	year, mon, day, hour, min, sec, usec := intervalFields(iv)
+	isZero, isBefore := true, false
+	switch style {
+	case intervalStyleSQLStandard:
+		hasNegative := iv.Months < 0 || iv.Days < 0 || iv.Microseconds < 0
+		hasPositive := iv.Months > 0 || iv.Days > 0 || iv.Microseconds > 0
+		hasYearMonth := iv.Months != 0
+		hasDayTime := iv.Days != 0 || iv.Microseconds != 0
+		standard := !(hasNegative && hasPositive) && !(hasYearMonth && hasDayTime)
+		switch {
+		case !hasNegative && !hasPositive:
+			return append(b, '0')
+		case !standard:
+			// each field has a sign, as they differ
+			b = append(b, intervalSign(iv.Months < 0))
+			b = strconv.AppendInt(b, int64(absInt(year)), 10)
+			b = append(b, '-')
+			b = strconv.AppendInt(b, int64(absInt(mon)), 10)
+			b = append(b, ' ', intervalSign(iv.Days < 0))
+			b = strconv.AppendInt(b, int64(absInt(day)), 10)
+			b = append(b, ' ', intervalSign(iv.Microseconds < 0))
+			return appendIntervalClock(b, hour, min, sec, usec, false)
+		}
+		if hasNegative {
+			b = append(b, '-')
+			year, mon, day = -year, -mon, -day
+		}
+		if hasYearMonth {
+			b = strconv.AppendInt(b, int64(year), 10)
+			b = append(b, '-')
+			return strconv.AppendInt(b, int64(mon), 10)
+		}
+		if day != 0 {
+			b = strconv.AppendInt(b, int64(day), 10)
+			b = append(b, ' ')
+		}
+		return appendIntervalClock(b, hour, min, sec, usec, false)
+
+	case intervalStyleISO8601:
+		if iv == (Interval{}) {
+			return append(b, "PT0S"...)
+		}
+		b = append(b, 'P')
+		b = appendISO8601Part(b, int64(year), 'Y')
+		b = appendISO8601Part(b, int64(mon), 'M')
+		b = appendISO8601Part(b, int64(day), 'D')
+		if iv.Microseconds != 0 {
+			b = append(b, 'T')
+		}
+		b = appendISO8601Part(b, hour, 'H')
+		b = appendISO8601Part(b, min, 'M')
+		if sec != 0 || usec != 0 {
+			if sec < 0 || usec < 0 {
+				b = append(b, '-')
+			}
+			b = appendIntervalSeconds(b, sec, usec, false)
+			b = append(b, 'S')
+		}
+		return b
+
+	case intervalStylePostgresVerbose:
+		b = append(b, '@')
+		for _, p := range []struct {
+			value int64
+			unit  string
+		}{{int64(year), "year"}, {int64(mon), "mon"}, {int64(day), "day"}, {hour, "hour"}, {min, "min"}} {
+			if p.value == 0 {
+				continue
+			}
+			// the first field sets the sign, and "ago" negates them all
+			v := p.value
+			if isZero {
+				isBefore = v < 0
+				v = absInt64(v)
+			} else if isBefore {
+				v = -v
+			}
+			b = append(b, ' ')
+			b = strconv.AppendInt(b, v, 10)
+			b = append(b, ' ')
+			b = append(b, p.unit...)
+			if v != 1 {
+				b = append(b, 's')
+			}
+			isZero = false
+		}
+		if sec != 0 || usec != 0 {
+			b = append(b, ' ')
+			if sec < 0 || (sec == 0 && usec < 0) {
+				if isZero {
+					isBefore = true
+				} else if !isBefore {
+					b = append(b, '-')
+				}
+			} else if isBefore {
+				b = append(b, '-')
+			}
+			b = appendIntervalSeconds(b, sec, usec, false)
+			b = append(b, " sec"...)
+			if absInt64(sec) != 1 || usec != 0 {
+				b = append(b, 's')
+			}
+			isZero = false
+		}
+		if isZero {
+			b = append(b, " 0"...)
+		}
+		if isBefore {
+			b = append(b, " ago"...)
+		}
+		return b
+	}
+
+	// postgres
+	for _, p := range []struct {
+		value int
+		unit  string
+	}{{year, "year"}, {mon, "mon"}, {day, "day"}} {
+		if p.value == 0 {
+			continue
+		}
+		if !isZero {
+			b = append(b, ' ')
+		}
+		// a field after a negative one has an explicit sign
+		if isBefore && p.value > 0 {
+			b = append(b, '+')
+		}
+		b = strconv.AppendInt(b, int64(p.value), 10)
+		b = append(b, ' ')
+		b = append(b, p.unit...)
+		if p.value != 1 {
+			b = append(b, 's')
+		}
+		isBefore = p.value < 0
+		isZero = false
+	}
+	if isZero || iv.Microseconds != 0 {
+		if !isZero {
+			b = append(b, ' ')
+		}
+		if iv.Microseconds < 0 {
+			b = append(b, '-')
+		} else if isBefore {
+			b = append(b, '+')
+		}
+		b = appendIntervalClock(b, hour, min, sec, usec, true)
+	}
+	return b
+}
+
+func intervalSign(negative bool) byte {
+	if negative {
+		return '-'
+	}
+	return '+'
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func absInt64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// appendIntervalClock appends the absolute value of a time of day as H:MM:SS,
+// or HH:MM:SS if padHours is set, followed by any fractional seconds.
+func appendIntervalClock(b []byte, hour, min, sec, usec int64, padHours bool) []byte {
+	hour, min = absInt64(hour), absInt64(min)
+	if padHours && hour < 10 {
+		b = append(b, '0')
+	}
+	b = strconv.AppendInt(b, hour, 10)
+	b = append(b, ':', byte('0'+min/10), byte('0'+min%10), ':')
+	return appendIntervalSeconds(b, sec, usec, true)
+}
+
+// appendIntervalSeconds appends the absolute value of sec seconds and usec
+// microseconds, without trailing zeros in the fraction, and with sec padded
+// to two digits if pad is set.
+func appendIntervalSeconds(b []byte, sec, usec int64, pad bool) []byte {
+	sec, usec = absInt64(sec), absInt64(usec)
+	if pad && sec < 10 {
+		b = append(b, '0')
+	}
+	b = strconv.AppendInt(b, sec, 10)
+	if usec != 0 {
+		frac := strconv.AppendInt(nil, usec+usecsPerSec, 10)[1:]
+		b = append(b, '.')
+		b = append(b, strings.TrimRight(string(frac), "0")...)
+	}
+	return b
+}
+
+func appendISO8601Part(b []byte, value int64, designator byte) []byte {
+	if value == 0 {
+		return b
+	}
+	b = strconv.AppendInt(b, value, 10)
+	return append(b, designator)
+}
+
+// parseInterval parses s, an interval in the text format of any of the
+// values of IntervalStyle.  Scan doesn't know the IntervalStyle of the session
+// the value came from, so the style is recognized by its form instead:
+// iso_8601 by its leading P, postgres_verbose by its leading @, postgres by
+// its units and sql_standard by their absence.  This can't mistake one style
+// for another.  The server writes the units of every postgres field but the
+// time of day, and never writes a letter in sql_standard, so the only text
+// both styles can produce is a lone time of day such as "04:05:06" or
+// "-4:05:06", which means the same in either.  A bare number of days, as in
+// the sql_standard "1 2:03:04", is always written with its unit in postgres.
+func parseInterval(s string) (iv Interval, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("pq: unable to parse interval %q: %v", s, err)
+		}
+	}()
+	switch {
+	case strings.HasPrefix(s, "P"):
+		return parseISO8601Interval(s[1:])
+	case strings.HasPrefix(s, "@"):
+		return parseVerboseInterval(strings.Fields(s[1:]))
+	case strings.IndexAny(s, "abcdefghijklmnopqrstuvwxyz") >= 0:
+		return parsePostgresInterval(strings.Fields(s))
+	}
+	return parseSQLStandardInterval(strings.Fields(s))
+}
+
+// intervalUnitMicroseconds lists the lengths of the units of the postgres and
+// postgres_verbose styles which are parts of the time of day.
+var intervalUnitMicroseconds = map[string]int64{
+	"hour": usecsPerHour, "hours": usecsPerHour,
+	"min": usecsPerMin, "mins": usecsPerMin,
+	"sec": usecsPerSec, "secs": usecsPerSec,
+}
+
+// addIntervalUnit adds value units to iv.
+func addIntervalUnit(iv *Interval, value string, unit string) error {
+	switch unit {
+	case "year", "years", "mon", "mons", "day", "days":
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		switch unit[0] {
+		case 'y':
+			iv.Months += int32(n * 12)
+		case 'm':
+			iv.Months += int32(n)
+		default:
+			iv.Days += int32(n)
+		}
+		return nil
+	}
+	usecs, ok := intervalUnitMicroseconds[unit]
+	if !ok {
+		return fmt.Errorf("unknown unit %q", unit)
+	}
+	if usecs == usecsPerSec {
+		n, err := parseIntervalSeconds(value)
+		iv.Microseconds += n
+		return err
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	iv.Microseconds += n * usecs
+	return err
+}
+
+// parsePostgresInterval parses the fields of an interval in the postgres
+// style, such as "-1 years -2 mons +3 days 04:05:06.5".
+func parsePostgresInterval(fields []string) (iv Interval, err error) {
+	for len(fields) >= 2 {
+		if err := addIntervalUnit(&iv, fields[0], fields[1]); err != nil {
+			return iv, err
+		}
+		fields = fields[2:]
+	}
+	if len(fields) == 1 {
+		usecs, err := parseIntervalClock(fields[0])
+		if err != nil {
+			return iv, err
+		}
+		iv.Microseconds += usecs
+	}
+	return iv, nil
+}
+
+// parseVerboseInterval parses the fields of an interval in the
+// postgres_verbose style, such as "1 year 2 mons 3 days 4 hours 5 mins 6.5
+// secs ago", after the leading @.
+func parseVerboseInterval(fields []string) (iv Interval, err error) {
+	ago := len(fields) > 0 && fields[len(fields)-1] == "ago"
+	if ago {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 1 && fields[0] == "0" {
+		return iv, nil
+	}
+	if len(fields)%2 != 0 {
+		return iv, fmt.Errorf("expected a value and a unit")
+	}
+	for ; len(fields) > 0; fields = fields[2:] {
+		if err := addIntervalUnit(&iv, fields[0], fields[1]); err != nil {
+			return iv, err
+		}
+	}
+	if ago {
+		iv = Interval{-iv.Months, -iv.Days, -iv.Microseconds}
+	}
+	return iv, nil
+}
+
+// parseSQLStandardInterval parses the fields of an interval in the
+// sql_standard style, such as "1-2", "-3 4:05:06" or "+1-2 -3 +4:05:06".  Its
+// fields only have signs of their own if there are three of them; otherwise a
+// leading minus sign applies to all of them.
+func parseSQLStandardInterval(fields []string) (iv Interval, err error) {
+	if len(fields) == 0 || len(fields) > 3 {
+		return iv, fmt.Errorf("expected 1 to 3 fields")
+	}
+	perField := len(fields) == 3
+	negative := !perField && strings.HasPrefix(fields[0], "-")
+	if negative {
+		fields[0] = fields[0][1:]
+	}
+	for _, f := range fields {
+		sign := int64(1)
+		if perField && f != "" && (f[0] == '+' || f[0] == '-') {
+			if f[0] == '-' {
+				sign = -1
+			}
+			f = f[1:]
+		}
+		switch {
+		case strings.IndexByte(f, ':') >= 0:
+			usecs, err := parseIntervalClock(f)
+			if err != nil {
+				return iv, err
+			}
+			iv.Microseconds = sign * usecs
+		case strings.IndexByte(f, '-') > 0:
+			i := strings.IndexByte(f, '-')
+			years, err := strconv.ParseUint(f[:i], 10, 31)
+			if err != nil {
+				return iv, err
+			}
+			months, err := strconv.ParseUint(f[i+1:], 10, 31)
+			if err != nil {
+				return iv, err
+			}
+			iv.Months = int32(sign * int64(years*12+months))
+		default:
+			days, err := strconv.ParseUint(f, 10, 31)
+			if err != nil {
+				return iv, err
+			}
+			iv.Days = int32(sign * int64(days))
+		}
+	}
+	if negative {
+		iv = Interval{-iv.Months, -iv.Days, -iv.Microseconds}
+	}
+	return iv, nil
+}
+
+// parseISO8601Interval parses an interval in the iso_8601 style, such as
+// "1Y2M3DT4H5M6.5S" or "-1Y-2M3DT-4H-5M-6S", after the leading P.
+func parseISO8601Interval(s string) (iv Interval, err error) {
+	if s == "" {
+		return iv, fmt.Errorf("no fields")
+	}
+	inTime := false
+	for s != "" {
+		if s[0] == 'T' && !inTime {
+			inTime = true
+			s = s[1:]
+			continue
+		}
+		i := strings.IndexAny(s, "YMWDHS")
+		if i <= 0 {
+			return iv, fmt.Errorf("expected a value and a designator")
+		}
+		value, designator := s[:i], s[i]
+		s = s[i+1:]
+		if designator == 'S' {
+			usecs, err := parseIntervalSeconds(value)
+			if err != nil {
+				return iv, err
+			}
+			iv.Microseconds += usecs
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return iv, err
+		}
+		switch {
+		case designator == 'Y' && !inTime:
+			iv.Months += int32(n * 12)
+		case designator == 'M' && !inTime:
+			iv.Months += int32(n)
+		case designator == 'W' && !inTime:
+			iv.Days += int32(n * 7)
+		case designator == 'D' && !inTime:
+			iv.Days += int32(n)
+		case designator == 'H' && inTime:
+			iv.Microseconds += n * usecsPerHour
+		case designator == 'M' && inTime:
+			iv.Microseconds += n * usecsPerMin
+		default:
+			return iv, fmt.Errorf("unexpected designator %c", designator)
+		}
+	}
+	return iv, nil
+}
+
+// parseIntervalClock parses a time of day such as "-04:05:06.5" into
+// microseconds.
+func parseIntervalClock(s string) (int64, error) {
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	hours, err := strconv.ParseUint(parts[0], 10, 63)
+	if err != nil {
+		return 0, err
+	}
+	mins, err := strconv.ParseUint(parts[1], 10, 63)
+	if err != nil {
+		return 0, err
+	}
+	secs, err := parseIntervalSeconds(parts[2])
+	if err != nil || secs < 0 {
+		return 0, fmt.Errorf("invalid seconds %q", parts[2])
+	}
+	usecs := int64(hours)*usecsPerHour + int64(mins)*usecsPerMin + secs
+	if negative {
+		usecs = -usecs
+	}
+	return usecs, nil
+}
+
+// parseIntervalSeconds parses a number of seconds with up to six fractional
+// digits, such as "-6.789", into microseconds.
+func parseIntervalSeconds(s string) (int64, error) {
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if len(frac) > 6 || strings.Trim(frac, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid seconds %q", s)
+	}
+	negative := strings.HasPrefix(whole, "-")
+	secs, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	usecs := secs * usecsPerSec
+	if frac != "" {
+		f, _ := strconv.ParseInt(frac+strings.Repeat("0", 6-len(frac)), 10, 64)
+		if negative {
+			f = -f
+		}
+		usecs += f
+	}
+	return usecs, nil
+}
@@ -0,0 +1,221 @@
+package pq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lib/pq/oid"
+)
+
+var intervalTests = []struct {
+	iv                                      Interval
+	postgres, verbose, sqlStandard, iso8601 string
+}{
+	{
+		Interval{},
+		"00:00:00", "@ 0", "0", "PT0S",
+	},
+	{
+		Interval{Months: 14},
+		"1 year 2 mons", "@ 1 year 2 mons", "1-2", "P1Y2M",
+	},
+	{
+		Interval{Days: 3, Microseconds: (4*3600 + 5*60 + 6) * 1e6},
+		"3 days 04:05:06", "@ 3 days 4 hours 5 mins 6 secs", "3 4:05:06", "P3DT4H5M6S",
+	},
+	{
+		Interval{Months: -14, Days: 3, Microseconds: -(4*3600 + 5*60 + 6) * 1e6},
+		"-1 years -2 mons +3 days -04:05:06", "@ 1 year 2 mons -3 days 4 hours 5 mins 6 secs ago",
+		"-1-2 +3 -4:05:06", "P-1Y-2M3DT-4H-5M-6S",
+	},
+	{
+		Interval{Days: -3, Microseconds: -(4*3600 + 5*60 + 6) * 1e6},
+		"-3 days -04:05:06", "@ 3 days 4 hours 5 mins 6 secs ago", "-3 4:05:06", "P-3DT-4H-5M-6S",
+	},
+	{
+		Interval{Months: 1, Days: -1},
+		"1 mon -1 days", "@ 1 mon -1 days", "+0-1 -1 +0:00:00", "P1M-1D",
+	},
+	{
+		Interval{Microseconds: 1500000},
+		"00:00:01.5", "@ 1.5 secs", "0:00:01.5", "PT1.5S",
+	},
+	{
+		Interval{Microseconds: -500},
+		"-00:00:00.0005", "@ 0.0005 secs ago", "-0:00:00.0005", "PT-0.0005S",
+	},
+	{
+		Interval{Microseconds: 1e6},
+		"00:00:01", "@ 1 sec", "0:00:01", "PT1S",
+	},
+	{
+		Interval{Microseconds: 123 * 3600 * 1e6},
+		"123:00:00", "@ 123 hours", "123:00:00", "PT123H",
+	},
+}
+
+func TestAppendInterval(t *testing.T) {
+	for _, tt := range intervalTests {
+		for _, f := range []struct {
+			style, want string
+		}{
+			{intervalStylePostgres, tt.postgres},
+			{intervalStylePostgresVerbose, tt.verbose},
+			{intervalStyleSQLStandard, tt.sqlStandard},
+			{intervalStyleISO8601, tt.iso8601},
+		} {
+			if got := string(appendInterval(nil, tt.iv, f.style)); got != f.want {
+				t.Errorf("%+v in %s: got %q, want %q", tt.iv, f.style, got, f.want)
+			}
+		}
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	for _, tt := range intervalTests {
+		for _, s := range []string{tt.postgres, tt.verbose, tt.sqlStandard, tt.iso8601} {
+			iv, err := parseInterval(s)
+			if err != nil {
+				t.Errorf("%q: %v", s, err)
+				continue
+			}
+			if iv != tt.iv {
+				t.Errorf("%q: got %+v, want %+v", s, iv, tt.iv)
+			}
+		}
+	}
+	// the input syntax of the server
+	if iv, err := parseInterval("P1W"); err != nil || iv != (Interval{Days: 7}) {
+		t.Errorf("got %+v, %v", iv, err)
+	}
+
+	for _, s := range []string{
+		"", "1 fortnight", "1 year 2", "@ 1", "@ 1 lightyear", "P", "P1H", "PT1D", "P1.5Y",
+		"1:2", "1:xx:03", "1-2-3 4 5:06:07 8", "00:00:01.1234567", "-x",
+	} {
+		if _, err := parseInterval(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestParseIntervalAmbiguous(t *testing.T) {
+	// text without units parses the same whether it came from a session in
+	// the postgres or the sql_standard style
+	clock := int64(2*3600+3*60+4) * 1e6
+	for _, tt := range []struct {
+		s    string
+		want Interval
+	}{
+		{"04:05:06", Interval{Microseconds: (4*3600 + 5*60 + 6) * 1e6}},
+		{"-04:05:06", Interval{Microseconds: -(4*3600 + 5*60 + 6) * 1e6}},
+		{"4:05:06", Interval{Microseconds: (4*3600 + 5*60 + 6) * 1e6}},
+		{"1 2:03:04", Interval{Days: 1, Microseconds: clock}},
+		{"-1 2:03:04", Interval{Days: -1, Microseconds: -clock}},
+		{"1 day 02:03:04", Interval{Days: 1, Microseconds: clock}},
+		{"0", Interval{}},
+	} {
+		iv, err := parseInterval(tt.s)
+		if err != nil {
+			t.Errorf("%q: %v", tt.s, err)
+			continue
+		}
+		if iv != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.s, iv, tt.want)
+		}
+	}
+}
+
+func TestIntervalDuration(t *testing.T) {
+	d, ok := Interval{Microseconds: -1500}.Duration()
+	if !ok || d != -1500*time.Microsecond {
+		t.Errorf("got %v, %v", d, ok)
+	}
+	for _, iv := range []Interval{{Days: 1}, {Months: -1}, {Microseconds: 1 << 60}} {
+		if _, ok := iv.Duration(); ok {
+			t.Errorf("%+v: expected no lossless duration", iv)
+		}
+	}
+	if iv := IntervalFromDuration(90*time.Minute + 1500*time.Nanosecond); iv != (Interval{Microseconds: 5400000001}) {
+		t.Errorf("got %+v", iv)
+	}
+}
+
+func TestIntervalScanValue(t *testing.T) {
+	var iv Interval
+	if err := iv.Scan([]byte("1 year 2 mons 3 days 04:05:06.789")); err != nil {
+		t.Fatal(err)
+	}
+	want := Interval{Months: 14, Days: 3, Microseconds: (4*3600+5*60+6)*1e6 + 789000}
+	if iv != want {
+		t.Errorf("got %+v", iv)
+	}
+	if s := iv.String(); s != "1 year 2 mons 3 days 04:05:06.789" {
+		t.Errorf("got %s", s)
+	}
+	if v, err := iv.Value(); err != nil || v != "P1Y2M3DT4H5M6.789S" {
+		t.Errorf("got %v, %v", v, err)
+	}
+	for _, src := range []interface{}{nil, int64(1), "1 parsec"} {
+		if err := iv.Scan(src); err == nil {
+			t.Errorf("%v: expected an error", src)
+		}
+	}
+}
+
+func TestIntervalStyleTracking(t *testing.T) {
+	cn := &conn{}
+	for _, style := range []string{intervalStyleISO8601, intervalStylePostgres} {
+		var b writeBuf
+		b.string("IntervalStyle")
+		b.string(style)
+		r := readBuf(b.buf)
+		cn.processParameterStatus(&r)
+		if cn.parameterStatus.intervalStyle != style {
+			t.Errorf("got %q, want %q", cn.parameterStatus.intervalStyle, style)
+		}
+	}
+
+	ps := &parameterStatus{intervalStyle: intervalStyleSQLStandard}
+	usecs := int64(-1500000)
+	b := appendUint64(nil, uint64(usecs))
+	b = append(b, 0, 0, 0, 3, 0, 0, 0, 14)
+	if got := string(binaryDecode(ps, b, oid.T_interval).([]byte)); got != "+1-2 +3 -0:00:01.5" {
+		t.Errorf("got %q", got)
+	}
+	if binaryDecoders[oid.T_interval].usable(&parameterStatus{}) {
+		t.Error("binary intervals used without a known IntervalStyle")
+	}
+}
+
+func TestIntervalDB(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer txn.Rollback()
+	for _, style := range []string{"postgres", "postgres_verbose", "sql_standard", "iso_8601"} {
+		if _, err := txn.Exec("SET LOCAL IntervalStyle = " + style); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range intervalTests {
+			var iv Interval
+			if err := txn.QueryRow("SELECT $1::interval", tt.iv).Scan(&iv); err != nil {
+				t.Fatal(err)
+			}
+			if iv != tt.iv {
+				t.Errorf("%s: got %+v, want %+v", style, iv, tt.iv)
+			}
+			var s string
+			if err := txn.QueryRow("SELECT $1::interval::text", tt.iv).Scan(&s); err != nil {
+				t.Fatal(err)
+			}
+			if want := string(appendInterval(nil, tt.iv, style)); s != want {
+				t.Errorf("%s: server formatted %+v as %q, want %q", style, tt.iv, s, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package pq
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// JSON returns a driver.Valuer and sql.Scanner for a value of type json or
+// jsonb, which is converted to and from v with the encoding/json package.  For
+// scanning, v must be a pointer.
+//
+//	var attrs map[string]interface{}
+//	err := db.QueryRow("SELECT attrs FROM product WHERE id = $1", id).Scan(pq.JSON(&attrs))
+//
+//	_, err = db.Exec("UPDATE product SET attrs = $1 WHERE id = $2", pq.JSON(attrs), id)
+//
+// A nil v, or a nil pointer, is sent as NULL.  Scanning NULL has the same
+// effect as unmarshaling the JSON null, which sets pointers, maps, slices and
+// interface values to nil and leaves other values unchanged.
+//
+// The document is unmarshaled from the buffer the value was received into,
+// without copying it first; jsonb values received in the binary format are
+// passed on without their version byte.
+func JSON(v interface{}) interface {
+	driver.Valuer
+	sql.Scanner
+} {
+	return jsonValue{v}
+}
+
+type jsonValue struct{ v interface{} }
+
+// Scan implements the sql.Scanner interface.
+func (j jsonValue) Scan(src interface{}) error {
+	dpv := reflect.ValueOf(j.v)
+	if dpv.Kind() != reflect.Ptr || dpv.IsNil() {
+		return fmt.Errorf("pq: destination %T is not a non-nil pointer", j.v)
+	}
+
+	var err error
+	switch src := src.(type) {
+	case []byte:
+		err = json.Unmarshal(src, j.v)
+	case string:
+		err = json.Unmarshal([]byte(src), j.v)
+	case nil:
+		err = json.Unmarshal([]byte("null"), j.v)
+	default:
+		return fmt.Errorf("pq: cannot convert %T to %s", src, dpv.Type().Elem())
+	}
+	if err != nil {
+		return fmt.Errorf("pq: decoding JSON into %T: %v", j.v, err)
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (j jsonValue) Value() (driver.Value, error) {
+	if j.v == nil {
+		return nil, nil
+	}
+	if rv := reflect.ValueOf(j.v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil, nil
+	}
+	b, err := json.Marshal(j.v)
+	if err != nil {
+		return nil, fmt.Errorf("pq: encoding %T as JSON: %v", j.v, err)
+	}
+	return b, nil
+}
+
+// JSONArray returns a driver.Valuer and sql.Scanner for a one-dimensional
+// array of json or jsonb values, whose elements are converted to and from the
+// elements of the slice or array a as by JSON.  For scanning, a must be a
+// pointer to a slice, or to an array of the same length as the array which
+// is scanned.
+//
+//	var events []event
+//	err := db.QueryRow("SELECT array_agg(payload) FROM log").Scan(pq.JSONArray(&events))
+//
+// Scanning NULL into a slice sets it to nil.
+func JSONArray(a interface{}) interface {
+	driver.Valuer
+	sql.Scanner
+} {
+	return jsonArray{a}
+}
+
+type jsonArray struct{ a interface{} }
+
+// Scan implements the sql.Scanner interface.
+func (a jsonArray) Scan(src interface{}) error {
+	dpv := reflect.ValueOf(a.a)
+	switch {
+	case dpv.Kind() != reflect.Ptr:
+		return fmt.Errorf("pq: destination %T is not a pointer to array or slice", a.a)
+	case dpv.IsNil():
+		return fmt.Errorf("pq: destination %T is nil", a.a)
+	}
+	dv := dpv.Elem()
+	switch dv.Kind() {
+	case reflect.Slice, reflect.Array:
+	default:
+		return fmt.Errorf("pq: destination %T is not a pointer to array or slice", a.a)
+	}
+
+	switch src := src.(type) {
+	case []byte:
+		return a.scanBytes(src, dv)
+	case string:
+		return a.scanBytes([]byte(src), dv)
+	case nil:
+		if dv.Kind() == reflect.Slice {
+			dv.Set(reflect.Zero(dv.Type()))
+			return nil
+		}
+	}
+	return fmt.Errorf("pq: cannot convert %T to %s", src, dv.Type())
+}
+
+func (a jsonArray) scanBytes(src []byte, dv reflect.Value) error {
+	dims, elems, err := parseArray(src, []byte{','})
+	if err != nil {
+		return err
+	}
+	if len(dims) > 1 {
+		return fmt.Errorf("pq: cannot convert ARRAY%s to %s", formatArrayDims(dims), dv.Type())
+	}
+	if len(dims) == 0 {
+		dims = []int{0}
+	}
+	return assignArray(dv, dims, elems, func(src []byte, dest reflect.Value) error {
+		if src == nil {
+			return jsonValue{dest.Addr().Interface()}.Scan(nil)
+		}
+		return jsonValue{dest.Addr().Interface()}.Scan(src)
+	})
+}
+
+// Value implements the driver.Valuer interface.
+func (a jsonArray) Value() (driver.Value, error) {
+	if a.a == nil {
+		return nil, nil
+	}
+	rv := reflect.ValueOf(a.a)
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return nil, nil
+		}
+	case reflect.Array:
+	default:
+		return nil, fmt.Errorf("pq: Unable to convert %T to array", a.a)
+	}
+
+	b := []byte{'{'}
+	for i := 0; i < rv.Len(); i++ {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		v, err := jsonValue{rv.Index(i).Interface()}.Value()
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			b = append(b, "NULL"...)
+		} else {
+			b = appendArrayQuotedBytes(b, v.([]byte))
+		}
+	}
+	return string(append(b, '}')), nil
+}
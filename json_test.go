@@ -0,0 +1,197 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/lib/pq/oid"
+)
+
+type jsonItem struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+func TestJSONScan(t *testing.T) {
+	var it jsonItem
+	if err := JSON(&it).Scan([]byte(`{"name": "pen", "tags": ["blue"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(it, jsonItem{"pen", []string{"blue"}}) {
+		t.Errorf("got %+v", it)
+	}
+	var m map[string]interface{}
+	if err := JSON(&m).Scan(`{"a": 1.5}`); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, map[string]interface{}{"a": 1.5}) {
+		t.Errorf("got %v", m)
+	}
+	if err := JSON(&m).Scan(nil); err != nil || m != nil {
+		t.Errorf("got %v, %v for NULL", m, err)
+	}
+	p := &it
+	if err := JSON(&p).Scan(nil); err != nil || p != nil {
+		t.Errorf("got %v, %v for NULL", p, err)
+	}
+
+	for _, tt := range []struct {
+		dest, src interface{}
+	}{
+		{it, []byte(`{}`)},
+		{(*jsonItem)(nil), []byte(`{}`)},
+		{&it, []byte(`{"name": 1}`)},
+		{&it, []byte(`{`)},
+		{&it, int64(1)},
+	} {
+		if err := JSON(tt.dest).Scan(tt.src); err == nil {
+			t.Errorf("%T from %v: expected an error", tt.dest, tt.src)
+		}
+	}
+}
+
+func TestJSONValue(t *testing.T) {
+	for _, tt := range []struct {
+		v    interface{}
+		want driver.Value
+	}{
+		{jsonItem{Name: "a\"b"}, []byte(`{"name":"a\"b"}`)},
+		{[]int{1, 2}, []byte(`[1,2]`)},
+		{"x", []byte(`"x"`)},
+		{nil, nil},
+		{(*jsonItem)(nil), nil},
+	} {
+		v, err := JSON(tt.v).Value()
+		if err != nil {
+			t.Errorf("%v: %v", tt.v, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.want) {
+			t.Errorf("%v: got %q, want %q", tt.v, v, tt.want)
+		}
+	}
+	if _, err := JSON(make(chan int)).Value(); err == nil {
+		t.Error("expected an error for a channel")
+	}
+}
+
+func TestJSONArrayScan(t *testing.T) {
+	var items []*jsonItem
+	src := `{"{\"name\": \"pen\"}",NULL,"{\"name\": \"ink\", \"tags\": [\"a,b\"]}"}`
+	if err := JSONArray(&items).Scan([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	want := []*jsonItem{{Name: "pen"}, nil, {Name: "ink", Tags: []string{"a,b"}}}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got %+v", items)
+	}
+	if err := JSONArray(&items).Scan(nil); err != nil || items != nil {
+		t.Errorf("got %v, %v for NULL", items, err)
+	}
+	var nums [2]float64
+	if err := JSONArray(&nums).Scan("{1,2.5}"); err != nil || nums != [2]float64{1, 2.5} {
+		t.Errorf("got %v, %v", nums, err)
+	}
+	var raw []json.RawMessage
+	if err := JSONArray(&raw).Scan("{}"); err != nil || raw == nil || len(raw) != 0 {
+		t.Errorf("got %#v, %v", raw, err)
+	}
+
+	for _, tt := range []struct {
+		dest interface{}
+		src  string
+	}{
+		{items, "{}"},
+		{&nums, "{1}"},
+		{&items, "{{1},{2}}"},
+		{&items, `{"[1]"}`},
+		{&items, "{"},
+	} {
+		if err := JSONArray(tt.dest).Scan(tt.src); err == nil {
+			t.Errorf("%T from %s: expected an error", tt.dest, tt.src)
+		}
+	}
+}
+
+func TestJSONArrayValue(t *testing.T) {
+	for _, tt := range []struct {
+		a    interface{}
+		want driver.Value
+	}{
+		{[]*jsonItem{{Name: `a"b`}, nil}, `{"{\"name\":\"a\\\"b\"}",NULL}`},
+		{[2]int{1, 2}, `{"1","2"}`},
+		{[]int{}, `{}`},
+		{[]int(nil), nil},
+		{nil, nil},
+	} {
+		v, err := JSONArray(tt.a).Value()
+		if err != nil {
+			t.Errorf("%v: %v", tt.a, err)
+			continue
+		}
+		if v != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.a, v, tt.want)
+		}
+	}
+	if _, err := JSONArray(1).Value(); err == nil {
+		t.Error("expected an error for an int")
+	}
+	if _, err := JSONArray([]interface{}{make(chan int)}).Value(); err == nil {
+		t.Error("expected an error for a channel")
+	}
+}
+
+func TestBinaryJSONB(t *testing.T) {
+	ps := &parameterStatus{}
+	src := []byte("\x01{\"a\": 1}")
+	got := binaryDecode(ps, src, oid.T_jsonb).([]byte)
+	if string(got) != `{"a": 1}` || &got[0] != &src[1] {
+		t.Errorf("got %q, not a slice of the received value", got)
+	}
+	if b := mustBinaryEncode(t, `{"a": 1}`, oid.T_jsonb); string(b) != string(src) {
+		t.Errorf("got %q", b)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic for an unknown jsonb version")
+			}
+		}()
+		binaryDecode(ps, []byte("\x02{}"), oid.T_jsonb)
+	}()
+}
+
+func TestJSONDB(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	for _, typ := range []string{"json", "jsonb"} {
+		in := jsonItem{Name: "pen", Tags: []string{"blue", "red"}}
+		var out jsonItem
+		// without arguments, the value is received in the text format
+		if err := db.QueryRow(`SELECT '{"name": "pen", "tags": ["blue", "red"]}'::` + typ).Scan(JSON(&out)); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, in) {
+			t.Errorf("%s: got %+v", typ, out)
+		}
+		out = jsonItem{}
+		if err := db.QueryRow("SELECT $1::"+typ, JSON(in)).Scan(JSON(&out)); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, in) {
+			t.Errorf("%s: got %+v", typ, out)
+		}
+
+		var items []*jsonItem
+		if err := db.QueryRow("SELECT $1::"+typ+"[]", JSONArray([]*jsonItem{&in, nil})).Scan(JSONArray(&items)); err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 2 || !reflect.DeepEqual(*items[0], in) || items[1] != nil {
+			t.Errorf("%s: got %+v", typ, items)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// SetNoticeHandler sets the function which is called for every NoticeResponse
+// (e.g. the output of RAISE NOTICE, or a WARNING issued by the server) received
+// on c, which must be a connection returned by Open or DialOpen.  A nil
+// handler makes the connection discard notices again, which is the default.
+//
+// The handler is called synchronously while the connection is processing
+// server messages, so no further progress is made on the connection until it
+// returns.  During COPY FROM STDIN it is called from a goroutine other than
+// the one executing the COPY.  SetNoticeHandler must not be called while c is
+// in use.
+//
+// To set a notice handler on every connection of a *sql.DB, use the
+// NoticeHandler field of the Config of a Connector instead.  See
+// ListenerConn.SetNoticeHandler and Listener.SetNoticeHandler for receiving
+// notices on LISTEN / NOTIFY connections.
+func SetNoticeHandler(c driver.Conn, handler func(*Error)) error {
+	cn, ok := c.(*conn)
+	if !ok {
+		return fmt.Errorf("pq: SetNoticeHandler called with a connection of type %T", c)
+	}
+	cn.noticeHandler = handler
+	return nil
+}
+
+// processNotice parses the NoticeResponse in r and passes it to the notice
+// handler, if one is set.
+func (cn *conn) processNotice(r *readBuf) {
+	if cn.noticeHandler != nil {
+		cn.noticeHandler(parseError(r))
+	}
+}
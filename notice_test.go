@@ -0,0 +1,181 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestNoticeHandlerQuery(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.recvStartupPacket()
+		s.sendAuth(0, nil)
+		s.sendNotice("WARNING", "01000", "startup notice")
+		s.sendReadyForQuery()
+
+		s.expectQuery("SELECT raise_notice()")
+		s.sendNotice("NOTICE", "00000", "hello")
+		s.sendCommandComplete("SELECT 1")
+		s.sendNotice("WARNING", "01000", "world")
+		s.sendReadyForQuery()
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.(*conn).c.Close()
+
+	var notices []*Error
+	if err := SetNoticeHandler(cn, func(e *Error) {
+		notices = append(notices, e)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cn.(driver.Execer).Exec("SELECT raise_notice()", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notices) != 2 {
+		t.Fatalf("expected 2 notices, got %d", len(notices))
+	}
+	if n := notices[0]; n.Severity != Enotice || n.Message != "hello" {
+		t.Errorf("unexpected first notice %+v", n)
+	}
+	if n := notices[1]; n.Severity != Ewarning || n.Code != "01000" || n.Message != "world" {
+		t.Errorf("unexpected second notice %+v", n)
+	}
+}
+
+func TestNoticeHandlerCopyIn(t *testing.T) {
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+
+		s.expectQuery("BEGIN")
+		s.sendCommandComplete("BEGIN")
+		s.sendReadyForQueryStatus(txnStatusIdleInTransaction)
+
+		s.expectQuery(`COPY "temp" ("a") FROM STDIN`)
+		w := newFakeMessage('G')
+		w.byte(0)
+		w.int16(1)
+		w.int16(0)
+		s.send(w)
+		if r := s.expect('d'); string(r) != "1\n" {
+			s.fail("unexpected CopyData %q", r)
+		}
+		s.expect('c')
+		s.sendNotice("NOTICE", "00000", "copied")
+		s.sendCommandComplete("COPY 1")
+		s.sendReadyForQueryStatus(txnStatusIdleInTransaction)
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.(*conn).c.Close()
+
+	notices := make(chan *Error, 1)
+	SetNoticeHandler(cn, func(e *Error) {
+		notices <- e
+	})
+	if _, err := cn.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := cn.Prepare(CopyIn("temp", "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.Exec([]driver.Value{int64(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.Exec(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case n := <-notices:
+		if n.Message != "copied" {
+			t.Errorf("unexpected notice %+v", n)
+		}
+	default:
+		t.Fatal("expected a notice")
+	}
+}
+
+func TestNoticeHandlerListenerConn(t *testing.T) {
+	received := make(chan struct{})
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		<-received
+		s.sendNotice("NOTICE", "00000", "listening")
+	})
+	notifications := make(chan *Notification)
+	l, err := newDialListenerConn(d, "user=pqgotest sslmode=disable", notifications)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	notices := make(chan *Error, 1)
+	l.SetNoticeHandler(func(e *Error) {
+		notices <- e
+	})
+	close(received)
+
+	select {
+	case n := <-notices:
+		if n.Message != "listening" {
+			t.Errorf("unexpected notice %+v", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a notice")
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNoticeHandlerRaiseNotice(t *testing.T) {
+	// sets up the environment for Open
+	db := openTestConn(t)
+	defer db.Close()
+
+	cn, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.Close()
+
+	var notices []*Error
+	SetNoticeHandler(cn, func(e *Error) {
+		notices = append(notices, e)
+	})
+	_, err = cn.(driver.Execer).Exec(`DO language plpgsql $$
+		BEGIN
+			RAISE NOTICE 'notice %', 1;
+			RAISE WARNING 'warning %', 2;
+		END
+	$$`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notices) != 2 {
+		t.Fatalf("expected 2 notices, got %d", len(notices))
+	}
+	if n := notices[0]; n.Severity != Enotice || n.Message != "notice 1" {
+		t.Errorf("unexpected first notice %+v", n)
+	}
+	if n := notices[1]; n.Severity != Ewarning || n.Message != "warning 2" {
+		t.Errorf("unexpected second notice %+v", n)
+	}
+}
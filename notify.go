@@ -45,10 +45,11 @@ var errListenerConnClosed = errors.New("pq: ListenerConn has been closed")
 // ListenerConn is a low-level interface for waiting for notifications.  You
 // should use Listener instead.
 type ListenerConn struct {
-	// guards cn and err
+	// guards cn, err and noticeHandler
 	connectionLock sync.Mutex
 	cn             *conn
 	err            error
+	noticeHandler  func(*Error)
 
 	connState int32
 
@@ -62,7 +63,11 @@ type ListenerConn struct {
 
 // Creates a new ListenerConn.  Use NewListener instead.
 func NewListenerConn(name string, notificationChan chan<- *Notification) (*ListenerConn, error) {
-	cn, err := Open(name)
+	return newDialListenerConn(defaultDialer{}, name, notificationChan)
+}
+
+func newDialListenerConn(d Dialer, name string, notificationChan chan<- *Notification) (*ListenerConn, error) {
+	cn, err := DialOpen(d, name)
 	if err != nil {
 		return nil, err
 	}
@@ -103,6 +108,26 @@ func (l *ListenerConn) releaseSenderLock() {
 	l.senderLock.Unlock()
 }
 
+// SetNoticeHandler sets the function which is called for every
+// NoticeResponse received on the connection; see the package-level
+// SetNoticeHandler.  The handler is called from the goroutine receiving
+// notifications, so it should avoid doing potentially time-consuming
+// operations.  It is safe to call SetNoticeHandler at any time.
+func (l *ListenerConn) SetNoticeHandler(handler func(*Error)) {
+	l.connectionLock.Lock()
+	l.noticeHandler = handler
+	l.connectionLock.Unlock()
+}
+
+func (l *ListenerConn) processNotice(r *readBuf) {
+	l.connectionLock.Lock()
+	handler := l.noticeHandler
+	l.connectionLock.Unlock()
+	if handler != nil {
+		handler(parseError(r))
+	}
+}
+
 // setState advances the protocol state to newState.  Returns false if moving
 // to that state from the current state is not allowed.
 func (l *ListenerConn) setState(newState int32) bool {
@@ -170,7 +195,10 @@ func (l *ListenerConn) listenerConnLoop() (err error) {
 			}
 			l.replyChan <- message{t, nil}
 
-		case 'N', 'S':
+		case 'N':
+			l.processNotice(r)
+
+		case 'S':
 			// ignore
 		default:
 			return fmt.Errorf("unexpected message %q from server in listenerConnLoop", t)
@@ -399,6 +427,7 @@ type Listener struct {
 	cn                   *ListenerConn
 	connNotificationChan <-chan *Notification
 	channels             map[string]struct{}
+	noticeHandler        func(*Error)
 }
 
 // NewListener creates a new database connection dedicated to LISTEN / NOTIFY.
@@ -567,6 +596,20 @@ func (l *Listener) UnlistenAll() error {
 	return nil
 }
 
+// SetNoticeHandler sets the function which is called for every
+// NoticeResponse received on the Listener's database connection, including
+// any connections established after a reconnect.  See
+// ListenerConn.SetNoticeHandler.
+func (l *Listener) SetNoticeHandler(handler func(*Error)) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.noticeHandler = handler
+	if l.cn != nil {
+		l.cn.SetNoticeHandler(handler)
+	}
+}
+
 // Ping the remote server to make sure it's alive.  Non-nil return value means
 // that there is no active connection.
 func (l *Listener) Ping() error {
@@ -668,6 +711,7 @@ func (l *Listener) connect() error {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 
+	cn.SetNoticeHandler(l.noticeHandler)
 	err = l.resync(cn, notificationChan)
 	if err != nil {
 		cn.Close()
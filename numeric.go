@@ -0,0 +1,273 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Numeric represents a value of type numeric exactly.  Its value is
+// Int×10^-Scale, unless it is NaN or infinite.  The zero Numeric, whose Int is
+// nil, represents NULL.
+type Numeric struct {
+	// the unscaled value of a finite number
+	Int *big.Int
+	// the number of digits after the decimal point, which is kept when the
+	// value is scanned, so that 1.50 stays 1.50
+	Scale int
+	// whether the value is NaN
+	NaN bool
+	// 1 or -1 if the value is positive or negative infinity, which
+	// PostgreSQL 14 and later support
+	Inf int
+}
+
+var (
+	bigOne = big.NewInt(1)
+	bigTen = big.NewInt(10)
+)
+
+// ParseNumeric parses s, a numeric in the text format, such as "-12.50",
+// "1.5e3", "NaN" or "Infinity".
+func ParseNumeric(s string) (Numeric, error) {
+	switch strings.ToLower(s) {
+	case "nan":
+		return Numeric{NaN: true}, nil
+	case "infinity", "+infinity", "inf", "+inf":
+		return Numeric{Inf: 1}, nil
+	case "-infinity", "-inf":
+		return Numeric{Inf: -1}, nil
+	}
+
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		if exp, err = strconv.Atoi(s[i+1:]); err != nil {
+			return Numeric{}, fmt.Errorf("pq: invalid numeric %q", s)
+		}
+		mantissa = s[:i]
+	}
+	scale := 0
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		scale = len(mantissa) - i - 1
+		mantissa = mantissa[:i] + mantissa[i+1:]
+	}
+	// SetString would accept a sign on its own, and underscores
+	digits := strings.TrimLeft(mantissa, "+-")
+	if len(mantissa)-len(digits) > 1 || digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return Numeric{}, fmt.Errorf("pq: invalid numeric %q", s)
+	}
+	n := Numeric{Int: new(big.Int), Scale: scale - exp}
+	n.Int.SetString(mantissa, 10)
+	if n.Scale < 0 {
+		n.Int.Mul(n.Int, pow10(-n.Scale))
+		n.Scale = 0
+	}
+	return n, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// NumericFromRat returns the Numeric with the value of r, which must have a
+// finite decimal representation.
+func NumericFromRat(r *big.Rat) (Numeric, error) {
+	// r has a finite decimal representation if the only prime factors of its
+	// denominator are 2 and 5, and it has as many digits after the decimal
+	// point as the larger of their exponents.
+	denom := new(big.Int).Set(r.Denom())
+	m := new(big.Int)
+	var twos, fives int
+	for q := new(big.Int); denom.Cmp(bigOne) != 0; {
+		if q.QuoRem(denom, big.NewInt(2), m); m.Sign() == 0 {
+			denom.Set(q)
+			twos++
+		} else if q.QuoRem(denom, big.NewInt(5), m); m.Sign() == 0 {
+			denom.Set(q)
+			fives++
+		} else {
+			return Numeric{}, fmt.Errorf("pq: %s has no finite decimal representation", r.RatString())
+		}
+	}
+	scale := twos
+	if fives > scale {
+		scale = fives
+	}
+	n := Numeric{Int: new(big.Int).Mul(r.Num(), pow10(scale)), Scale: scale}
+	n.Int.Quo(n.Int, r.Denom())
+	return n, nil
+}
+
+// NumericFromFloat returns the Numeric with the exact value of f.
+func NumericFromFloat(f *big.Float) Numeric {
+	if f.IsInf() {
+		return Numeric{Inf: f.Sign()}
+	}
+	r, _ := f.Rat(nil)
+	n, err := NumericFromRat(r)
+	if err != nil {
+		// binary fractions always have a finite decimal representation
+		panic(err)
+	}
+	return n
+}
+
+// Rat returns the value of n as a *big.Rat, or nil if it's NULL, NaN or
+// infinite.
+func (n Numeric) Rat() *big.Rat {
+	if n.Int == nil || n.NaN || n.Inf != 0 {
+		return nil
+	}
+	return new(big.Rat).SetFrac(n.Int, pow10(n.Scale))
+}
+
+// Float returns the value of n as a *big.Float, rounded if it has no exact
+// binary representation, or nil if it's NULL or NaN.
+func (n Numeric) Float() *big.Float {
+	if n.Inf != 0 {
+		return new(big.Float).SetInf(n.Inf < 0)
+	}
+	r := n.Rat()
+	if r == nil {
+		return nil
+	}
+	return new(big.Float).SetRat(r)
+}
+
+// String returns n in the text format of numeric, or "NULL".
+func (n Numeric) String() string {
+	if n.Int == nil && !n.NaN && n.Inf == 0 {
+		return "NULL"
+	}
+	return string(n.append(nil))
+}
+
+func (n Numeric) append(b []byte) []byte {
+	switch {
+	case n.NaN:
+		return append(b, "NaN"...)
+	case n.Inf > 0:
+		return append(b, "Infinity"...)
+	case n.Inf < 0:
+		return append(b, "-Infinity"...)
+	}
+	if n.Int.Sign() < 0 {
+		b = append(b, '-')
+	}
+	digits := new(big.Int).Abs(n.Int).String()
+	if n.Scale <= 0 {
+		b = append(b, digits...)
+		for i := n.Scale; i < 0; i++ {
+			b = append(b, '0')
+		}
+		return b
+	}
+	if len(digits) <= n.Scale {
+		digits = strings.Repeat("0", n.Scale-len(digits)+1) + digits
+	}
+	i := len(digits) - n.Scale
+	b = append(b, digits[:i]...)
+	b = append(b, '.')
+	return append(b, digits[i:]...)
+}
+
+// Scan implements the sql.Scanner interface.
+func (n *Numeric) Scan(src interface{}) (err error) {
+	switch src := src.(type) {
+	case []byte:
+		*n, err = ParseNumeric(string(src))
+		return err
+	case string:
+		*n, err = ParseNumeric(src)
+		return err
+	case int64:
+		*n = Numeric{Int: big.NewInt(src)}
+		return nil
+	case float64:
+		*n, err = ParseNumeric(strconv.FormatFloat(src, 'g', -1, 64))
+		return err
+	case nil:
+		*n = Numeric{}
+		return nil
+	}
+	return fmt.Errorf("pq: cannot convert %T to Numeric", src)
+}
+
+// Value implements the driver.Valuer interface.
+func (n Numeric) Value() (driver.Value, error) {
+	if n.Int == nil && !n.NaN && n.Inf == 0 {
+		return nil, nil
+	}
+	return string(n.append(nil)), nil
+}
+
+// numericParameter converts x to the text format of numeric if it's a
+// *big.Int, *big.Rat or *big.Float, which database/sql doesn't accept as
+// parameters.
+func numericParameter(x interface{}) (v driver.Value, ok bool, err error) {
+	var n Numeric
+	switch x := x.(type) {
+	case *big.Int:
+		if x == nil {
+			return nil, true, nil
+		}
+		n = Numeric{Int: x}
+	case *big.Rat:
+		if x == nil {
+			return nil, true, nil
+		}
+		if n, err = NumericFromRat(x); err != nil {
+			return nil, true, err
+		}
+	case *big.Float:
+		if x == nil {
+			return nil, true, nil
+		}
+		n = NumericFromFloat(x)
+	default:
+		return nil, false, nil
+	}
+	return string(n.append(nil)), true, nil
+}
+
+// decodeBinaryNumeric decodes a numeric in the binary format, which consists
+// of the number of its base 10000 digits, the weight of the first digit, the
+// sign, the number of decimal digits after the decimal point, and the digits.
+func decodeBinaryNumeric(s []byte) Numeric {
+	r := readBuf(s)
+	ndigits := r.int16()
+	weight := int(int16(r.int16()))
+	sign := uint16(r.int16())
+	dscale := r.int16()
+	switch sign {
+	case 0xc000:
+		return Numeric{NaN: true}
+	case 0xd000:
+		return Numeric{Inf: 1}
+	case 0xf000:
+		return Numeric{Inf: -1}
+	}
+
+	n := Numeric{Int: new(big.Int), Scale: dscale}
+	base := big.NewInt(10000)
+	var d big.Int
+	for i := 0; i < ndigits; i++ {
+		n.Int.Mul(n.Int, base)
+		n.Int.Add(n.Int, d.SetInt64(int64(r.int16())))
+	}
+	// The digits are worth 10000^(weight-ndigits+1) each; scale them to units
+	// of 10^-dscale, dropping any digits past dscale, as the text format
+	// does.
+	if exp := 4*(weight-ndigits+1) + dscale; exp >= 0 {
+		n.Int.Mul(n.Int, pow10(exp))
+	} else {
+		n.Int.Quo(n.Int, pow10(-exp))
+	}
+	if sign == 0x4000 {
+		n.Int.Neg(n.Int)
+	}
+	return n
+}
@@ -0,0 +1,183 @@
+package pq
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseNumeric(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		want  string
+		scale int
+	}{
+		{"0", "0", 0},
+		{"-12.50", "-12.50", 2},
+		{"+.5", "0.5", 1},
+		{"0.000", "0.000", 3},
+		{"1.5e3", "1500", 0},
+		{"1.25E-3", "0.00125", 5},
+		{"123456789012345678901234567890.123456789", "123456789012345678901234567890.123456789", 9},
+		{"NaN", "NaN", 0},
+		{"infinity", "Infinity", 0},
+		{"-Infinity", "-Infinity", 0},
+	} {
+		n, err := ParseNumeric(tt.input)
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		if s := n.String(); s != tt.want || n.Scale != tt.scale {
+			t.Errorf("%q: got %s with scale %d", tt.input, s, n.Scale)
+		}
+	}
+
+	for _, input := range []string{"", "-", "+-1", "1.2.3", "1e", "1x", "1_000", "."} {
+		if _, err := ParseNumeric(input); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestNumericConversions(t *testing.T) {
+	n, err := ParseNumeric("-2.50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := n.Rat(); r.Cmp(big.NewRat(-5, 2)) != 0 {
+		t.Errorf("got %v", r)
+	}
+	if f, _ := n.Float().Float64(); f != -2.5 {
+		t.Errorf("got %v", f)
+	}
+	if (Numeric{NaN: true}).Rat() != nil || (Numeric{NaN: true}).Float() != nil || (Numeric{}).Rat() != nil {
+		t.Error("expected no value for NaN and NULL")
+	}
+	if f := (Numeric{Inf: -1}).Float(); !f.IsInf() || f.Sign() > 0 {
+		t.Errorf("got %v", f)
+	}
+
+	for _, tt := range []struct {
+		r    *big.Rat
+		want string
+	}{
+		{big.NewRat(0, 1), "0"},
+		{big.NewRat(7, 1), "7"},
+		{big.NewRat(1, 8), "0.125"},
+		{big.NewRat(-7, 20), "-0.35"},
+		{big.NewRat(1, 1000), "0.001"},
+	} {
+		n, err := NumericFromRat(tt.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := n.String(); s != tt.want {
+			t.Errorf("%v: got %s, want %s", tt.r, s, tt.want)
+		}
+	}
+	if _, err := NumericFromRat(big.NewRat(1, 6)); err == nil {
+		t.Error("expected an error for 1/6")
+	}
+
+	if s := NumericFromFloat(big.NewFloat(0.1)).String(); s != "0.1000000000000000055511151231257827021181583404541015625" {
+		t.Errorf("got %s", s)
+	}
+	if n := NumericFromFloat(new(big.Float).SetInf(false)); n.Inf != 1 {
+		t.Errorf("got %+v", n)
+	}
+}
+
+func TestNumericScanValue(t *testing.T) {
+	var n Numeric
+	for _, tt := range []struct {
+		src  interface{}
+		want string
+	}{
+		{[]byte("1.10"), "1.10"},
+		{"NaN", "NaN"},
+		{int64(-3), "-3"},
+		{float64(0.25), "0.25"},
+		{float64(1e21), "1000000000000000000000"},
+		{nil, "NULL"},
+	} {
+		if err := n.Scan(tt.src); err != nil {
+			t.Errorf("%v: %v", tt.src, err)
+			continue
+		}
+		if s := n.String(); s != tt.want {
+			t.Errorf("%v: got %s, want %s", tt.src, s, tt.want)
+		}
+	}
+	if err := n.Scan(true); err == nil {
+		t.Error("expected an error for a bool")
+	}
+	if err := n.Scan("abc"); err == nil {
+		t.Error("expected an error for an invalid numeric")
+	}
+
+	if v, err := (Numeric{}).Value(); v != nil || err != nil {
+		t.Errorf("got %v, %v for NULL", v, err)
+	}
+	if v, err := (Numeric{Int: big.NewInt(-5), Scale: 3}).Value(); v != "-0.005" || err != nil {
+		t.Errorf("got %v, %v", v, err)
+	}
+	if v, err := (Numeric{Int: big.NewInt(5), Scale: -2}).Value(); v != "500" || err != nil {
+		t.Errorf("got %v, %v", v, err)
+	}
+	if v, err := (Numeric{Inf: 1}).Value(); v != "Infinity" || err != nil {
+		t.Errorf("got %v, %v", v, err)
+	}
+}
+
+func TestDecodeBinaryNumeric(t *testing.T) {
+	for _, tt := range []struct {
+		b    []byte
+		want string
+	}{
+		{numericBytes(0, 0, 0), "0"},
+		{numericBytes(0, 0, 2), "0.00"},
+		{numericBytes(4, 0x4000, 0, 1234, 5678, 9012, 3456, 7890), "-12345678901234567890"},
+		{numericBytes(1, 0, 12, 12, 3456, 7890, 1234, 5678), "123456.789012345678"},
+		// digits past dscale are dropped
+		{numericBytes(0, 0, 1, 1, 2500), "1.2"},
+		{numericBytes(0, 0xd000, 0), "Infinity"},
+	} {
+		if s := decodeBinaryNumeric(tt.b).String(); s != tt.want {
+			t.Errorf("got %s, want %s", s, tt.want)
+		}
+	}
+}
+
+func TestNumericDB(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	const exact = "12345678901234567890.000000000000000001"
+	var n Numeric
+	if err := db.QueryRow("SELECT " + exact + "::numeric").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n.String() != exact {
+		t.Errorf("got %s", n)
+	}
+	// the binary format of a prepared statement
+	in := Numeric{Int: big.NewInt(-123456), Scale: 4}
+	if err := db.QueryRow("SELECT $1::numeric", in).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n.String() != "-12.3456" {
+		t.Errorf("got %s", n)
+	}
+	if err := db.QueryRow("SELECT 'NaN'::numeric").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if !n.NaN {
+		t.Errorf("got %s", n)
+	}
+	if err := db.QueryRow("SELECT NULL::numeric").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Int != nil {
+		t.Errorf("got %s for NULL", n)
+	}
+}
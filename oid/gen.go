@@ -10,10 +10,31 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"sort"
+	"strings"
 
 	_ "github.com/lib/pq"
 )
 
+type pgType struct {
+	name string
+	oid  int
+}
+
+// requiredTypes are the types pq uses, which are added to the table if the
+// server it's generated from doesn't have them, because it's older than the
+// version which introduced them.
+var requiredTypes = []pgType{
+	{"jsonb", 3802},
+	{"_jsonb", 3807},
+}
+
+type byOid []pgType
+
+func (p byOid) Len() int           { return len(p) }
+func (p byOid) Less(i, j int) bool { return p[i].oid < p[j].oid }
+func (p byOid) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
 func main() {
 	datname := os.Getenv("PGDATABASE")
 	sslmode := os.Getenv("PGSSLMODE")
@@ -47,7 +68,7 @@ func main() {
 	}
 	fmt.Fprintln(w, "// generated by 'go run gen.go'; do not edit")
 	fmt.Fprintln(w, "\npackage oid")
-	fmt.Fprintln(w, "const (")
+	var types []pgType
 	rows, err := db.Query(`
 		SELECT typname, oid
 		FROM pg_type WHERE oid < 10000
@@ -56,19 +77,40 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	var name string
-	var oid int
 	for rows.Next() {
-		err = rows.Scan(&name, &oid)
+		var t pgType
+		err = rows.Scan(&t.name, &t.oid)
 		if err != nil {
 			log.Fatal(err)
 		}
-		fmt.Fprintf(w, "T_%s Oid = %d\n", name, oid)
+		types = append(types, t)
 	}
 	if err = rows.Err(); err != nil {
 		log.Fatal(err)
 	}
+	for _, r := range requiredTypes {
+		found := false
+		for _, t := range types {
+			if t.oid == r.oid {
+				found = true
+				break
+			}
+		}
+		if !found {
+			types = append(types, r)
+		}
+	}
+	sort.Sort(byOid(types))
+	fmt.Fprintln(w, "const (")
+	for _, t := range types {
+		fmt.Fprintf(w, "T_%s Oid = %d\n", t.name, t.oid)
+	}
 	fmt.Fprintln(w, ")")
+	fmt.Fprintln(w, "var TypeName = map[Oid]string{")
+	for _, t := range types {
+		fmt.Fprintf(w, "T_%s: \"%s\",\n", t.name, strings.ToUpper(t.name))
+	}
+	fmt.Fprintln(w, "}")
 	w.Close()
 	cmd.Wait()
 }
@@ -0,0 +1,123 @@
+package pq
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// passfileName returns the name of the password file to use for the
+// connection options o: the passfile option (set from PGPASSFILE), or the
+// default password file in the user's home directory.
+func passfileName(o values) string {
+	if name := o.Get("passfile"); name != "" {
+		return name
+	}
+	home := userHomeDir()
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, defaultPassfile)
+}
+
+// passfilePassword looks up the password for the host, port, database and
+// user in o in the password file, and returns "" if there is no usable
+// password file or none of its entries match.
+//
+// See http://www.postgresql.org/docs/current/static/libpq-pgpass.html
+func passfilePassword(o values) string {
+	name := passfileName(o)
+	if name == "" {
+		return ""
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !passfileUsable(fi) {
+		return ""
+	}
+
+	// Like libpq, match connections over the default unix domain socket
+	// directory against localhost; any other socket directory has to be
+	// matched literally.
+	host := o.Get("host")
+	if host == "" || isDefaultSocketDir(host) {
+		host = "localhost"
+	}
+	db := o.Get("dbname")
+	if db == "" {
+		// the server defaults the database name to the user name
+		db = o.Get("user")
+	}
+	return findPassfilePassword(bufio.NewScanner(f), host, o.Get("port"), db, o.Get("user"))
+}
+
+// defaultSocketDirs lists the socket directories libpq is commonly built with:
+// upstream's default and the ones used by distribution packages.
+var defaultSocketDirs = []string{"/tmp", "/var/run/postgresql", "/run/postgresql"}
+
+func isDefaultSocketDir(host string) bool {
+	host = strings.TrimSuffix(host, "/")
+	for _, dir := range defaultSocketDirs {
+		if host == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// findPassfilePassword returns the password of the first entry read by s which
+// matches the given host, port, database and user.
+func findPassfilePassword(s *bufio.Scanner, host, port, db, user string) string {
+	want := [4]string{host, port, db, user}
+	for s.Scan() {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields, wildcard := splitPassfileLine(line)
+		if len(fields) != 5 {
+			continue
+		}
+		match := true
+		for i, w := range want {
+			if !wildcard[i] && fields[i] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return fields[4]
+		}
+	}
+	return ""
+}
+
+// splitPassfileLine splits a line of a password file into its colon-separated
+// fields, removing the backslashes which escape colons and backslashes.  The
+// password field extends to the end of the line.  wildcard reports which of
+// the first four fields consist of an unescaped asterisk.
+func splitPassfileLine(line string) (fields []string, wildcard [4]bool) {
+	var field []byte
+	start := 0
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			i++
+			field = append(field, line[i])
+		case c == ':' && len(fields) < 4:
+			wildcard[len(fields)] = line[start:i] == "*"
+			fields = append(fields, string(field))
+			field = field[:0]
+			start = i + 1
+		default:
+			field = append(field, c)
+		}
+	}
+	return append(fields, string(field)), wildcard
+}
@@ -0,0 +1,153 @@
+package pq
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFindPassfilePassword(t *testing.T) {
+	const passfile = `# comment
+otherhost:5432:db:user:wronghost
+
+localhost:5433:db:user:wrongport
+localhost:5432:*:user:anydb
+*:*:*:other:other\\pass\:word
+host\:with\:colons:5432:db:user:colons
+\*:5432:db:user:literalstar
+localhost:5432:db:*:unreachable
+crlf:5432:db:user:crlf` + "\r\n"
+
+	tests := []struct {
+		host, port, db, user string
+		password             string
+	}{
+		{"localhost", "5432", "db", "user", "anydb"},
+		{"localhost", "5432", "otherdb", "user", "anydb"},
+		{"localhost", "5433", "db", "user", "wrongport"},
+		{"otherhost", "5432", "db", "user", "wronghost"},
+		{"anyhost", "1", "anydb", "other", `other\pass:word`},
+		{"host:with:colons", "5432", "db", "user", "colons"},
+		{"*", "5432", "db", "user", "literalstar"},
+		{"star", "5432", "db", "user", ""},
+		{"localhost", "5432", "db", "nobody", "unreachable"},
+		{"crlf", "5432", "db", "user", "crlf"},
+		{"otherhost", "5432", "db", "nobody", ""},
+	}
+	for _, tt := range tests {
+		s := bufio.NewScanner(strings.NewReader(passfile))
+		pw := findPassfilePassword(s, tt.host, tt.port, tt.db, tt.user)
+		if pw != tt.password {
+			t.Errorf("%s:%s:%s:%s: got password %q, want %q", tt.host, tt.port, tt.db, tt.user, pw, tt.password)
+		}
+	}
+}
+
+func writeTestPassfile(t *testing.T, contents string, perm os.FileMode) string {
+	dir, err := ioutil.TempDir("", "pqgotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "pgpass")
+	if err := ioutil.WriteFile(name, []byte(contents), perm); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	// WriteFile's permissions are subject to the umask
+	if err := os.Chmod(name, perm); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestPassfilePassword(t *testing.T) {
+	name := writeTestPassfile(t, "*:*:*:*:secret\n", 0600)
+	defer os.RemoveAll(filepath.Dir(name))
+
+	o := values{"passfile": name, "user": "pqgotest", "port": "5432"}
+	if pw := passfilePassword(o); pw != "secret" {
+		t.Errorf("got password %q, want %q", pw, "secret")
+	}
+	o["passfile"] = filepath.Join(filepath.Dir(name), "missing")
+	if pw := passfilePassword(o); pw != "" {
+		t.Errorf("got password %q from a missing file", pw)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if err := os.Chmod(name, 0644); err != nil {
+		t.Fatal(err)
+	}
+	o["passfile"] = name
+	if pw := passfilePassword(o); pw != "" {
+		t.Errorf("got password %q from a world-readable file", pw)
+	}
+}
+
+func TestPassfileDefaults(t *testing.T) {
+	// the host defaults to localhost, and the database to the user name
+	name := writeTestPassfile(t, "localhost:5432:pqgotest:pqgotest:defaults\n", 0600)
+	defer os.RemoveAll(filepath.Dir(name))
+
+	o := values{"passfile": name, "user": "pqgotest", "port": "5432"}
+	if pw := passfilePassword(o); pw != "defaults" {
+		t.Errorf("got password %q, want %q", pw, "defaults")
+	}
+	// the default unix domain socket directory is matched as localhost, too
+	o["host"] = "/var/run/postgresql"
+	if pw := passfilePassword(o); pw != "defaults" {
+		t.Errorf("got password %q for a socket directory, want %q", pw, "defaults")
+	}
+}
+
+func TestPassfileSocketDir(t *testing.T) {
+	name := writeTestPassfile(t, "localhost:5432:*:pqgotest:localhost\n"+
+		"/srv/pg/sockets:5432:*:pqgotest:socket\n", 0600)
+	defer os.RemoveAll(filepath.Dir(name))
+
+	// any other socket directory only matches its literal path
+	o := values{"passfile": name, "host": "/srv/pg/sockets", "user": "pqgotest", "port": "5432"}
+	if pw := passfilePassword(o); pw != "socket" {
+		t.Errorf("got password %q, want %q", pw, "socket")
+	}
+	o["host"] = "/srv/pg/other"
+	if pw := passfilePassword(o); pw != "" {
+		t.Errorf("got password %q for an unlisted socket directory, want none", pw)
+	}
+	o["host"] = "/tmp"
+	if pw := passfilePassword(o); pw != "localhost" {
+		t.Errorf("got password %q, want %q", pw, "localhost")
+	}
+}
+
+func TestPassfileAuth(t *testing.T) {
+	name := writeTestPassfile(t, "fakehost:5432:*:pqgotest:secret\n", 0600)
+	defer os.RemoveAll(filepath.Dir(name))
+
+	srv, fd := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.recvStartupPacket()
+		s.sendAuth(3, nil)
+		r := s.expect('p')
+		if pw := r.string(); pw != "secret" {
+			s.fail("got password %q, want %q", pw, "secret")
+		}
+		s.sendAuth(0, nil)
+		s.sendReadyForQuery()
+		s.expect('X')
+	})
+	cn, err := DialOpen(fd, "host=fakehost user=pqgotest sslmode=disable passfile="+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
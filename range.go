@@ -0,0 +1,496 @@
+package pq
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// RangeFlags holds the parts of a range value which are the same for ranges
+// of all types.  They correspond to the functions lower_inc, upper_inc,
+// lower_inf, upper_inf and isempty.
+type RangeFlags struct {
+	// whether the lower and upper bounds are included in the range
+	LowerInc, UpperInc bool
+	// whether the range has no lower or upper bound, in which case the
+	// value of the bound is ignored and it isn't inclusive
+	LowerInf, UpperInf bool
+	// whether the range is empty, in which case it has no bounds and all the
+	// other fields are ignored
+	Empty bool
+}
+
+// rangeText is a range value split into the text of its bounds, which are nil
+// if the range is unbounded on that side or empty.
+type rangeText struct {
+	RangeFlags
+	lower, upper []byte
+}
+
+// parseRange parses src, a range in the text format.
+func parseRange(src []byte) (rangeText, error) {
+	r, i, err := parseRangeAt(src, skipRangeSpace(src, 0))
+	if err != nil {
+		return r, err
+	}
+	if i = skipRangeSpace(src, i); i != len(src) {
+		return r, fmt.Errorf("pq: unable to parse range %q: junk after the upper bound", src)
+	}
+	return r, nil
+}
+
+// parseRangeAt parses the range in the text format which starts at src[i], and
+// returns the index after its end.
+func parseRangeAt(src []byte, i int) (r rangeText, _ int, err error) {
+	invalid := func(msg string) (rangeText, int, error) {
+		return rangeText{}, 0, fmt.Errorf("pq: unable to parse range %q: %s", src, msg)
+	}
+	const empty = "empty"
+	if len(src)-i >= len(empty) && bytes.EqualFold(src[i:i+len(empty)], []byte(empty)) {
+		r.Empty = true
+		return r, i + len(empty), nil
+	}
+	if i == len(src) || (src[i] != '[' && src[i] != '(') {
+		return invalid("expected '[' or '('")
+	}
+	r.LowerInc = src[i] == '['
+	if r.lower, i, err = parseRangeBound(src, i+1); err != nil {
+		return invalid(err.Error())
+	}
+	if i == len(src) || src[i] != ',' {
+		return invalid("expected ','")
+	}
+	if r.upper, i, err = parseRangeBound(src, i+1); err != nil {
+		return invalid(err.Error())
+	}
+	if i == len(src) || (src[i] != ']' && src[i] != ')') {
+		return invalid("expected ']' or ')'")
+	}
+	r.UpperInc = src[i] == ']'
+	r.LowerInf, r.UpperInf = r.lower == nil, r.upper == nil
+	if r.LowerInf {
+		r.LowerInc = false
+	}
+	if r.UpperInf {
+		r.UpperInc = false
+	}
+	return r, i + 1, nil
+}
+
+// parseRangeBound parses the bound of a range which starts at src[i], and
+// returns the index of the delimiter after it.  The bound is nil if it's
+// missing, which means the range is unbounded on that side.
+func parseRangeBound(src []byte, i int) ([]byte, int, error) {
+	var bound []byte
+	quoted := false
+	for ; i < len(src); i++ {
+		c := src[i]
+		if !quoted && (c == ',' || c == ')' || c == ']') {
+			return bound, i, nil
+		}
+		if bound == nil {
+			bound = []byte{}
+		}
+		switch {
+		case c == '\\':
+			i++
+			if i == len(src) {
+				return nil, 0, fmt.Errorf("unexpected end of input")
+			}
+			bound = append(bound, src[i])
+		case c == '"' && quoted && i+1 < len(src) && src[i+1] == '"':
+			bound = append(bound, '"')
+			i++
+		case c == '"':
+			quoted = !quoted
+		default:
+			bound = append(bound, c)
+		}
+	}
+	return nil, 0, fmt.Errorf("unexpected end of input")
+}
+
+func skipRangeSpace(src []byte, i int) int {
+	for i < len(src) && isCompositeSpace(src[i]) {
+		i++
+	}
+	return i
+}
+
+// appendRange appends a range with the flags f and the bounds lower and upper
+// in the text format to b.
+func appendRange(b []byte, f RangeFlags, lower, upper []byte) []byte {
+	if f.Empty {
+		return append(b, "empty"...)
+	}
+	if f.LowerInc && !f.LowerInf {
+		b = append(b, '[')
+	} else {
+		b = append(b, '(')
+	}
+	if !f.LowerInf {
+		b = appendRangeBound(b, lower)
+	}
+	b = append(b, ',')
+	if !f.UpperInf {
+		b = appendRangeBound(b, upper)
+	}
+	if f.UpperInc && !f.UpperInf {
+		return append(b, ']')
+	}
+	return append(b, ')')
+}
+
+// appendRangeBound appends v, quoted if necessary, to b.
+func appendRangeBound(b, v []byte) []byte {
+	quote := len(v) == 0
+	for _, c := range v {
+		switch c {
+		case '"', '\\', ',', '(', ')', '[', ']':
+			quote = true
+		default:
+			quote = quote || isCompositeSpace(c)
+		}
+	}
+	if !quote {
+		return append(b, v...)
+	}
+	b = append(b, '"')
+	for _, c := range v {
+		if c == '"' || c == '\\' {
+			b = append(b, c)
+		}
+		b = append(b, c)
+	}
+	return append(b, '"')
+}
+
+// parseMultirange parses src, a multirange in the text format, into its
+// ranges.
+func parseMultirange(src []byte) ([]rangeText, error) {
+	invalid := func(msg string) ([]rangeText, error) {
+		return nil, fmt.Errorf("pq: unable to parse multirange %q: %s", src, msg)
+	}
+	i := skipRangeSpace(src, 0)
+	if i == len(src) || src[i] != '{' {
+		return invalid("expected '{'")
+	}
+	ranges := []rangeText{}
+	if i = skipRangeSpace(src, i+1); i < len(src) && src[i] == '}' {
+		i++
+	} else {
+		for {
+			r, j, err := parseRangeAt(src, i)
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, r)
+			if i = skipRangeSpace(src, j); i == len(src) {
+				return invalid("unexpected end of input")
+			}
+			i++
+			if src[i-1] == '}' {
+				break
+			} else if src[i-1] != ',' {
+				return invalid("expected ',' or '}'")
+			}
+			i = skipRangeSpace(src, i)
+		}
+	}
+	if skipRangeSpace(src, i) != len(src) {
+		return invalid("junk after '}'")
+	}
+	return ranges, nil
+}
+
+// scanRangeSource returns the text of src, the value of a range being scanned
+// into a value of the type name.
+func scanRangeSource(src interface{}, name string) ([]byte, error) {
+	switch src := src.(type) {
+	case []byte:
+		return src, nil
+	case string:
+		return []byte(src), nil
+	case nil:
+		return nil, fmt.Errorf("pq: cannot convert NULL to %s", name)
+	}
+	return nil, fmt.Errorf("pq: cannot convert %T to %s", src, name)
+}
+
+// Int64Range represents a range of integers, such as an int4range or an
+// int8range.
+type Int64Range struct {
+	Lower, Upper int64
+	RangeFlags
+}
+
+// Scan implements the sql.Scanner interface.
+func (r *Int64Range) Scan(src interface{}) error {
+	b, err := scanRangeSource(src, "Int64Range")
+	if err != nil {
+		return err
+	}
+	rt, err := parseRange(b)
+	if err != nil {
+		return err
+	}
+	return r.set(rt)
+}
+
+func (r *Int64Range) set(rt rangeText) (err error) {
+	*r = Int64Range{RangeFlags: rt.RangeFlags}
+	if rt.lower != nil {
+		if r.Lower, err = strconv.ParseInt(string(rt.lower), 10, 64); err != nil {
+			return fmt.Errorf("pq: parsing lower bound: %v", err)
+		}
+	}
+	if rt.upper != nil {
+		if r.Upper, err = strconv.ParseInt(string(rt.upper), 10, 64); err != nil {
+			return fmt.Errorf("pq: parsing upper bound: %v", err)
+		}
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (r Int64Range) Value() (driver.Value, error) {
+	return string(r.append(nil)), nil
+}
+
+func (r Int64Range) append(b []byte) []byte {
+	return appendRange(b, r.RangeFlags, strconv.AppendInt(nil, r.Lower, 10), strconv.AppendInt(nil, r.Upper, 10))
+}
+
+// Float64Range represents a range of floating point numbers, such as a
+// numrange.
+type Float64Range struct {
+	Lower, Upper float64
+	RangeFlags
+}
+
+// Scan implements the sql.Scanner interface.
+func (r *Float64Range) Scan(src interface{}) error {
+	b, err := scanRangeSource(src, "Float64Range")
+	if err != nil {
+		return err
+	}
+	rt, err := parseRange(b)
+	if err != nil {
+		return err
+	}
+	return r.set(rt)
+}
+
+func (r *Float64Range) set(rt rangeText) (err error) {
+	*r = Float64Range{RangeFlags: rt.RangeFlags}
+	if rt.lower != nil {
+		if r.Lower, err = strconv.ParseFloat(string(rt.lower), 64); err != nil {
+			return fmt.Errorf("pq: parsing lower bound: %v", err)
+		}
+	}
+	if rt.upper != nil {
+		if r.Upper, err = strconv.ParseFloat(string(rt.upper), 64); err != nil {
+			return fmt.Errorf("pq: parsing upper bound: %v", err)
+		}
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (r Float64Range) Value() (driver.Value, error) {
+	return string(r.append(nil)), nil
+}
+
+func (r Float64Range) append(b []byte) []byte {
+	return appendRange(b, r.RangeFlags, strconv.AppendFloat(nil, r.Lower, 'f', -1, 64), strconv.AppendFloat(nil, r.Upper, 'f', -1, 64))
+}
+
+// TimeRange represents a range of times, such as a tsrange, a tstzrange or a
+// daterange.  Bounds without a time zone are in UTC.
+type TimeRange struct {
+	Lower, Upper time.Time
+	RangeFlags
+}
+
+// Scan implements the sql.Scanner interface.
+func (r *TimeRange) Scan(src interface{}) error {
+	b, err := scanRangeSource(src, "TimeRange")
+	if err != nil {
+		return err
+	}
+	rt, err := parseRange(b)
+	if err != nil {
+		return err
+	}
+	return r.set(rt)
+}
+
+func (r *TimeRange) set(rt rangeText) (err error) {
+	*r = TimeRange{RangeFlags: rt.RangeFlags}
+	if rt.lower != nil {
+		if r.Lower, err = parseRangeTime(rt.lower); err != nil {
+			return fmt.Errorf("pq: parsing lower bound: %v", err)
+		}
+	}
+	if rt.upper != nil {
+		if r.Upper, err = parseRangeTime(rt.upper); err != nil {
+			return fmt.Errorf("pq: parsing upper bound: %v", err)
+		}
+	}
+	return nil
+}
+
+// parseRangeTime parses the bound of a range of timestamps or dates, in the
+// text format or as formatted by Value.
+func parseRangeTime(s []byte) (t time.Time, err error) {
+	if t, err := time.Parse(time.RFC3339Nano, string(s)); err == nil {
+		return t, nil
+	}
+	defer errRecoverNoErrBadConn(&err)
+	v := parseTs(nil, string(s))
+	t, ok := v.(time.Time)
+	if !ok {
+		return t, fmt.Errorf("cannot convert %q to time.Time", s)
+	}
+	return t, nil
+}
+
+// Value implements the driver.Valuer interface.
+func (r TimeRange) Value() (driver.Value, error) {
+	return string(r.append(nil)), nil
+}
+
+func (r TimeRange) append(b []byte) []byte {
+	return appendRange(b, r.RangeFlags, formatTs(r.Lower), formatTs(r.Upper))
+}
+
+// Int64Multirange represents a multirange of integers, such as an
+// int4multirange or an int8multirange.
+type Int64Multirange []Int64Range
+
+// Scan implements the sql.Scanner interface.
+func (m *Int64Multirange) Scan(src interface{}) error {
+	if src == nil {
+		*m = nil
+		return nil
+	}
+	b, err := scanRangeSource(src, "Int64Multirange")
+	if err != nil {
+		return err
+	}
+	ranges, err := parseMultirange(b)
+	if err != nil {
+		return err
+	}
+	a := make(Int64Multirange, len(ranges))
+	for i, rt := range ranges {
+		if err := a[i].set(rt); err != nil {
+			return err
+		}
+	}
+	*m = a
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (m Int64Multirange) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b := []byte{'{'}
+	for i, r := range m {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = r.append(b)
+	}
+	return string(append(b, '}')), nil
+}
+
+// Float64Multirange represents a multirange of floating point numbers, such
+// as a nummultirange.
+type Float64Multirange []Float64Range
+
+// Scan implements the sql.Scanner interface.
+func (m *Float64Multirange) Scan(src interface{}) error {
+	if src == nil {
+		*m = nil
+		return nil
+	}
+	b, err := scanRangeSource(src, "Float64Multirange")
+	if err != nil {
+		return err
+	}
+	ranges, err := parseMultirange(b)
+	if err != nil {
+		return err
+	}
+	a := make(Float64Multirange, len(ranges))
+	for i, rt := range ranges {
+		if err := a[i].set(rt); err != nil {
+			return err
+		}
+	}
+	*m = a
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (m Float64Multirange) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b := []byte{'{'}
+	for i, r := range m {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = r.append(b)
+	}
+	return string(append(b, '}')), nil
+}
+
+// TimeMultirange represents a multirange of times, such as a tsmultirange, a
+// tstzmultirange or a datemultirange.
+type TimeMultirange []TimeRange
+
+// Scan implements the sql.Scanner interface.
+func (m *TimeMultirange) Scan(src interface{}) error {
+	if src == nil {
+		*m = nil
+		return nil
+	}
+	b, err := scanRangeSource(src, "TimeMultirange")
+	if err != nil {
+		return err
+	}
+	ranges, err := parseMultirange(b)
+	if err != nil {
+		return err
+	}
+	a := make(TimeMultirange, len(ranges))
+	for i, rt := range ranges {
+		if err := a[i].set(rt); err != nil {
+			return err
+		}
+	}
+	*m = a
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (m TimeMultirange) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b := []byte{'{'}
+	for i, r := range m {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = r.append(b)
+	}
+	return string(append(b, '}')), nil
+}
@@ -0,0 +1,253 @@
+package pq
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	for _, tt := range []struct {
+		input        string
+		lower, upper interface{}
+		flags        RangeFlags
+	}{
+		{`empty`, nil, nil, RangeFlags{Empty: true}},
+		{` EMPTY `, nil, nil, RangeFlags{Empty: true}},
+		{`[1,3)`, "1", "3", RangeFlags{LowerInc: true}},
+		{`(1,3]`, "1", "3", RangeFlags{UpperInc: true}},
+		{`(,3)`, nil, "3", RangeFlags{LowerInf: true}},
+		{`[1,)`, "1", nil, RangeFlags{LowerInc: true, UpperInf: true}},
+		{`(,)`, nil, nil, RangeFlags{LowerInf: true, UpperInf: true}},
+		{`[,]`, nil, nil, RangeFlags{LowerInf: true, UpperInf: true}},
+		{`["2020-01-01 00:00:00","a""b\\c")`, "2020-01-01 00:00:00", `a"b\c`, RangeFlags{LowerInc: true}},
+		{`("",x\,y)`, "", "x,y", RangeFlags{}},
+	} {
+		r, err := parseRange([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		bound := func(b []byte) interface{} {
+			if b == nil {
+				return nil
+			}
+			return string(b)
+		}
+		if bound(r.lower) != tt.lower || bound(r.upper) != tt.upper || r.RangeFlags != tt.flags {
+			t.Errorf("%q: got %q, %q, %+v", tt.input, r.lower, r.upper, r.RangeFlags)
+		}
+	}
+
+	for _, input := range []string{``, `emptyish`, `1,3`, `[1,3`, `[1;3)`, `[1,3) x`, `["1,3)`, `[1,3\`} {
+		if _, err := parseRange([]byte(input)); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestParseMultirange(t *testing.T) {
+	ranges, err := parseMultirange([]byte(`{[1,3), [5,7], empty, (,0)}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranges) != 4 || string(ranges[1].upper) != "7" || !ranges[1].UpperInc || !ranges[2].Empty || !ranges[3].LowerInf {
+		t.Errorf("got %+v", ranges)
+	}
+	if ranges, err := parseMultirange([]byte(` { } `)); err != nil || ranges == nil || len(ranges) != 0 {
+		t.Errorf("got %+v, %v", ranges, err)
+	}
+	for _, input := range []string{``, `[1,3)`, `{[1,3)`, `{[1,3);[5,7)}`, `{[1,3)} x`, `{,}`} {
+		if _, err := parseMultirange([]byte(input)); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestInt64Range(t *testing.T) {
+	var r Int64Range
+	if err := r.Scan([]byte("[-5,10)")); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Int64Range{Lower: -5, Upper: 10, RangeFlags: RangeFlags{LowerInc: true}}); r != want {
+		t.Errorf("got %+v", r)
+	}
+	if err := r.Scan("(,10]"); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Int64Range{Upper: 10, RangeFlags: RangeFlags{LowerInf: true, UpperInc: true}}); r != want {
+		t.Errorf("got %+v", r)
+	}
+	for _, src := range []interface{}{nil, "[a,1)", "[1,b)", 5} {
+		if err := r.Scan(src); err == nil {
+			t.Errorf("%v: expected an error", src)
+		}
+	}
+
+	for _, tt := range []struct {
+		r    Int64Range
+		want string
+	}{
+		{Int64Range{Lower: 1, Upper: 3, RangeFlags: RangeFlags{LowerInc: true}}, "[1,3)"},
+		{Int64Range{Lower: 1, Upper: 3, RangeFlags: RangeFlags{LowerInc: true, LowerInf: true, UpperInc: true}}, "(,3]"},
+		{Int64Range{Lower: -1, RangeFlags: RangeFlags{UpperInf: true}}, "(-1,)"},
+		{Int64Range{Lower: 1, RangeFlags: RangeFlags{Empty: true, LowerInc: true}}, "empty"},
+	} {
+		if v, err := tt.r.Value(); err != nil || v != tt.want {
+			t.Errorf("%+v: got %v, %v, want %s", tt.r, v, err, tt.want)
+		}
+	}
+}
+
+func TestFloat64Range(t *testing.T) {
+	var r Float64Range
+	if err := r.Scan([]byte("[1.5,Infinity]")); err != nil {
+		t.Fatal(err)
+	}
+	if r.Lower != 1.5 || !r.LowerInc || !r.UpperInc || r.Upper < 1e308 {
+		t.Errorf("got %+v", r)
+	}
+	if err := r.Scan("[x,1]"); err == nil {
+		t.Error("expected an error")
+	}
+	v, err := Float64Range{Lower: -0.25, Upper: 1e6, RangeFlags: RangeFlags{LowerInc: true}}.Value()
+	if err != nil || v != "[-0.25,1000000)" {
+		t.Errorf("got %v, %v", v, err)
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	var r TimeRange
+	if err := r.Scan([]byte(`["2020-01-01 10:00:00+02","2021-06-01 00:00:00+02")`)); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Lower.Equal(time.Date(2020, 1, 1, 8, 0, 0, 0, time.UTC)) || !r.Upper.Equal(time.Date(2021, 5, 31, 22, 0, 0, 0, time.UTC)) ||
+		!r.LowerInc || r.UpperInc {
+		t.Errorf("got %+v", r)
+	}
+	if err := r.Scan("[2020-01-01,)"); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Lower.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) || !r.UpperInf {
+		t.Errorf("got %+v", r)
+	}
+	if err := r.Scan("[2020-01-01,infinity)"); err == nil {
+		t.Error("expected an error for an infinite timestamp")
+	}
+
+	v, err := TimeRange{
+		Lower:      time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		RangeFlags: RangeFlags{LowerInc: true, UpperInf: true},
+	}.Value()
+	if err != nil || v != "[2020-01-01T00:00:00Z,)" {
+		t.Errorf("got %v, %v", v, err)
+	}
+	var back TimeRange
+	if err := back.Scan(v); err != nil {
+		t.Fatal(err)
+	}
+	if !back.Lower.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) || !back.LowerInc || !back.UpperInf {
+		t.Errorf("round trip: got %+v", back)
+	}
+}
+
+func TestMultirange(t *testing.T) {
+	var m Int64Multirange
+	if err := m.Scan([]byte("{[1,3),[5,7)}")); err != nil {
+		t.Fatal(err)
+	}
+	want := Int64Multirange{
+		{Lower: 1, Upper: 3, RangeFlags: RangeFlags{LowerInc: true}},
+		{Lower: 5, Upper: 7, RangeFlags: RangeFlags{LowerInc: true}},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %+v", m)
+	}
+	if v, err := m.Value(); err != nil || v != "{[1,3),[5,7)}" {
+		t.Errorf("got %v, %v", v, err)
+	}
+	if err := m.Scan(nil); err != nil || m != nil {
+		t.Errorf("got %v, %v for NULL", m, err)
+	}
+	if v, err := m.Value(); err != nil || v != nil {
+		t.Errorf("got %v, %v for NULL", v, err)
+	}
+	if v, err := (Int64Multirange{}).Value(); err != nil || v != "{}" {
+		t.Errorf("got %v, %v", v, err)
+	}
+	if err := m.Scan("{[1,x)}"); err == nil {
+		t.Error("expected an error")
+	}
+
+	var fm Float64Multirange
+	if err := fm.Scan("{[0.5,1.5]}"); err != nil || len(fm) != 1 || fm[0].Upper != 1.5 {
+		t.Errorf("got %+v, %v", fm, err)
+	}
+	var tm TimeMultirange
+	if err := tm.Scan("{[2020-01-01,2020-02-01),[2020-03-01,2020-04-01)}"); err != nil || len(tm) != 2 ||
+		tm[1].Lower.Month() != time.March {
+		t.Errorf("got %+v, %v", tm, err)
+	}
+}
+
+func TestRangeDB(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	var ir Int64Range
+	if err := db.QueryRow("SELECT int8range(1, 10, '(]')").Scan(&ir); err != nil {
+		t.Fatal(err)
+	}
+	// canonicalized by the server
+	if want := (Int64Range{Lower: 2, Upper: 11, RangeFlags: RangeFlags{LowerInc: true}}); ir != want {
+		t.Errorf("got %+v", ir)
+	}
+	var empty bool
+	if err := db.QueryRow("SELECT isempty($1::int4range)", Int64Range{Lower: 1, Upper: 1}).Scan(&empty); err != nil {
+		t.Fatal(err)
+	}
+	if !empty {
+		t.Error("expected an empty range")
+	}
+
+	var fr Float64Range
+	in := Float64Range{Lower: 1.25, RangeFlags: RangeFlags{LowerInc: true, UpperInf: true}}
+	if err := db.QueryRow("SELECT $1::numrange", in).Scan(&fr); err != nil {
+		t.Fatal(err)
+	}
+	if fr != in {
+		t.Errorf("got %+v", fr)
+	}
+
+	var tr TimeRange
+	lower := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := db.QueryRow("SELECT tstzrange($1, $2)", lower, lower.Add(time.Hour)).Scan(&tr); err != nil {
+		t.Fatal(err)
+	}
+	if !tr.Lower.Equal(lower) || !tr.Upper.Equal(lower.Add(time.Hour)) || !tr.LowerInc || tr.UpperInc {
+		t.Errorf("got %+v", tr)
+	}
+	if err := db.QueryRow("SELECT '[2020-01-01,2020-02-01)'::daterange").Scan(&tr); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Upper.Month() != time.February {
+		t.Errorf("got %+v", tr)
+	}
+
+	if getServerVersion(t, db) < 140000 {
+		t.Skip("multiranges require PostgreSQL 14")
+	}
+	var m Int64Multirange
+	if err := db.QueryRow("SELECT $1::int4multirange", Int64Multirange{
+		{Lower: 5, Upper: 7, RangeFlags: RangeFlags{LowerInc: true}},
+		{Lower: 1, Upper: 3, RangeFlags: RangeFlags{LowerInc: true, UpperInc: true}},
+	}).Scan(&m); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Int64Multirange{
+		{Lower: 1, Upper: 4, RangeFlags: RangeFlags{LowerInc: true}},
+		{Lower: 5, Upper: 7, RangeFlags: RangeFlags{LowerInc: true}},
+	}); !reflect.DeepEqual(m, want) {
+		t.Errorf("got %+v", m)
+	}
+}
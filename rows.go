@@ -0,0 +1,152 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/lib/pq/oid"
+)
+
+// fieldDesc holds the parts of the description of a result column, as sent in
+// RowDescription, which are not needed to decode its values.
+type fieldDesc struct {
+	// the OID of the table the column was taken from, and the column's
+	// attribute number in it, or zero if it's not a column of a table
+	table  oid.Oid
+	attnum int
+	// the size of the column's type, negative for variable-width types
+	typlen int
+	// the type modifier of the column, such as the length of a varchar, or -1
+	typmod int
+}
+
+// parse reads a field description from r, which must be positioned after the
+// name of the column, and returns the column's type.  The format code which
+// follows is left in r.
+func (fd *fieldDesc) parse(r *readBuf) oid.Oid {
+	fd.table = r.oid()
+	fd.attnum = int(int16(r.int16()))
+	typ := r.oid()
+	fd.typlen = int(int16(r.int16()))
+	fd.typmod = r.int32()
+	return typ
+}
+
+// The size of the length header of variable-width values, which is included
+// in the type modifiers of types such as varchar and numeric.
+const varHeaderSize = 4
+
+var (
+	scanTypeBool    = reflect.TypeOf(false)
+	scanTypeBytes   = reflect.TypeOf([]byte(nil))
+	scanTypeFloat64 = reflect.TypeOf(float64(0))
+	scanTypeInt64   = reflect.TypeOf(int64(0))
+	scanTypeString  = reflect.TypeOf("")
+	scanTypeTime    = reflect.TypeOf(time.Time{})
+)
+
+// ColumnTypeScanType returns the type of the values Next returns for the
+// column index, or string for text types.
+func (rs *rows) ColumnTypeScanType(index int) reflect.Type {
+	switch rs.rowTyps[index] {
+	case oid.T_bool:
+		return scanTypeBool
+	case oid.T_int8, oid.T_int4, oid.T_int2:
+		return scanTypeInt64
+	case oid.T_float4, oid.T_float8:
+		return scanTypeFloat64
+	case oid.T_timestamptz, oid.T_timestamp, oid.T_date, oid.T_time, oid.T_timetz:
+		return scanTypeTime
+	case oid.T_text, oid.T_varchar, oid.T_bpchar, oid.T_char, oid.T_name:
+		return scanTypeString
+	}
+	return scanTypeBytes
+}
+
+// ColumnTypeDatabaseTypeName returns the upper-case name of the type of the
+// column index, such as "INT4" or "_TEXT" for arrays of text, or "" if the
+// type isn't a built-in type.
+func (rs *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return oid.TypeName[rs.rowTyps[index]]
+}
+
+// ColumnTypeLength returns the maximum length of the values of the column
+// index, in characters or bytes, if it is of a variable-length character or
+// binary type.  Columns without a limit, such as text columns, report
+// math.MaxInt64.
+func (rs *rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	switch rs.rowTyps[index] {
+	case oid.T_varchar, oid.T_bpchar:
+		if mod := rs.fields[index].typmod; mod != -1 {
+			return int64(mod - varHeaderSize), true
+		}
+		return math.MaxInt64, true
+	case oid.T_text, oid.T_bytea:
+		return math.MaxInt64, true
+	}
+	return 0, false
+}
+
+// ColumnTypePrecisionScale returns the precision and scale of the column
+// index, if it is a numeric column declared with them.
+func (rs *rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	if rs.rowTyps[index] != oid.T_numeric {
+		return 0, 0, false
+	}
+	mod := rs.fields[index].typmod
+	if mod == -1 {
+		return 0, 0, false
+	}
+	mod -= varHeaderSize
+	return int64(mod >> 16 & 0xffff), int64(mod & 0xffff), true
+}
+
+// ColumnTypeNullable always reports that it's unknown whether the column index
+// can be null, as the server doesn't say; ColumnTable can be used to look it
+// up in pg_attribute for columns of tables.
+func (rs *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return false, false
+}
+
+// ColumnTable returns the OID of the table a column of r, a driver.Rows
+// returned by a pq connection, was taken from, and the attribute number of
+// the column in that table.  They are zero if the column is not a plain
+// column of a table, for instance if it's computed by an expression.
+//
+// The rows of a *sql.Rows aren't accessible, but a connection obtained from a
+// *sql.DB with sql.Conn.Raw can be queried directly:
+//
+//	err := conn.Raw(func(driverConn interface{}) error {
+//		rows, err := driverConn.(driver.Queryer).Query("SELECT * FROM t", nil)
+//		if err != nil {
+//			return err
+//		}
+//		defer rows.Close()
+//		table, attnum, err := pq.ColumnTable(rows, 0)
+//		...
+//	})
+func ColumnTable(r driver.Rows, index int) (table oid.Oid, attnum int, err error) {
+	rs, ok := r.(*rows)
+	if !ok {
+		return 0, 0, fmt.Errorf("pq: ColumnTable called with rows of type %T", r)
+	}
+	if index < 0 || index >= len(rs.fields) {
+		return 0, 0, fmt.Errorf("pq: column index %d out of range [0, %d)", index, len(rs.fields))
+	}
+	fd := rs.fields[index]
+	return fd.table, fd.attnum, nil
+}
+
+// CommandTag returns the command tag of the current result set of r, a
+// driver.Rows returned by a pq connection, such as "SELECT 5".  The tag is
+// empty until all the rows of the result set have been read.
+func CommandTag(r driver.Rows) (string, error) {
+	rs, ok := r.(*rows)
+	if !ok {
+		return "", fmt.Errorf("pq: CommandTag called with rows of type %T", r)
+	}
+	return rs.tag, nil
+}
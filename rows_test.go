@@ -0,0 +1,222 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/lib/pq/oid"
+)
+
+func TestRowsColumnTypes(t *testing.T) {
+	const q = "SELECT id, name, code, price, note, id + 1 FROM t"
+	cols := []struct {
+		name   string
+		table  int
+		attnum int
+		typ    oid.Oid
+		typlen int
+		typmod int
+	}{
+		{"id", 16384, 1, oid.T_int4, 4, -1},
+		{"name", 16384, 2, oid.T_varchar, -1, 40 + varHeaderSize},
+		{"code", 16384, 3, oid.T_bpchar, -1, 3 + varHeaderSize},
+		{"price", 16384, 4, oid.T_numeric, -1, 10<<16 | 2 + varHeaderSize},
+		{"note", 16384, 5, oid.T_text, -1, -1},
+		{"?column?", 0, 0, oid.T_int4, 4, -1},
+	}
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		s.expectQuery(q)
+		w := newFakeMessage('T')
+		w.int16(len(cols))
+		for _, col := range cols {
+			w.string(col.name)
+			w.int32(col.table)
+			w.int16(col.attnum)
+			w.int32(int(col.typ))
+			w.int16(col.typlen)
+			w.int32(col.typmod)
+			w.int16(0)
+		}
+		s.send(w)
+		s.sendDataRow([]byte("1"), []byte("a"), []byte("abc"), []byte("1.50"), nil, []byte("2"))
+		s.sendCommandComplete("SELECT 1")
+		s.sendReadyForQuery()
+		s.expect('X')
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cn.(driver.Queryer).Query(q, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := r.(*rows)
+
+	tests := []struct {
+		typeName  string
+		scanType  reflect.Type
+		length    int64
+		lengthOK  bool
+		precision int64
+		scale     int64
+		decimalOK bool
+	}{
+		{"INT4", scanTypeInt64, 0, false, 0, 0, false},
+		{"VARCHAR", scanTypeString, 40, true, 0, 0, false},
+		{"BPCHAR", scanTypeString, 3, true, 0, 0, false},
+		{"NUMERIC", scanTypeBytes, 0, false, 10, 2, true},
+		{"TEXT", scanTypeString, math.MaxInt64, true, 0, 0, false},
+		{"INT4", scanTypeInt64, 0, false, 0, 0, false},
+	}
+	for i, tt := range tests {
+		if name := rs.ColumnTypeDatabaseTypeName(i); name != tt.typeName {
+			t.Errorf("column %d: got type name %q, want %q", i, name, tt.typeName)
+		}
+		if typ := rs.ColumnTypeScanType(i); typ != tt.scanType {
+			t.Errorf("column %d: got scan type %v, want %v", i, typ, tt.scanType)
+		}
+		if length, ok := rs.ColumnTypeLength(i); length != tt.length || ok != tt.lengthOK {
+			t.Errorf("column %d: got length %d, %v", i, length, ok)
+		}
+		if p, s, ok := rs.ColumnTypePrecisionScale(i); p != tt.precision || s != tt.scale || ok != tt.decimalOK {
+			t.Errorf("column %d: got precision and scale %d, %d, %v", i, p, s, ok)
+		}
+		if _, ok := rs.ColumnTypeNullable(i); ok {
+			t.Errorf("column %d: nullability reported as known", i)
+		}
+		table, attnum, err := ColumnTable(r, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(table) != cols[i].table || attnum != cols[i].attnum {
+			t.Errorf("column %d: got table %d and attribute %d", i, table, attnum)
+		}
+	}
+	if _, _, err := ColumnTable(r, len(cols)); err == nil {
+		t.Error("expected an error for an out of range column")
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRowsNextResultSet(t *testing.T) {
+	const q = "SELECT 1; INSERT INTO t VALUES (1); SELECT 'a', 'b' WHERE false; SELECT 2"
+	script := func(s *fakeServer) {
+		s.expectQuery(q)
+		s.sendRowDescription([]string{"a"}, []oid.Oid{oid.T_int4})
+		s.sendDataRow([]byte("1"))
+		s.sendCommandComplete("SELECT 1")
+		s.sendCommandComplete("INSERT 0 1")
+		s.sendRowDescription([]string{"x", "y"}, []oid.Oid{oid.T_text, oid.T_text})
+		s.sendCommandComplete("SELECT 0")
+		s.sendRowDescription([]string{"z"}, []oid.Oid{oid.T_int4})
+		s.sendDataRow([]byte("2"))
+		s.sendCommandComplete("SELECT 1")
+		s.sendReadyForQuery()
+	}
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		script(s)
+		// closed without reading the later result sets
+		script(s)
+		s.expectQuery("SELECT 1")
+		s.sendCommandComplete("SELECT 1")
+		s.sendReadyForQuery()
+		s.expect('X')
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cn.(driver.Queryer).Query(q, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := r.(*rows)
+
+	want := []struct {
+		cols []string
+		rows []driver.Value
+		tag  string
+	}{
+		{[]string{"a"}, []driver.Value{int64(1)}, "SELECT 1"},
+		{[]string{"x", "y"}, nil, "SELECT 0"},
+		{[]string{"z"}, []driver.Value{int64(2)}, "SELECT 1"},
+	}
+	for i, w := range want {
+		if i > 0 {
+			if !rs.HasNextResultSet() {
+				t.Fatalf("result set %d: no next result set", i)
+			}
+			if err := rs.NextResultSet(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if cols := rs.Columns(); !reflect.DeepEqual(cols, w.cols) {
+			t.Errorf("result set %d: got columns %v, want %v", i, cols, w.cols)
+		}
+		var got []driver.Value
+		dest := make([]driver.Value, len(w.cols))
+		for {
+			err := rs.Next(dest)
+			if err != nil {
+				if err != io.EOF {
+					t.Fatal(err)
+				}
+				break
+			}
+			got = append(got, dest[0])
+		}
+		if !reflect.DeepEqual(got, w.rows) {
+			t.Errorf("result set %d: got rows %v, want %v", i, got, w.rows)
+		}
+		if tag, _ := CommandTag(r); tag != w.tag {
+			t.Errorf("result set %d: got command tag %q, want %q", i, tag, w.tag)
+		}
+	}
+	if rs.HasNextResultSet() {
+		t.Error("unexpected next result set")
+	}
+	if err := rs.NextResultSet(); err != io.EOF {
+		t.Errorf("got %v after the last result set, want io.EOF", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = cn.(driver.Queryer).Query(q, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// a query which doesn't return rows still has a command tag
+	r, err = cn.(driver.Queryer).Query("SELECT 1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag, _ := CommandTag(r); tag != "SELECT 1" {
+		t.Errorf("got command tag %q", tag)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,241 @@
+// Package scram implements the client side of the Salted Challenge Response
+// Authentication Mechanism (SCRAM) as described in RFC 5802 and RFC 7677.
+//
+// It is used by pq for PostgreSQL's SCRAM-SHA-256 and SCRAM-SHA-256-PLUS SASL
+// authentication methods, but does not depend on anything PostgreSQL-specific.
+package scram
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// Client drives the client side of a single SCRAM conversation.  A Client is
+// not safe for concurrent use, and can not be reused once the conversation
+// has finished.
+//
+// A typical conversation looks like this:
+//
+//	c := scram.NewClient(sha256.New, user, password)
+//	var in []byte
+//	for c.Step(in) {
+//		// send c.Out() to the server, and read its response into in
+//	}
+//	if c.Err() != nil {
+//		// authentication failed
+//	}
+type Client struct {
+	newHash func() hash.Hash
+
+	user string
+	pass string
+	step int
+	out  bytes.Buffer
+	err  error
+
+	gs2Header string
+	cbindData []byte
+
+	clientNonce     []byte
+	clientFirstBare string
+	serverSignature []byte
+}
+
+// NewClient returns a new SCRAM client using the hash function newHash (e.g.
+// sha256.New for SCRAM-SHA-256) to authenticate user with password pass.
+func NewClient(newHash func() hash.Hash, user, pass string) *Client {
+	return &Client{
+		newHash:   newHash,
+		user:      user,
+		pass:      pass,
+		gs2Header: "n,,",
+	}
+}
+
+// SetChannelBinding makes the client request channel binding of type cbType
+// (e.g. "tls-server-end-point"), binding the conversation to data.  It must
+// be called before the first call to Step.
+func (c *Client) SetChannelBinding(cbType string, data []byte) {
+	c.gs2Header = "p=" + cbType + ",,"
+	c.cbindData = data
+}
+
+// SetChannelBindingSupported tells the server that the client supports
+// channel binding, but believes that the server does not.  This allows the
+// server to detect a downgrade attack.  It must be called before the first
+// call to Step.
+func (c *Client) SetChannelBindingSupported() {
+	c.gs2Header = "y,,"
+	c.cbindData = nil
+}
+
+// Out returns the data to be sent to the server in the current step.
+func (c *Client) Out() []byte {
+	if c.out.Len() == 0 {
+		return nil
+	}
+	return c.out.Bytes()
+}
+
+// Err returns the error that occurred, or nil if there were no errors.
+func (c *Client) Err() error {
+	return c.err
+}
+
+// Step processes the incoming data from the server and makes the next round
+// of data for the server available via Out.  The first call must pass nil,
+// since the client speaks first.  Step returns false once the conversation is
+// over, either successfully or because an error occurred; Err reports which.
+func (c *Client) Step(in []byte) bool {
+	c.out.Reset()
+	if c.step > 2 || c.err != nil {
+		return false
+	}
+	c.step++
+	switch c.step {
+	case 1:
+		c.err = c.step1(in)
+	case 2:
+		c.err = c.step2(in)
+	case 3:
+		c.err = c.step3(in)
+	}
+	return c.step <= 2 && c.err == nil
+}
+
+func (c *Client) step1(in []byte) error {
+	if len(c.clientNonce) == 0 {
+		const nonceLen = 18
+		buf := make([]byte, nonceLen)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		c.clientNonce = make([]byte, base64.StdEncoding.EncodedLen(nonceLen))
+		base64.StdEncoding.Encode(c.clientNonce, buf)
+	}
+
+	c.clientFirstBare = "n=" + escapeName(c.user) + ",r=" + string(c.clientNonce)
+	c.out.WriteString(c.gs2Header)
+	c.out.WriteString(c.clientFirstBare)
+	return nil
+}
+
+func (c *Client) step2(in []byte) error {
+	fields := strings.Split(string(in), ",")
+	if len(fields) < 3 {
+		return fmt.Errorf("expected at least 3 fields in first SCRAM server message, got %d: %q", len(fields), in)
+	}
+	if !strings.HasPrefix(fields[0], "r=") || len(fields[0]) < 2 {
+		return fmt.Errorf("server sent an invalid SCRAM nonce: %q", fields[0])
+	}
+	if !strings.HasPrefix(fields[1], "s=") || len(fields[1]) < 6 {
+		return fmt.Errorf("server sent an invalid SCRAM salt: %q", fields[1])
+	}
+	if !strings.HasPrefix(fields[2], "i=") || len(fields[2]) < 6 {
+		return fmt.Errorf("server sent an invalid SCRAM iteration count: %q", fields[2])
+	}
+
+	nonce := fields[0][2:]
+	if !strings.HasPrefix(nonce, string(c.clientNonce)) {
+		return fmt.Errorf("server SCRAM nonce is not prefixed by client nonce: got %q, want %q+\"...\"", nonce, c.clientNonce)
+	}
+	salt, err := base64.StdEncoding.DecodeString(fields[1][2:])
+	if err != nil {
+		return fmt.Errorf("cannot decode SCRAM salt sent by server: %q", fields[1])
+	}
+	iterCount, err := strconv.Atoi(fields[2][2:])
+	if err != nil || iterCount <= 0 {
+		return fmt.Errorf("server sent an invalid SCRAM iteration count: %q", fields[2])
+	}
+
+	cbind := base64.StdEncoding.EncodeToString(append([]byte(c.gs2Header), c.cbindData...))
+	clientFinalWithoutProof := "c=" + cbind + ",r=" + nonce
+	authMsg := []byte(c.clientFirstBare + "," + string(in) + "," + clientFinalWithoutProof)
+
+	saltedPass := c.saltPassword(salt, iterCount)
+	clientKey := c.hmac(saltedPass, []byte("Client Key"))
+	storedKey := c.h(clientKey)
+	clientSignature := c.hmac(storedKey, authMsg)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	serverKey := c.hmac(saltedPass, []byte("Server Key"))
+	c.serverSignature = c.hmac(serverKey, authMsg)
+
+	c.out.WriteString(clientFinalWithoutProof)
+	c.out.WriteString(",p=")
+	c.out.WriteString(base64.StdEncoding.EncodeToString(proof))
+	return nil
+}
+
+func (c *Client) step3(in []byte) error {
+	var isv, ise bool
+	fields := bytes.Split(in, []byte(","))
+	if len(fields) > 0 {
+		isv = bytes.HasPrefix(fields[0], []byte("v="))
+		ise = bytes.HasPrefix(fields[0], []byte("e="))
+	}
+	if ise {
+		return fmt.Errorf("SCRAM authentication error: %s", fields[0][2:])
+	} else if !isv {
+		return fmt.Errorf("unsupported SCRAM final message from server: %q", in)
+	}
+	signature, err := base64.StdEncoding.DecodeString(string(fields[0][2:]))
+	if err != nil {
+		return fmt.Errorf("cannot decode SCRAM server signature: %q", fields[0])
+	}
+	if !hmac.Equal(signature, c.serverSignature) {
+		return errors.New("cannot authenticate SCRAM server signature")
+	}
+	return nil
+}
+
+// saltPassword implements the Hi() function of RFC 5802, which is PBKDF2
+// with HMAC as the pseudorandom function and an output length equal to the
+// hash size.
+func (c *Client) saltPassword(salt []byte, iterCount int) []byte {
+	mac := hmac.New(c.newHash, []byte(c.pass))
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	ui := mac.Sum(nil)
+	hi := make([]byte, len(ui))
+	copy(hi, ui)
+	for i := 1; i < iterCount; i++ {
+		mac.Reset()
+		mac.Write(ui)
+		mac.Sum(ui[:0])
+		for j, b := range ui {
+			hi[j] ^= b
+		}
+	}
+	return hi
+}
+
+func (c *Client) h(b []byte) []byte {
+	h := c.newHash()
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+func (c *Client) hmac(key, msg []byte) []byte {
+	mac := hmac.New(c.newHash, key)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+// escapeName encodes the characters ',' and '=' in a user name as required by
+// the saslname production of RFC 5802.
+func escapeName(name string) string {
+	if strings.IndexAny(name, ",=") < 0 {
+		return name
+	}
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
@@ -0,0 +1,128 @@
+package scram
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+// The example conversation from RFC 7677, section 3.
+const (
+	rfcClientNonce = "rOprNGfwEbeRWgbNEkqO"
+	rfcServerFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	rfcClientFinal = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	rfcServerFinal = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+)
+
+func newRFCClient() *Client {
+	c := NewClient(sha256.New, "user", "pencil")
+	c.clientNonce = []byte(rfcClientNonce)
+	return c
+}
+
+func TestClientConversation(t *testing.T) {
+	c := newRFCClient()
+
+	if !c.Step(nil) {
+		t.Fatalf("unexpected end of conversation: %v", c.Err())
+	}
+	if got, want := string(c.Out()), "n,,n=user,r="+rfcClientNonce; got != want {
+		t.Fatalf("client-first: got %q, want %q", got, want)
+	}
+
+	if !c.Step([]byte(rfcServerFirst)) {
+		t.Fatalf("unexpected end of conversation: %v", c.Err())
+	}
+	if got := string(c.Out()); got != rfcClientFinal {
+		t.Fatalf("client-final: got %q, want %q", got, rfcClientFinal)
+	}
+
+	if c.Step([]byte(rfcServerFinal)) {
+		t.Fatal("expected the conversation to be over")
+	}
+	if c.Err() != nil {
+		t.Fatal(c.Err())
+	}
+	if c.Out() != nil {
+		t.Fatalf("unexpected output %q", c.Out())
+	}
+}
+
+func TestClientBadServerSignature(t *testing.T) {
+	c := newRFCClient()
+	c.Step(nil)
+	c.Step([]byte(rfcServerFirst))
+	if c.Step([]byte("v=AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")) {
+		t.Fatal("expected the conversation to be over")
+	}
+	if c.Err() == nil {
+		t.Fatal("expected an error for a forged server signature")
+	}
+}
+
+func TestClientServerError(t *testing.T) {
+	c := newRFCClient()
+	c.Step(nil)
+	c.Step([]byte(rfcServerFirst))
+	c.Step([]byte("e=invalid-proof"))
+	if c.Err() == nil || !strings.Contains(c.Err().Error(), "invalid-proof") {
+		t.Fatalf("expected invalid-proof error, got %v", c.Err())
+	}
+}
+
+func TestClientBadServerFirst(t *testing.T) {
+	tests := []string{
+		"",
+		"r=rOprNGfwEbeRWgbNEkqO",
+		"r=someoneelsesnonce,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=!!!!!!,i=4096",
+		"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=zero",
+		"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=-4096",
+	}
+	for _, in := range tests {
+		c := newRFCClient()
+		c.Step(nil)
+		if c.Step([]byte(in)) || c.Err() == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestClientChannelBinding(t *testing.T) {
+	c := newRFCClient()
+	c.SetChannelBinding("tls-server-end-point", []byte("xyz"))
+	c.Step(nil)
+	if got, want := string(c.Out()), "p=tls-server-end-point,,n=user,r="+rfcClientNonce; got != want {
+		t.Fatalf("client-first: got %q, want %q", got, want)
+	}
+	c.Step([]byte(rfcServerFirst))
+	// base64("p=tls-server-end-point,,xyz")
+	if got, want := string(c.Out()), "c=cD10bHMtc2VydmVyLWVuZC1wb2ludCwseHl6,"; !strings.HasPrefix(got, want) {
+		t.Fatalf("client-final: got %q, want prefix %q", got, want)
+	}
+
+	c = newRFCClient()
+	c.SetChannelBindingSupported()
+	c.Step(nil)
+	c.Step([]byte(rfcServerFirst))
+	// base64("y,,")
+	if got, want := string(c.Out()), "c=eSws,"; !strings.HasPrefix(got, want) {
+		t.Fatalf("client-final: got %q, want prefix %q", got, want)
+	}
+}
+
+func TestEscapeName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"user", "user"},
+		{"a=b", "a=3Db"},
+		{"a,b", "a=2Cb"},
+		{"=,", "=3D=2C"},
+	}
+	for _, tt := range tests {
+		if got := escapeName(tt.in); got != tt.want {
+			t.Errorf("escapeName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package pq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// serviceOptions returns the connection parameters of the named service,
+// looked up as libpq does: in the service file given by the servicefile
+// option (set from PGSERVICEFILE), or else in ~/.pg_service.conf, falling back
+// to pg_service.conf in the directory named by PGSYSCONFDIR if the service
+// isn't defined there.
+//
+// See http://www.postgresql.org/docs/current/static/libpq-pgservice.html
+func serviceOptions(service string, o values) (values, error) {
+	var files []string
+	if name := o.Get("servicefile"); name != "" {
+		// unlike the default service file, a named one has to exist
+		if _, err := os.Stat(name); err != nil {
+			return nil, fmt.Errorf("pq: service file %q not found", name)
+		}
+		files = append(files, name)
+	} else if home := userHomeDir(); home != "" {
+		files = append(files, filepath.Join(home, ".pg_service.conf"))
+	}
+	if dir := os.Getenv("PGSYSCONFDIR"); dir != "" {
+		files = append(files, filepath.Join(dir, "pg_service.conf"))
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		opts, err := findService(f, name, service)
+		f.Close()
+		if opts != nil || err != nil {
+			return opts, err
+		}
+	}
+	return nil, fmt.Errorf("pq: definition of service %q not found", service)
+}
+
+// findService reads the INI-style service file called name from r, and returns
+// the parameters in its section for service, or nil if there is no such
+// section.
+func findService(r io.Reader, name, service string) (values, error) {
+	var opts values
+	s := bufio.NewScanner(r)
+	for lineno := 1; s.Scan(); lineno++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			if opts != nil {
+				// the end of the service's section
+				break
+			}
+			if strings.HasSuffix(line, "]") && line[1:len(line)-1] == service {
+				opts = make(values)
+			}
+			continue
+		}
+		if opts == nil {
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("pq: syntax error in service file %q, line %d", name, lineno)
+		}
+		key := strings.TrimSpace(line[:i])
+		if key == "service" {
+			return nil, fmt.Errorf("pq: nested service specifications not supported in service file %q, line %d", name, lineno)
+		}
+		opts.Set(key, strings.TrimSpace(line[i+1:]))
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
@@ -0,0 +1,196 @@
+package pq
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testServiceFile = `# services for the tests
+[other]
+host=otherhost
+
+[pqgotest]
+host = fakehost
+  dbname=servicedb
+application_name=service app
+options=-c search_path=a,b
+
+[last]
+user=lastuser
+`
+
+// setTestEnv sets the environment variable key to value, and returns a
+// function which restores its previous state.
+func setTestEnv(key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestFindService(t *testing.T) {
+	tests := []struct {
+		service string
+		opts    values
+	}{
+		{"other", values{"host": "otherhost"}},
+		{"pqgotest", values{
+			"host":             "fakehost",
+			"dbname":           "servicedb",
+			"application_name": "service app",
+			"options":          "-c search_path=a,b",
+		}},
+		{"last", values{"user": "lastuser"}},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		opts, err := findService(strings.NewReader(testServiceFile), "test", tt.service)
+		if err != nil {
+			t.Errorf("%s: %v", tt.service, err)
+			continue
+		}
+		if !reflect.DeepEqual(opts, tt.opts) {
+			t.Errorf("%s: got %v, want %v", tt.service, opts, tt.opts)
+		}
+	}
+}
+
+func TestFindServiceErrors(t *testing.T) {
+	tests := []struct {
+		file string
+		err  string
+	}{
+		{"[s]\nhost\n", `pq: syntax error in service file "test", line 2`},
+		{"[s]\nservice=t\n", `pq: nested service specifications not supported in service file "test", line 2`},
+	}
+	for _, tt := range tests {
+		_, err := findService(strings.NewReader(tt.file), "test", "s")
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%q: got error %v, want %s", tt.file, err, tt.err)
+		}
+	}
+	// errors in the sections of other services don't matter
+	if _, err := findService(strings.NewReader("[t]\nhost\n[s]\n"), "test", "s"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServiceOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pqgotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "pg_service.conf")
+	if err := ioutil.WriteFile(name, []byte(testServiceFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := serviceOptions("last", values{"servicefile": name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (values{"user": "lastuser"}); !reflect.DeepEqual(opts, want) {
+		t.Errorf("got %v, want %v", opts, want)
+	}
+	_, err = serviceOptions("missing", values{"servicefile": name})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	_, err = serviceOptions("last", values{"servicefile": filepath.Join(dir, "missing")})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	// PGSYSCONFDIR is searched after the user's service file
+	defer setTestEnv("PGSYSCONFDIR", dir)()
+	opts, err = serviceOptions("other", values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (values{"host": "otherhost"}); !reflect.DeepEqual(opts, want) {
+		t.Errorf("got %v, want %v", opts, want)
+	}
+
+	// and after the service file named by servicefile, too
+	userFile := filepath.Join(dir, "user.conf")
+	if err := ioutil.WriteFile(userFile, []byte("[other]\nuser=useruser\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts, err = serviceOptions("other", values{"servicefile": userFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (values{"user": "useruser"}); !reflect.DeepEqual(opts, want) {
+		t.Errorf("got %v, want %v", opts, want)
+	}
+	opts, err = serviceOptions("last", values{"servicefile": userFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (values{"user": "lastuser"}); !reflect.DeepEqual(opts, want) {
+		t.Errorf("got %v, want %v", opts, want)
+	}
+}
+
+func TestServiceConnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pqgotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "pg_service.conf")
+	if err := ioutil.WriteFile(name, []byte(testServiceFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// service parameters override the environment
+	defer setTestEnv("PGAPPNAME", "environment app")()
+
+	for _, dsn := range []string{
+		"service=pqgotest servicefile=" + name + " dbname=explicitdb user=pqgotest sslmode=disable",
+		"postgres://pqgotest@/explicitdb?service=pqgotest&sslmode=disable&servicefile=" + name,
+	} {
+		srv, fd := newFakeServer()
+		done := srv.serve(func(s *fakeServer) {
+			params := s.startup()
+			want := map[string]string{
+				"database":         "explicitdb",
+				"application_name": "service app",
+				"options":          "-c search_path=a,b",
+			}
+			for k, v := range want {
+				if params[k] != v {
+					s.fail("got %s %q, want %q", k, params[k], v)
+				}
+			}
+			for _, k := range []string{"service", "servicefile"} {
+				if _, ok := params[k]; ok {
+					s.fail("%s sent to the server", k)
+				}
+			}
+			s.expect('X')
+		})
+		d := &recordingDialer{fakeDialer: fd}
+		cn, err := DialOpen(d, dsn)
+		if err != nil {
+			t.Fatalf("%s: %v", dsn, err)
+		}
+		cn.Close()
+		if err := <-done; err != nil {
+			t.Fatalf("%s: %v", dsn, err)
+		}
+		if want := []string{"fakehost:5432"}; !reflect.DeepEqual(d.addrs, want) {
+			t.Errorf("%s: dialed %v, want %v", dsn, d.addrs, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package pq
+
+import (
+	"container/list"
+	"strings"
+)
+
+// stmtCache is a least recently used cache of named prepared statements,
+// keyed by their query text.  It's enabled with the statement_cache_capacity
+// connection parameter, and used by Query and Exec for queries which have
+// arguments, in place of the unnamed statement.
+type stmtCache struct {
+	capacity int
+	// most recently used first; the values are *stmt
+	lru   *list.List
+	elems map[string]*list.Element
+}
+
+func newStmtCache(capacity int) *stmtCache {
+	return &stmtCache{
+		capacity: capacity,
+		lru:      list.New(),
+		elems:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the statement cached for q, or nil.
+func (c *stmtCache) get(q string) *stmt {
+	e, ok := c.elems[q]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*stmt)
+}
+
+// put adds st to the cache as the statement for q, and returns the least
+// recently used statement if it had to be evicted to make room.
+func (c *stmtCache) put(q string, st *stmt) (evicted *stmt) {
+	c.elems[q] = c.lru.PushFront(st)
+	if c.lru.Len() <= c.capacity {
+		return nil
+	}
+	e := c.lru.Back()
+	evicted = e.Value.(*stmt)
+	c.lru.Remove(e)
+	delete(c.elems, evicted.cacheKey)
+	return evicted
+}
+
+// remove removes the statement for q from the cache.
+func (c *stmtCache) remove(q string) {
+	if e, ok := c.elems[q]; ok {
+		c.lru.Remove(e)
+		delete(c.elems, q)
+	}
+}
+
+// cachedStmt returns the cached statement for q, preparing and caching it if
+// necessary.  Statements evicted from the cache are deallocated.
+func (cn *conn) cachedStmt(q string) *stmt {
+	if st := cn.stmtCache.get(q); st != nil {
+		return st
+	}
+	st, err := cn.prepareTo(q, cn.gname())
+	if err != nil {
+		panic(err)
+	}
+	st.cacheKey = q
+	if evicted := cn.stmtCache.put(q, st); evicted != nil {
+		if err := evicted.Close(); err != nil {
+			panic(err)
+		}
+	}
+	return st
+}
+
+// withCachedStmt calls f with the cached statement for q.  If f fails because
+// the statement has gone stale, for instance because a table it reads was
+// altered, the statement is prepared again, and, unless the failure aborted a
+// transaction, f is retried once with the new statement.
+func (cn *conn) withCachedStmt(q string, f func(st *stmt)) {
+	st := cn.cachedStmt(q)
+	err := catchError(func() { f(st) })
+	if err == nil {
+		return
+	}
+	if isStaleStmtError(err) {
+		retry := cn.txnStatus == txnStatusIdle
+		cn.stmtCache.remove(q)
+		if cerr := st.Close(); cerr != nil {
+			panic(cerr)
+		}
+		if retry {
+			f(cn.cachedStmt(q))
+			return
+		}
+	}
+	panic(err)
+}
+
+// catchError calls f, and returns the *Error it panics with, if any.
+func catchError(f func()) (err *Error) {
+	defer func() {
+		e := recover()
+		if e == nil {
+			return
+		}
+		var ok bool
+		if err, ok = e.(*Error); !ok {
+			panic(e)
+		}
+	}()
+	f()
+	return nil
+}
+
+// isStaleStmtError reports whether err means that a prepared statement can't
+// be executed any more, but preparing it again would fix that.
+func isStaleStmtError(err *Error) bool {
+	switch err.Code {
+	case "0A000":
+		// feature_not_supported, which is also used for other purposes
+		return strings.Contains(err.Message, "cached plan must not change result type")
+	case "26000":
+		// invalid_sql_statement_name, e.g. after DEALLOCATE ALL
+		return true
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/lib/pq/oid"
+)
+
+func TestStmtCacheLRU(t *testing.T) {
+	c := newStmtCache(2)
+	a, b, d := &stmt{cacheKey: "a"}, &stmt{cacheKey: "b"}, &stmt{cacheKey: "d"}
+	if evicted := c.put("a", a); evicted != nil {
+		t.Fatalf("evicted %q", evicted.cacheKey)
+	}
+	if evicted := c.put("b", b); evicted != nil {
+		t.Fatalf("evicted %q", evicted.cacheKey)
+	}
+	// "a" is now more recently used than "b"
+	if st := c.get("a"); st != a {
+		t.Fatalf("got %v for a", st)
+	}
+	if evicted := c.put("d", d); evicted != b {
+		t.Fatalf("evicted %v, want b", evicted)
+	}
+	if st := c.get("b"); st != nil {
+		t.Fatalf("b still cached")
+	}
+	c.remove("a")
+	if st := c.get("a"); st != nil {
+		t.Fatalf("a still cached")
+	}
+	if st := c.get("d"); st != d {
+		t.Fatalf("got %v for d", st)
+	}
+}
+
+// expectPrepare reads the Parse, Describe and Sync messages of a prepareTo
+// call for the statement name and query, and answers them for a statement
+// with one int4 parameter and no result columns.
+func (s *fakeServer) expectPrepare(name, query string) {
+	r := s.expect('P')
+	if n, q := r.string(), r.string(); n != name || q != query {
+		s.fail("expected to prepare %q as %q, got %q as %q", query, name, q, n)
+	}
+	s.expect('D')
+	s.expect('S')
+	s.send(newFakeMessage('1'))
+	w := newFakeMessage('t')
+	w.int16(1)
+	w.int32(int(oid.T_int4))
+	s.send(w)
+	s.send(newFakeMessage('n'))
+	s.sendReadyForQuery()
+}
+
+// expectBind reads the Bind, Execute and Sync messages executing the
+// statement name.
+func (s *fakeServer) expectBind(name string) {
+	r := s.expect('B')
+	if portal, n := r.string(), r.string(); portal != "" || n != name {
+		s.fail("expected to bind statement %q, got %q", name, n)
+	}
+	s.expect('E')
+	s.expect('S')
+}
+
+// expectClose reads the Close and Sync messages deallocating the statement
+// name, and answers them with the transaction status.
+func (s *fakeServer) expectClose(name string, status transactionStatus) {
+	r := s.expect('C')
+	if typ, n := r.byte(), r.string(); typ != 'S' || n != name {
+		s.fail("expected to close statement %q, got %c %q", name, typ, n)
+	}
+	s.expect('S')
+	s.send(newFakeMessage('3'))
+	s.sendReadyForQueryStatus(status)
+}
+
+func (s *fakeServer) sendBindComplete(tag string) {
+	s.send(newFakeMessage('2'))
+	s.sendCommandComplete(tag)
+	s.sendReadyForQuery()
+}
+
+func TestStmtCache(t *testing.T) {
+	const (
+		q1 = "UPDATE t SET x = x + 1 WHERE id = $1"
+		q2 = "DELETE FROM t WHERE id = $1"
+	)
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		s.expectPrepare("1", q1)
+		s.expectBind("1")
+		s.sendBindComplete("UPDATE 1")
+		// cached
+		s.expectBind("1")
+		s.sendBindComplete("UPDATE 1")
+		// evicts q1
+		s.expectPrepare("2", q2)
+		s.expectClose("1", txnStatusIdle)
+		s.expectBind("2")
+		s.sendBindComplete("DELETE 1")
+		s.expect('X')
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable statement_cache_capacity=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{q1, q1, q2} {
+		if _, err := cn.(driver.Execer).Exec(q, []driver.Value{int64(1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStmtCacheStale(t *testing.T) {
+	const q = "UPDATE t SET x = x + 1 WHERE id = $1"
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		s.expectPrepare("1", q)
+		s.expectBind("1")
+		s.sendError("ERROR", "0A000", "cached plan must not change result type")
+		s.sendReadyForQuery()
+		s.expectClose("1", txnStatusIdle)
+		s.expectPrepare("2", q)
+		s.expectBind("2")
+		s.sendBindComplete("UPDATE 1")
+
+		// in a transaction, which the error aborts
+		s.expectBind("2")
+		s.sendError("ERROR", "0A000", "cached plan must not change result type")
+		s.sendReadyForQueryStatus(txnStatusInFailedTransaction)
+		s.expectClose("2", txnStatusInFailedTransaction)
+		s.expect('X')
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable statement_cache_capacity=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cn.(driver.Execer).Exec(q, []driver.Value{int64(1)}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = cn.(driver.Execer).Exec(q, []driver.Value{int64(1)})
+	if err, ok := err.(*Error); !ok || err.Code != "0A000" {
+		t.Fatalf("expected a cached plan error, got %v", err)
+	}
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStmtCacheAlterTable(t *testing.T) {
+	db, err := openTestConnConninfo("statement_cache_capacity=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// use a single connection, so that the statement is cached on the
+	// connection on which the table is altered
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TEMP TABLE stmtcache (a int)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO stmtcache VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	columns := func() int {
+		rows, err := db.Query("SELECT * FROM stmtcache WHERE a = $1", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		cols, err := rows.Columns()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(cols)
+	}
+	if n := columns(); n != 1 {
+		t.Fatalf("got %d columns, want 1", n)
+	}
+	if _, err := db.Exec("ALTER TABLE stmtcache ADD COLUMN b int"); err != nil {
+		t.Fatal(err)
+	}
+	if n := columns(); n != 2 {
+		t.Fatalf("got %d columns, want 2", n)
+	}
+}
@@ -0,0 +1,248 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq/oid"
+)
+
+// A TypeCodec tells pq how to convert the values of a PostgreSQL type, such as
+// an enum, a domain or a type defined by an extension, to and from Go values.
+// Any of its functions may be nil, in which case pq handles the values as it
+// would without the TypeCodec; values of types pq doesn't know are received
+// as []byte.
+//
+// The functions may be called concurrently for different connections.
+type TypeCodec struct {
+	// DecodeText decodes a value received in the text format, which is
+	// used for the results of queries without arguments.  The returned
+	// value is what Next returns for the column.  src is only valid until
+	// the call returns.
+	DecodeText func(src []byte) (interface{}, error)
+
+	// DecodeBinary decodes a value received in the binary format.  If it
+	// is set, prepared statements receive the values of the type in the
+	// binary format, unless disable_prepared_binary_result is set.  src is
+	// only valid until the call returns.
+	DecodeBinary func(src []byte) (interface{}, error)
+
+	// EncodeText encodes a parameter of the type in the text format.
+	EncodeText func(x interface{}) ([]byte, error)
+
+	// EncodeBinary encodes a parameter of the type in the binary format.
+	// It is used in preference to EncodeText, unless
+	// disable_binary_parameters is set.
+	EncodeBinary func(x interface{}) ([]byte, error)
+}
+
+// typeRegistry holds the types registered with RegisterType and
+// RegisterTypeOID.
+var typeRegistry struct {
+	sync.RWMutex
+	byOid  map[oid.Oid]*TypeCodec
+	byName map[string]*TypeCodec
+	// incremented by each registration, so that connections notice them
+	version int
+	// whether any of the registered types has an encoder
+	encoders bool
+}
+
+// RegisterType registers c as the TypeCodec of the type called name, which
+// can be qualified with the name of its schema, as in "public.ltree";
+// otherwise it's the type of that name found in the search path.  Each
+// connection looks up the OID of the type in pg_type before it first runs a
+// query which might use it, or starts a transaction.  Types which don't exist
+// in the database a connection is established to are ignored.
+//
+// RegisterType is usually called when the program starts, but types
+// registered later are picked up by existing connections, once they aren't in
+// a transaction.
+func RegisterType(name string, c TypeCodec) {
+	typeRegistry.Lock()
+	defer typeRegistry.Unlock()
+	if typeRegistry.byName == nil {
+		typeRegistry.byName = make(map[string]*TypeCodec)
+	}
+	typeRegistry.byName[name] = &c
+	typeRegistered(&c)
+}
+
+// RegisterTypeOID registers c as the TypeCodec of the type with the OID typ,
+// which can also be one of the built-in types, such as oid.T_numeric, whose
+// decoding c then overrides.
+func RegisterTypeOID(typ oid.Oid, c TypeCodec) {
+	typeRegistry.Lock()
+	defer typeRegistry.Unlock()
+	if typeRegistry.byOid == nil {
+		typeRegistry.byOid = make(map[oid.Oid]*TypeCodec)
+	}
+	typeRegistry.byOid[typ] = &c
+	typeRegistered(&c)
+}
+
+// typeRegistered notes in typeRegistry that c has been registered.  The
+// caller must hold the lock of typeRegistry.
+func typeRegistered(c *TypeCodec) {
+	typeRegistry.version++
+	if c.EncodeText != nil || c.EncodeBinary != nil {
+		typeRegistry.encoders = true
+	}
+}
+
+// hasTypeEncoders reports whether any of the registered types has an encoder.
+func hasTypeEncoders() bool {
+	typeRegistry.RLock()
+	defer typeRegistry.RUnlock()
+	return typeRegistry.encoders
+}
+
+// The query resolving the name of a type, $1, optionally qualified with the
+// schema $2, to its OID.
+const typeLookupQuery = `SELECT t.oid FROM pg_catalog.pg_type t
+	JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+	WHERE t.typname = $1 AND (n.nspname = $2 OR $2 = '' AND pg_catalog.pg_type_is_visible(t.oid))`
+
+// resolveTypes updates the codecs of the registered types used by cn, if
+// any types have been registered since it last did so.  The lookup only runs
+// outside of transactions, so that its failure can't abort one; in a
+// transaction the codecs are left as they were.  If the names of the types
+// can't be looked up, the codecs are also left as they were, resolveTypes
+// returns the error, and it tries again the next time it's called.
+func (cn *conn) resolveTypes() error {
+	if cn.txnStatus != txnStatusIdle {
+		return nil
+	}
+	typeRegistry.RLock()
+	version := typeRegistry.version
+	if version == cn.typesVersion {
+		typeRegistry.RUnlock()
+		return nil
+	}
+	types := make(map[oid.Oid]*TypeCodec, len(typeRegistry.byOid)+len(typeRegistry.byName))
+	for typ, c := range typeRegistry.byOid {
+		types[typ] = c
+	}
+	byName := make(map[string]*TypeCodec, len(typeRegistry.byName))
+	for name, c := range typeRegistry.byName {
+		byName[name] = c
+	}
+	typeRegistry.RUnlock()
+
+	prevVersion, prevTypes := cn.typesVersion, cn.parameterStatus.types
+	// Don't let the lookup query resolve the types itself, nor decode its
+	// results with the codecs registered so far.
+	cn.typesVersion = version
+	cn.parameterStatus.types = nil
+	if len(byName) > 0 {
+		if err := cn.lookupTypes(byName, types); err != nil {
+			cn.typesVersion, cn.parameterStatus.types = prevVersion, prevTypes
+			return err
+		}
+	}
+	cn.parameterStatus.types = types
+	return nil
+}
+
+// lookupTypes adds the codecs of byName to types under the OIDs of the types
+// they're registered for.  Types which don't exist are left out.
+func (cn *conn) lookupTypes(byName map[string]*TypeCodec, types map[oid.Oid]*TypeCodec) error {
+	st, err := cn.prepareTo(typeLookupQuery, "")
+	if err != nil {
+		return err
+	}
+	for name, c := range byName {
+		typ, ok, err := cn.lookupType(st, name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			types[typ] = c
+		}
+	}
+	return nil
+}
+
+// lookupType runs st, which must be the prepared typeLookupQuery, to find the
+// OID of the type called name.
+func (cn *conn) lookupType(st *stmt, name string) (typ oid.Oid, ok bool, err error) {
+	schema := ""
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		schema, name = name[:i], name[i+1:]
+	}
+	if e := catchError(func() { st.exec([]driver.Value{name, schema}) }); e != nil {
+		return 0, false, e
+	}
+	rs := &rows{cn: cn, rowsHeader: st.rowsHeader}
+	dest := make([]driver.Value, 1)
+	for {
+		err := rs.Next(dest)
+		if err == io.EOF {
+			return typ, ok, nil
+		} else if err != nil {
+			return 0, false, err
+		}
+		n, err := strconv.ParseUint(string(dest[0].([]byte)), 10, 32)
+		if err != nil {
+			return 0, false, fmt.Errorf("pq: unexpected OID %q for type %s", dest[0], name)
+		}
+		typ, ok = oid.Oid(n), true
+	}
+}
+
+// convertParameter converts x, a parameter of the type typ, to a driver
+// value, unless it is one already or the registered type of typ has an
+// encoder.  Values which database/sql can't convert are passed on as they are
+// by CheckNamedValue when any registered types have encoders.
+func convertParameter(parameterStatus *parameterStatus, x interface{}, typ oid.Oid) interface{} {
+	if driver.IsValue(x) {
+		return x
+	}
+	if c := parameterStatus.types[typ]; c != nil && (c.EncodeText != nil || c.EncodeBinary != nil) {
+		return x
+	}
+	v, err := driver.DefaultParameterConverter.ConvertValue(x)
+	if err != nil {
+		errorf("converting a parameter of type %T: %v", x, err)
+	}
+	return v
+}
+
+// decode decodes s, a value of the type typ in the format f, with the
+// decoder of c for that format, if c has one.
+func (c *TypeCodec) decode(s []byte, typ oid.Oid, f format) (interface{}, bool) {
+	d := c.DecodeText
+	if f == formatBinary {
+		d = c.DecodeBinary
+	}
+	if d == nil {
+		return nil, false
+	}
+	v, err := d(s)
+	if err != nil {
+		errorf("decoding a value of type %d: %v", uint32(typ), err)
+	}
+	return v, true
+}
+
+// encode encodes x, a parameter of the type typ, with the binary encoder of c
+// if it has one and allowBinary is true, or else with its text encoder, if it
+// has one.
+func (c *TypeCodec) encode(x interface{}, typ oid.Oid, allowBinary bool) ([]byte, format, bool) {
+	e, f := c.EncodeText, formatText
+	if allowBinary && c.EncodeBinary != nil {
+		e, f = c.EncodeBinary, formatBinary
+	}
+	if e == nil {
+		return nil, f, false
+	}
+	b, err := e(x)
+	if err != nil {
+		errorf("encoding a parameter of type %d: %v", uint32(typ), err)
+	}
+	return b, f, true
+}
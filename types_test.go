@@ -0,0 +1,285 @@
+package pq
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq/oid"
+)
+
+// resetTypeRegistry forgets the types registered by a test.
+func resetTypeRegistry() {
+	typeRegistry.Lock()
+	defer typeRegistry.Unlock()
+	typeRegistry.byOid = nil
+	typeRegistry.byName = nil
+	typeRegistry.encoders = false
+	typeRegistry.version++
+}
+
+type mood string
+
+var moodCodec = TypeCodec{
+	DecodeText: func(src []byte) (interface{}, error) {
+		if len(src) == 0 {
+			return nil, errors.New("empty mood")
+		}
+		return mood(strings.ToUpper(string(src))), nil
+	},
+	EncodeText: func(x interface{}) ([]byte, error) {
+		m, ok := x.(mood)
+		if !ok {
+			return nil, errors.New("not a mood")
+		}
+		return []byte(strings.ToLower(string(m))), nil
+	},
+}
+
+// expectTypeLookup answers the lookup of the OID of the type name, which is
+// found to be typ.
+func (s *fakeServer) expectTypeLookup(name string, typ oid.Oid) {
+	s.expect('P')
+	s.expect('D')
+	s.expect('S')
+	s.send(newFakeMessage('1'))
+	w := newFakeMessage('t')
+	w.int16(2)
+	w.int32(int(oid.T_name))
+	w.int32(int(oid.T_name))
+	s.send(w)
+	s.sendRowDescription([]string{"oid"}, []oid.Oid{oid.T_oid})
+	s.sendReadyForQuery()
+
+	r := s.expect('B')
+	r.string()
+	r.string()
+	r.next(2 * r.int16())
+	r.int16()
+	if n := r.next(r.int32()); string(n) != name {
+		s.fail("expected a lookup of type %q, got %q", name, n)
+	}
+	s.expect('E')
+	s.expect('S')
+	s.send(newFakeMessage('2'))
+	s.sendDataRow([]byte{byte(typ >> 24), byte(typ >> 16), byte(typ >> 8), byte(typ)})
+	s.sendCommandComplete("SELECT 1")
+	s.sendReadyForQuery()
+}
+
+func TestRegisterType(t *testing.T) {
+	defer resetTypeRegistry()
+	const (
+		moodOid  = oid.Oid(16500)
+		pointOid = oid.Oid(16600)
+	)
+	RegisterType("mood", moodCodec)
+	RegisterTypeOID(pointOid, TypeCodec{
+		DecodeBinary: func(src []byte) (interface{}, error) {
+			return [2]byte{src[0], src[1]}, nil
+		},
+	})
+
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		s.expectTypeLookup("mood", moodOid)
+
+		// the text format
+		s.expectQuery("SELECT m, p FROM t")
+		s.sendRowDescription([]string{"m", "p"}, []oid.Oid{moodOid, pointOid})
+		s.sendDataRow([]byte("happy"), []byte("(1,2)"))
+		s.sendCommandComplete("SELECT 1")
+		s.sendReadyForQuery()
+
+		// the binary format, and parameters
+		s.expect('P')
+		s.expect('D')
+		s.expect('S')
+		s.send(newFakeMessage('1'))
+		w := newFakeMessage('t')
+		w.int16(1)
+		w.int32(int(moodOid))
+		s.send(w)
+		s.sendRowDescription([]string{"m", "p"}, []oid.Oid{moodOid, pointOid})
+		s.sendReadyForQuery()
+
+		r := s.expect('B')
+		r.string()
+		r.string()
+		if n := r.int16(); n != 0 {
+			s.fail("expected all parameters in the text format, got %d format codes", n)
+		}
+		r.int16()
+		if param := r.next(r.int32()); string(param) != "sad" {
+			s.fail("unexpected parameter %q", param)
+		}
+		var formats []int
+		for i := r.int16(); i > 0; i-- {
+			formats = append(formats, r.int16())
+		}
+		if !reflect.DeepEqual(formats, []int{0, 1}) {
+			s.fail("unexpected result formats %v", formats)
+		}
+		s.expect('E')
+		s.expect('S')
+		s.send(newFakeMessage('2'))
+		s.sendDataRow([]byte("sad"), []byte{1, 2})
+		s.sendCommandComplete("SELECT 1")
+		s.sendReadyForQuery()
+		s.expect('X')
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cn.(driver.Queryer).Query("SELECT m, p FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := make([]driver.Value, 2)
+	if err := r.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	// pointOid has no text decoder
+	if dest[0] != mood("HAPPY") || !bytes.Equal(dest[1].([]byte), []byte("(1,2)")) {
+		t.Errorf("got %#v", dest)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := cn.Prepare("SELECT $1::mood, p FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = st.Query([]driver.Value{mood("SAD")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if dest[0] != mood("SAD") || dest[1] != [2]byte{1, 2} {
+		t.Errorf("got %#v", dest)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisterTypeTransaction(t *testing.T) {
+	defer resetTypeRegistry()
+	const moodOid = oid.Oid(16500)
+
+	srv, d := newFakeServer()
+	done := srv.serve(func(s *fakeServer) {
+		s.startup()
+		// looked up before the transaction starts
+		s.expectTypeLookup("mood", moodOid)
+		s.expectQuery("BEGIN")
+		s.sendCommandComplete("BEGIN")
+		s.sendReadyForQueryStatus(txnStatusIdleInTransaction)
+
+		// but not in it
+		s.expectQuery("SELECT m FROM t")
+		s.sendRowDescription([]string{"m"}, []oid.Oid{moodOid})
+		s.sendDataRow([]byte("happy"))
+		s.sendCommandComplete("SELECT 1")
+		s.sendReadyForQueryStatus(txnStatusIdleInTransaction)
+		s.expectQuery("COMMIT")
+		s.sendCommandComplete("COMMIT")
+		s.sendReadyForQuery()
+
+		// a failed lookup is reported, and retried
+		s.expect('P')
+		s.expect('D')
+		s.expect('S')
+		s.sendError("ERROR", "57014", "canceling statement due to statement timeout")
+		s.sendReadyForQuery()
+		s.expectTypeLookup("mood", moodOid)
+		s.expectQuery("SELECT 1")
+		s.sendRowDescription([]string{"?column?"}, []oid.Oid{oid.T_int4})
+		s.sendCommandComplete("SELECT 0")
+		s.sendReadyForQuery()
+		s.expect('X')
+	})
+	cn, err := DialOpen(d, "user=pqgotest sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterType("mood", moodCodec)
+	if _, err := cn.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	RegisterTypeOID(16600, TypeCodec{})
+	r, err := cn.(driver.Queryer).Query("SELECT m FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := make([]driver.Value, 1)
+	if err := r.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if dest[0] != mood("HAPPY") {
+		t.Errorf("got %#v", dest)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cn.(driver.Tx).Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cn.(driver.Queryer).Query("SELECT 1", nil); err == nil || err.(*Error).Code != "57014" {
+		t.Fatalf("expected the lookup to fail, got %v", err)
+	}
+	r, err = cn.(driver.Queryer).Query("SELECT 1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	cn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisterTypeDB(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer txn.Rollback()
+	if _, err := txn.Exec("CREATE TYPE pg_temp.mood AS ENUM ('happy', 'sad')"); err != nil {
+		t.Fatal(err)
+	}
+
+	defer resetTypeRegistry()
+	RegisterType("mood", moodCodec)
+
+	var m interface{}
+	if err := txn.QueryRow("SELECT 'happy'::mood").Scan(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m != mood("HAPPY") {
+		t.Errorf("got %#v", m)
+	}
+	var s string
+	if err := txn.QueryRow("SELECT $1::mood::text", mood("SAD")).Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "sad" {
+		t.Errorf("got %q", s)
+	}
+}
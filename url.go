@@ -28,7 +28,20 @@ import (
 //	"postgres://"
 //
 // This will be blank, causing driver.Open to use all of the defaults
+//
+// Several hosts may be given as a comma-separated list, each with an
+// optional port:
+//
+//	"postgres://bob@1.2.3.4:5432,[::1]:5433,example.com/mydb"
+//
+// converts to:
+//
+//	"dbname=mydb host=1.2.3.4,::1,example.com port=5432,5433, user=bob"
 func ParseURL(url string) (string, error) {
+	// net/url can't make sense of a list of hosts, so take them out of the
+	// URL and parse them separately.
+	url, hostList := splitURLHosts(url)
+
 	u, err := nurl.Parse(url)
 	if err != nil {
 		return "", err
@@ -54,12 +67,22 @@ func ParseURL(url string) (string, error) {
 		accrue("password", v)
 	}
 
-	i := strings.Index(u.Host, ":")
-	if i < 0 {
-		accrue("host", u.Host)
-	} else {
-		accrue("host", u.Host[:i])
-		accrue("port", u.Host[i+1:])
+	if hostList != "" {
+		var hosts, ports []string
+		anyPort := false
+		for _, hostport := range strings.Split(hostList, ",") {
+			host, port, err := splitURLHostPort(hostport)
+			if err != nil {
+				return "", err
+			}
+			hosts = append(hosts, host)
+			ports = append(ports, port)
+			anyPort = anyPort || port != ""
+		}
+		accrue("host", strings.Join(hosts, ","))
+		if anyPort {
+			accrue("port", strings.Join(ports, ","))
+		}
 	}
 
 	if u.Path != "" {
@@ -74,3 +97,45 @@ func ParseURL(url string) (string, error) {
 	sort.Strings(kvs) // Makes testing easier (not a performance concern)
 	return strings.Join(kvs, " "), nil
 }
+
+// splitURLHosts removes the host list from the authority component of url,
+// and returns the resulting URL along with the list.
+func splitURLHosts(url string) (rest, hostList string) {
+	i := strings.Index(url, "://")
+	if i < 0 {
+		return url, ""
+	}
+	start := i + len("://")
+	end := len(url)
+	if j := strings.IndexAny(url[start:], "/?#"); j >= 0 {
+		end = start + j
+	}
+	if at := strings.LastIndex(url[start:end], "@"); at >= 0 {
+		start += at + 1
+	}
+	return url[:start] + url[end:], url[start:end]
+}
+
+// splitURLHostPort splits an entry of a URL's host list into the host and the
+// port, either of which may be empty.  IPv6 addresses must be enclosed in
+// square brackets, which are removed.
+func splitURLHostPort(hostport string) (host, port string, err error) {
+	if strings.HasPrefix(hostport, "[") {
+		end := strings.Index(hostport, "]")
+		if end < 0 {
+			return "", "", fmt.Errorf("missing ']' in host %q", hostport)
+		}
+		host, hostport = hostport[1:end], hostport[end+1:]
+		if hostport != "" && hostport[0] != ':' {
+			return "", "", fmt.Errorf("unexpected %q after host %q", hostport, host)
+		}
+	} else if i := strings.Index(hostport, ":"); i >= 0 {
+		host, hostport = hostport[:i], hostport[i:]
+	} else {
+		return hostport, "", nil
+	}
+	if hostport != "" {
+		port = hostport[1:]
+	}
+	return host, port, nil
+}
@@ -52,3 +52,32 @@ func TestMinimalURL(t *testing.T) {
 		t.Fatalf("expected blank connection string, got: %q", cs)
 	}
 }
+
+func TestMultiHostParseURL(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"postgres://a,b/db", "dbname=db host=a,b"},
+		{"postgres://a:1,b:2", "host=a,b port=1,2"},
+		{"postgres://bob:pw@a:1,b?sslmode=disable", "host=a,b password=pw port=1, sslmode=disable user=bob"},
+		{"postgres://[::1]:5433,[fe80::1]/db", "dbname=db host=::1,fe80::1 port=5433,"},
+		{"postgres://[::1]", "host=::1"},
+		{"postgresql://u@/db", "dbname=db user=u"},
+	}
+	for _, tt := range tests {
+		got, err := ParseURL(tt.url)
+		if err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.url, got, tt.want)
+		}
+	}
+
+	for _, url := range []string{"postgres://[::1/db", "postgres://[::1]x:5432/db"} {
+		if _, err := ParseURL(url); err == nil {
+			t.Errorf("%s: expected an error", url)
+		}
+	}
+}
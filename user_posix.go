@@ -22,3 +22,27 @@ func userCurrent() (string, error) {
 
 	return "", ErrCouldNotDetectUsername
 }
+
+// userHomeDir returns the directory in which libpq looks for the user's
+// configuration files, or "" if it can't be determined.
+func userHomeDir() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return home
+	}
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return u.HomeDir
+}
+
+// defaultPassfile is the name of the password file in the user's home
+// directory.
+const defaultPassfile = ".pgpass"
+
+// passfileUsable reports whether a password file with the given file info may
+// be used.  Like libpq, we refuse to use password files which can be read by
+// anyone but their owner.
+func passfileUsable(fi os.FileInfo) bool {
+	return fi.Mode().IsRegular() && fi.Mode().Perm()&0077 == 0
+}
@@ -2,6 +2,7 @@
 package pq
 
 import (
+	"os"
 	"path/filepath"
 	"syscall"
 )
@@ -25,3 +26,24 @@ func userCurrent() (string, error) {
 	u := filepath.Base(s)
 	return u, nil
 }
+
+// userHomeDir returns the directory in which libpq looks for the user's
+// configuration files, or "" if it can't be determined.  On Windows this is
+// %APPDATA%\postgresql rather than the actual home directory.
+func userHomeDir() string {
+	appdata := os.Getenv("APPDATA")
+	if appdata == "" {
+		return ""
+	}
+	return filepath.Join(appdata, "postgresql")
+}
+
+// defaultPassfile is the name of the password file in the user's home
+// directory.
+const defaultPassfile = "pgpass.conf"
+
+// passfileUsable reports whether a password file with the given file info may
+// be used.  File permissions are not checked on Windows, just like in libpq.
+func passfileUsable(fi os.FileInfo) bool {
+	return fi.Mode().IsRegular()
+}